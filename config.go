@@ -19,6 +19,9 @@ type ThreatmodelSpecConfig struct {
 	STRIDE                         []string `hcl:"strides,optional"`
 	UptimeDepClassifications       []string `hcl:"uptime_dep_classifications,optional"`
 	DefaultUptimeDepClassification string   `hcl:"default_uptime_dep_classification,optional"`
+	// Strict makes values outside of the lists above validation errors,
+	// rather than being dropped or replaced with the default
+	Strict bool `hcl:"strict,optional"`
 }
 
 func LoadSpecConfig() (*ThreatmodelSpecConfig, error) {
@@ -75,6 +78,9 @@ func (t *ThreatmodelSpecConfig) LoadSpecConfigFile(file string) error {
 		if specConfig.DefaultUptimeDepClassification != "" {
 			t.DefaultUptimeDepClassification = specConfig.DefaultUptimeDepClassification
 		}
+		if specConfig.Strict {
+			t.Strict = true
+		}
 
 		return nil
 	}
@@ -11,27 +11,27 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
-// Diagnostics returns the union of syntax, structural (schema), and semantic
-// (enum) problems for a threatcl document, each carrying an hcl.Range. It is
+// Diagnostics returns the union of syntax, structural (schema), enum and
+// semantic problems for a threatcl document, each carrying an hcl.Range. It is
 // error-tolerant: it never bails on the first problem, so an editor gets a full
 // list on every keystroke.
 //
-// The three layers, all collecting (never gating on HasErrors):
+// The four layers, all collecting (never gating on HasErrors):
 //
 //  1. Syntax — malformed HCL, from hclsyntax via ParseSource.
 //  2. Structural — unknown blocks/attributes and missing required attributes,
 //     computed with hcl.Body.Content against the schema. Content does NOT
 //     evaluate expressions, so var.* / import.* references never produce false
 //     positives here (and no remote import is ever fetched).
-//  3. Semantic — invalid enum values (risk likelihood/impact/severity are
+//  3. Enum — invalid enum values (risk likelihood/impact/severity are
 //     errors; stride/impacts/classification/initiative_size/uptime_dependency
 //     are warnings), checked directly against the AST so they pinpoint the
 //     offending value.
-//
-// Deliberately out of scope for v1: range-mapping the full ValidateTm
-// multierror (duplicate names, information_asset reference existence, DFD flow
-// wiring). Those plain-string errors are keyed on names/descriptions rather
-// than positions; precise mapping is deferred.
+//  4. Semantic — the rest of the spec parser's validation (duplicate names,
+//     information_asset references, DFD flow wiring, trust_zone mismatches),
+//     also checked against the AST, on the offending label or value. Anything
+//     that depends on evaluation or on other files is skipped; see
+//     semanticDiags.
 func Diagnostics(filename string, src []byte) hcl.Diagnostics {
 	pf, syntaxDiags := ParseSource(filename, src)
 
@@ -42,6 +42,7 @@ func Diagnostics(filename string, src []byte) hcl.Diagnostics {
 		root := Schema()
 		out = append(out, structuralDiags(pf.Body, root)...)
 		out = append(out, enumDiags(pf.Body, root)...)
+		out = append(out, semanticDiags(pf.Body)...)
 	}
 
 	sortDiags(out)
@@ -51,6 +52,12 @@ func Diagnostics(filename string, src []byte) hcl.Diagnostics {
 // structuralDiags recursively checks a body against a schema using
 // hcl.Body.Content, descending into every block whose type is known.
 func structuralDiags(body *hclsyntax.Body, bs *BodySchema) hcl.Diagnostics {
+	if bs.AnyAttrs {
+		// Any attribute name is valid, but blocks aren't
+		_, diags := body.JustAttributes()
+		return diags
+	}
+
 	content, diags := body.Content(toHCLSchema(bs))
 
 	// Content returns the matched blocks even alongside diagnostics, so we can
@@ -134,6 +134,162 @@ func TestDiagnosticsUnknownBlockAndAttr(t *testing.T) {
 	}
 }
 
+func TestDiagnosticsLocals(t *testing.T) {
+	src := `locals {
+  service = "payments"
+  db_name = "${local.service}-db"
+}
+
+threatmodel "tm" {
+  author      = "@me"
+  description = local.db_name
+}
+`
+	if errs := errorsOnly(Diagnostics("locals.hcl", []byte(src))); len(errs) > 0 {
+		t.Fatalf("expected no error diagnostics for locals, got: %v", errs)
+	}
+
+	nested := "locals {\n  nested {}\n}\n"
+	if errs := errorsOnly(Diagnostics("locals.hcl", []byte(nested))); len(errs) == 0 {
+		t.Errorf("expected an error diagnostic for a block inside locals")
+	}
+}
+
+func TestDiagnosticsVariableTypes(t *testing.T) {
+	src := `variable "replicas" {
+  type    = number
+  default = 2
+}
+
+variable "owners" {
+  type    = object({ web = string })
+  default = { web = "@web" }
+}
+
+variable "env" {
+  type    = "string"
+  default = "prod"
+}
+
+threatmodel "tm" {
+  author = var.owners.web
+}
+`
+	if diags := Diagnostics("vars.hcl", []byte(src)); len(diags) > 0 {
+		t.Fatalf("expected no diagnostics for variable types, got: %v", diags)
+	}
+
+	// Any type expression is valid, so there's no fixed list to offer
+	pf, _ := ParseSource("vars.hcl", []byte(src))
+	if got := labels(CompletionsAt(pf, cursor(t, src, "type    = number", len("type    = ")))); len(got) > 0 {
+		t.Errorf("expected no enum values for a variable type, got %v", got)
+	}
+}
+
+func TestDiagnosticsEnabled(t *testing.T) {
+	src := `variable "pci" {
+  default = "false"
+}
+
+threatmodel "tm" {
+  author = "@me"
+
+  threat "skimming" {
+    enabled     = var.pci
+    description = "Card data is skimmed"
+  }
+}
+`
+	if errs := errorsOnly(Diagnostics("enabled.hcl", []byte(src))); len(errs) > 0 {
+		t.Fatalf("expected no error diagnostics for enabled, got: %v", errs)
+	}
+
+	unsupported := "threatmodel \"tm\" {\n  author = \"@me\"\n  enabled = false\n}\n"
+	if errs := errorsOnly(Diagnostics("enabled.hcl", []byte(unsupported))); len(errs) == 0 {
+		t.Errorf("expected an error diagnostic for enabled on a threatmodel")
+	}
+}
+
+func TestDiagnosticsSemantic(t *testing.T) {
+	src := readFixture(t, "semantic.hcl")
+
+	var got []string
+	for _, d := range errorsOnly(Diagnostics("semantic.hcl", src)) {
+		got = append(got, d.Summary+" @ "+rangeText(src, d.Subject))
+	}
+
+	want := []string{
+		`Duplicate information_asset @ "creds"`,
+		`Unknown information_asset @ "missing"`,
+		`Duplicate data_store @ "web"`,
+		`Unknown information_asset @ "nope"`,
+		`Trust zone mismatch @ "core"`,
+		`Invalid flow to @ "ghost"`,
+		`Flow connects to itself @ "loop"`,
+		`Duplicate threatmodel @ "Semantic"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("semantic diagnostics =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDiagnosticsSemanticSkipsUnresolved(t *testing.T) {
+	// Each of these can only be checked by evaluating or fetching something,
+	// so none of them are reported
+	src := `threatmodel "tm" {
+  author                    = "@me"
+  information_asset_imports = ["import.information_asset.shared"]
+
+  threat "t" {
+    description            = "words"
+    information_asset_refs = ["shared", var.asset]
+  }
+
+  data_flow_diagram_v2 "dfd" {
+    process "svc" {
+      for_each = ["a", "b"]
+    }
+
+    process "web" {
+      enabled = var.web
+    }
+
+    process "web" {}
+
+    flow "f" {
+      from = "web"
+      to   = "svc[a]"
+    }
+  }
+}
+`
+	if errs := errorsOnly(Diagnostics("skips.hcl", []byte(src))); len(errs) > 0 {
+		t.Errorf("expected no error diagnostics, got: %v", errs)
+	}
+
+	disabled := `threatmodel "tm" {
+  author = "@me"
+
+  data_flow_diagram_v2 "dfd" {
+    process "web" {}
+
+    process "web" {
+      enabled = false
+    }
+
+    flow "f" {
+      from = "web"
+      to   = "web2"
+    }
+  }
+}
+`
+	errs := errorsOnly(Diagnostics("disabled.hcl", []byte(disabled)))
+	if len(errs) != 1 || errs[0].Summary != "Invalid flow to" {
+		t.Errorf("expected only an invalid flow to diagnostic, got: %v", errs)
+	}
+}
+
 func rangeText(src []byte, r *hcl.Range) string {
 	if r == nil {
 		return ""
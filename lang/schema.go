@@ -83,9 +83,11 @@ type BlockSchema struct {
 }
 
 // BodySchema is the set of blocks and attributes valid in a given body.
+// AnyAttrs marks a body, such as locals, whose attributes are freely named.
 type BodySchema struct {
-	Blocks []BlockSchema
-	Attrs  []AttrSchema
+	Blocks   []BlockSchema
+	Attrs    []AttrSchema
+	AnyAttrs bool
 }
 
 // Schema returns the root schema for a threatcl document (the body of a
@@ -102,8 +104,9 @@ func Schema() *BodySchema {
 		},
 		Blocks: []BlockSchema{
 			threatmodelBlock(cfg),
-			componentBlock(),
+			componentBlock(cfg),
 			variableBlock(),
+			localsBlock(),
 			backendBlock(),
 		},
 	}
@@ -123,7 +126,10 @@ func threatmodelBlock(cfg *spec.ThreatmodelSpecConfig) BlockSchema {
 				{Name: "diagram_link", Type: "string", Doc: "A URL to an externally-hosted diagram."},
 				{Name: "repository", Type: "list(string)", Doc: "Source code repositories this model covers (full URLs)."},
 				{Name: "imports", Type: "list(string)", Doc: "Remote sources to import reusable components/controls from."},
-				{Name: "including", Type: "string", Doc: "A single remote threat model to merge into this one."},
+				{Name: "threat_imports", Type: "list(string)", Doc: "Imported threat components to add (import.threat.NAME)."},
+				{Name: "information_asset_imports", Type: "list(string)", Doc: "Imported information_asset components to add (import.information_asset.NAME)."},
+				{Name: "third_party_dependency_imports", Type: "list(string)", Doc: "Imported third_party_dependency components to add (import.third_party_dependency.NAME)."},
+				{Name: "including", Type: "string or list(string)", Doc: "Threat models to merge into this one: a single source, or a list merged in order. Which side wins where both define an element depends on the parser's include merge strategy (see SetIncludeMergeStrategy): keep_parent, the default, keeps this model's values, then earlier sources' over later ones; keep_included lets included values win, with later sources over earlier ones; deep_merge combines threats, keeping this model's values where set but filling in the rest and combining controls and lists, and otherwise acts like keep_parent."},
 				{Name: "created_at", Type: "number", Doc: "Unix timestamp this model was created."},
 				{Name: "updated_at", Type: "number", Doc: "Unix timestamp this model was last updated."},
 			},
@@ -157,6 +163,7 @@ func threatmodelBlock(cfg *spec.ThreatmodelSpecConfig) BlockSchema {
 						{Name: "information_classification", Type: "string", EnumValues: cfg.InfoClassifications, Doc: "Sensitivity classification of the asset."},
 						{Name: "source", Type: "string", Doc: "Where this asset originates."},
 						{Name: "ref", Type: "string", Doc: "An external reference id for this asset."},
+						forEachAttr(),
 					}},
 				},
 				threatBlock(cfg),
@@ -189,6 +196,7 @@ func threatmodelBlock(cfg *spec.ThreatmodelSpecConfig) BlockSchema {
 						{Name: "open_source", Type: "bool", Doc: "Whether the dependency is open source."},
 						{Name: "infrastructure", Type: "bool", Doc: "Whether the dependency is infrastructure."},
 						{Name: "uptime_notes", Type: "string", Doc: "Notes about the uptime dependency."},
+						enabledAttr(),
 					}},
 				},
 				dfdBlock("data_flow_diagram_v2", []string{"name"}, "A data flow diagram (v2). The label is its title.", true),
@@ -223,6 +231,8 @@ func threatBlock(cfg *spec.ThreatmodelSpecConfig) BlockSchema {
 				{Name: "control_imports", Type: "list(string)", Doc: "References to imported controls (import.control.NAME)."},
 				{Name: "control", Type: "string", Doc: "Deprecated free-text control. Prefer a control block."},
 				{Name: "ref", Type: "string", Doc: "An external reference id for this threat."},
+				forEachAttr(),
+				enabledAttr(),
 			},
 			Blocks: []BlockSchema{
 				riskBlock(),
@@ -260,24 +270,56 @@ func riskBlock() BlockSchema {
 // `control` and the deprecated `expanded_control`, which share the Control
 // struct).
 func controlBlock(typeName, doc string) BlockSchema {
+	attrs := []AttrSchema{
+		{Name: "description", Required: true, Type: "string", Doc: "Description of the control."},
+		{Name: "implemented", Type: "bool", Doc: "Whether the control is implemented."},
+		{Name: "implementation_notes", Type: "string", Doc: "Notes about the implementation."},
+		{Name: "risk_reduction", Type: "number", Doc: "Percentage by which this control reduces risk."},
+		{Name: "ref", Type: "string", Doc: "An external reference id for this control."},
+	}
+	if typeName == "control" {
+		attrs = append(attrs, forEachAttr(), enabledAttr())
+	}
+
 	return BlockSchema{
 		Type:       typeName,
 		Labels:     []string{"name"},
 		Doc:        doc,
 		Repeatable: true,
 		Body: BodySchema{
-			Attrs: []AttrSchema{
-				{Name: "description", Required: true, Type: "string", Doc: "Description of the control."},
-				{Name: "implemented", Type: "bool", Doc: "Whether the control is implemented."},
-				{Name: "implementation_notes", Type: "string", Doc: "Notes about the implementation."},
-				{Name: "risk_reduction", Type: "number", Doc: "Percentage by which this control reduces risk."},
-				{Name: "ref", Type: "string", Doc: "An external reference id for this control."},
-			},
+			Attrs:  attrs,
 			Blocks: []BlockSchema{controlAttributeBlock()},
 		},
 	}
 }
 
+// metaArguments are the attributes the parser handles itself, rather than
+// decoding into a spec struct field.
+var metaArguments = map[string]bool{
+	"for_each": true,
+	"enabled":  true,
+}
+
+// forEachAttr is the for_each meta-argument. The parser expands it before
+// decoding, so it has no struct field.
+func forEachAttr() AttrSchema {
+	return AttrSchema{
+		Name: "for_each",
+		Type: "map or set of strings",
+		Doc:  "Repeats this block once per element, named \"NAME[KEY]\", with each.key and each.value available.",
+	}
+}
+
+// enabledAttr is the enabled meta-argument. The parser drops the block when it's
+// false, before decoding, so it has no struct field.
+func enabledAttr() AttrSchema {
+	return AttrSchema{
+		Name: "enabled",
+		Type: "bool",
+		Doc:  "Whether to include this block. When false it's left out of the parsed model.",
+	}
+}
+
 func controlAttributeBlock() BlockSchema {
 	return BlockSchema{
 		Type:       "attribute",
@@ -314,6 +356,8 @@ func dfdBlock(typeName string, labels []string, doc string, repeatable bool) Blo
 						{Name: "from", Required: true, Type: "string", Doc: "Name of the source element."},
 						{Name: "to", Required: true, Type: "string", Doc: "Name of the destination element."},
 						{Name: "protocol", Type: "string", Doc: "Protocol used for the flow."},
+						forEachAttr(),
+						enabledAttr(),
 					}},
 				},
 				{
@@ -321,7 +365,12 @@ func dfdBlock(typeName string, labels []string, doc string, repeatable bool) Blo
 					Labels:     []string{"name"},
 					Doc:        "A trust boundary grouping diagram elements.",
 					Repeatable: true,
-					Body:       BodySchema{Blocks: dfdElementBlocks()},
+					Body: BodySchema{
+						Attrs: []AttrSchema{
+							{Name: "trust_rating", Type: "number", Doc: "OTM trust rating of the zone, from 0 (untrusted) to 100 (fully trusted). Defaults to 50."},
+						},
+						Blocks: dfdElementBlocks(),
+					},
 				},
 			}...),
 		},
@@ -339,6 +388,8 @@ func dfdElementBlocks() []BlockSchema {
 			Repeatable: true,
 			Body: BodySchema{Attrs: []AttrSchema{
 				{Name: "trust_zone", Type: "string", Doc: "Trust zone this element belongs to."},
+				forEachAttr(),
+				enabledAttr(),
 			}},
 		},
 		{
@@ -348,6 +399,7 @@ func dfdElementBlocks() []BlockSchema {
 			Repeatable: true,
 			Body: BodySchema{Attrs: []AttrSchema{
 				{Name: "trust_zone", Type: "string", Doc: "Trust zone this element belongs to."},
+				enabledAttr(),
 			}},
 		},
 		{
@@ -358,16 +410,17 @@ func dfdElementBlocks() []BlockSchema {
 			Body: BodySchema{Attrs: []AttrSchema{
 				{Name: "trust_zone", Type: "string", Doc: "Trust zone this element belongs to."},
 				{Name: "information_asset", Type: "string", Doc: "Name of a linked information_asset."},
+				enabledAttr(),
 			}},
 		},
 	}
 }
 
-func componentBlock() BlockSchema {
+func componentBlock(cfg *spec.ThreatmodelSpecConfig) BlockSchema {
 	return BlockSchema{
 		Type:       "component",
 		Labels:     []string{"component_type", "component_name"},
-		Doc:        "A reusable component (e.g. a control) importable by other models.",
+		Doc:        "A reusable component (a control, threat, information_asset or third_party_dependency) importable by other models.",
 		Repeatable: true,
 		Body: BodySchema{
 			Attrs: []AttrSchema{
@@ -375,8 +428,24 @@ func componentBlock() BlockSchema {
 				{Name: "implemented", Type: "bool", Doc: "Whether the component is implemented."},
 				{Name: "implementation_notes", Type: "string", Doc: "Notes about the implementation."},
 				{Name: "risk_reduction", Type: "number", Doc: "Percentage by which this component reduces risk."},
+				{Name: "ref", Type: "string", Doc: "An external reference id for this component."},
+				{Name: "impacts", Type: "list(string)", EnumValues: cfg.ImpactTypes, Doc: "Threat components: which security properties this threat impacts."},
+				{Name: "stride", Type: "list(string)", EnumValues: cfg.STRIDE, Doc: "Threat components: STRIDE categories this threat falls under."},
+				{Name: "information_asset_refs", Type: "list(string)", Doc: "Threat components: names of information_assets this threat affects."},
+				{Name: "information_classification", Type: "string", EnumValues: cfg.InfoClassifications, Doc: "Information asset components: sensitivity classification of the asset."},
+				{Name: "source", Type: "string", Doc: "Information asset components: where this asset originates."},
+				{Name: "uptime_dependency", Type: "string", EnumValues: cfg.UptimeDepClassifications, Doc: "Third party dependency components: how much the system's uptime depends on this."},
+				{Name: "saas", Type: "bool", Doc: "Third party dependency components: whether the dependency is SaaS."},
+				{Name: "paying_customer", Type: "bool", Doc: "Third party dependency components: whether we are a paying customer."},
+				{Name: "open_source", Type: "bool", Doc: "Third party dependency components: whether the dependency is open source."},
+				{Name: "infrastructure", Type: "bool", Doc: "Third party dependency components: whether the dependency is infrastructure."},
+				{Name: "uptime_notes", Type: "string", Doc: "Third party dependency components: notes about the uptime dependency."},
+			},
+			Blocks: []BlockSchema{
+				controlAttributeBlock(),
+				riskBlock(),
+				controlBlock("control", "Threat components: a control mitigating this threat."),
 			},
-			Blocks: []BlockSchema{controlAttributeBlock()},
 		},
 	}
 }
@@ -387,9 +456,34 @@ func variableBlock() BlockSchema {
 		Labels:     []string{"variable_name"},
 		Doc:        "A reusable variable referenced as var.NAME.",
 		Repeatable: true,
-		Body: BodySchema{Attrs: []AttrSchema{
-			{Name: "value", Required: true, Type: "string", Doc: "The variable's value."},
-		}},
+		Body: BodySchema{
+			Attrs: []AttrSchema{
+				{Name: "value", Type: "string", Doc: "The variable's value. Can be overridden by the parser; use default for non-string values."},
+				{Name: "default", Type: "any", Doc: "The variable's default value, used unless the parser is given another."},
+				{Name: "type", Type: "type expression or string", Doc: "The type the value is converted to: a bare type expression such as number, list(string) or object({...}), or one of the quoted types \"string\", \"number\", \"bool\", \"list\", \"list(string)\", \"list(number)\" or \"list(bool)\"."},
+				{Name: "description", Type: "string", Doc: "What the variable is for."},
+			},
+			Blocks: []BlockSchema{
+				{
+					Type:       "validation",
+					Doc:        "A condition the variable's value must meet.",
+					Repeatable: true,
+					Body: BodySchema{Attrs: []AttrSchema{
+						{Name: "condition", Required: true, Type: "bool", Doc: "An expression, usually referring to var.NAME, that must be true."},
+						{Name: "error_message", Required: true, Type: "string", Doc: "The error reported when condition is false."},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func localsBlock() BlockSchema {
+	return BlockSchema{
+		Type:       "locals",
+		Doc:        "Named values computed once and referenced as local.NAME. A local can refer to var.*, import.* and other locals.",
+		Repeatable: true,
+		Body:       BodySchema{AnyAttrs: true},
 	}
 }
 
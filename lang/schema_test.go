@@ -92,6 +92,12 @@ func reflectBody(t reflect.Type) BodySchema {
 		case "label":
 			// Labels belong to the parent block header, gathered separately.
 			continue
+		case "remain":
+			// The body's leftover attributes, which may have any name.
+			bs.AnyAttrs = true
+		case "def_range", "body":
+			// Filled in by the decoder; not part of the document.
+			continue
 		case "block":
 			et := elemStruct(f.Type)
 			bs.Blocks = append(bs.Blocks, BlockSchema{
@@ -145,6 +151,10 @@ func elemStruct(t reflect.Type) reflect.Type {
 func diffBody(path string, ref, got BodySchema) []string {
 	var diffs []string
 
+	if ref.AnyAttrs != got.AnyAttrs {
+		diffs = append(diffs, path+": any attrs mismatch (structs="+b2s(ref.AnyAttrs)+" schema="+b2s(got.AnyAttrs)+")")
+	}
+
 	refAttr := indexAttrs(ref.Attrs)
 	gotAttr := indexAttrs(got.Attrs)
 	for name, ra := range refAttr {
@@ -158,6 +168,10 @@ func diffBody(path string, ref, got BodySchema) []string {
 		}
 	}
 	for name := range gotAttr {
+		if metaArguments[name] {
+			// Meta-arguments are handled by the parser, not decoded
+			continue
+		}
 		if _, ok := refAttr[name]; !ok {
 			diffs = append(diffs, path+": attr "+name+" is in Schema() but has no struct tag")
 		}
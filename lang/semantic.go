@@ -0,0 +1,297 @@
+package lang
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// semanticDiags reproduces the spec parser's ValidateTm checks (duplicate
+// names, information_asset references, DFD flow wiring and trust_zone
+// mismatches) directly against the AST, so each one points at the offending
+// label or value.
+//
+// Nothing is evaluated or fetched, so a check is skipped wherever its answer
+// depends on something that isn't in the file: names from a for_each, blocks
+// whose enabled isn't a literal, information_assets that may come from
+// including or information_asset_imports, and diagrams with an import.
+func semanticDiags(body *hclsyntax.Body) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	tms := newNameSet()
+	for _, blk := range body.Blocks {
+		if blk.Type != "threatmodel" || len(blk.Labels) == 0 {
+			continue
+		}
+
+		if tms.add(blk, true) {
+			diags = append(diags, labelDiag(blk, "Duplicate threatmodel",
+				fmt.Sprintf("TM '%s': duplicate found", blk.Labels[0])))
+		}
+
+		diags = append(diags, threatmodelDiags(blk)...)
+	}
+
+	return diags
+}
+
+func threatmodelDiags(tm *hclsyntax.Block) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	tmName := tm.Labels[0]
+
+	// Information assets may also come from elsewhere, in which case a
+	// reference to one that isn't in this file may still be valid
+	_, including := tm.Body.Attributes["including"]
+	_, imported := tm.Body.Attributes["information_asset_imports"]
+	assets := newNameSet()
+	assets.dynamic = including || imported
+
+	for _, blk := range tm.Body.Blocks {
+		if blk.Type != "information_asset" || len(blk.Labels) == 0 {
+			continue
+		}
+
+		if hasAttr(blk, "for_each") {
+			assets.dynamic = true
+			continue
+		}
+
+		if assets.add(blk, true) {
+			diags = append(diags, labelDiag(blk, "Duplicate information_asset",
+				fmt.Sprintf("TM '%s': duplicate information_asset '%s'", tmName, blk.Labels[0])))
+		}
+	}
+
+	for _, blk := range tm.Body.Blocks {
+		switch blk.Type {
+		case "threat":
+			if enabled, _ := blockEnabled(blk); !enabled {
+				continue
+			}
+
+			attr, ok := blk.Body.Attributes["information_asset_refs"]
+			if !ok {
+				continue
+			}
+
+			elems, listDiags := hcl.ExprList(attr.Expr)
+			if listDiags.HasErrors() {
+				continue
+			}
+			for _, el := range elems {
+				if ref, ok := stringValue(el); ok && !assets.has(ref) {
+					diags = append(diags, unknownAssetDiag(ref, el.Range()))
+				}
+			}
+		case "data_flow_diagram_v2", "data_flow_diagram":
+			diags = append(diags, dfdDiags(tmName, blk, assets)...)
+		}
+	}
+
+	return diags
+}
+
+// dfdDiags checks a data flow diagram's element names, trust zones and flows
+func dfdDiags(tmName string, dfd *hclsyntax.Block, assets *nameSet) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	elements := newNameSet()
+	_, elements.dynamic = dfd.Body.Attributes["import"]
+
+	checkElement := func(blk *hclsyntax.Block, zone *hclsyntax.Block) {
+		enabled, certain := blockEnabled(blk)
+		if !enabled {
+			return
+		}
+
+		if hasAttr(blk, "for_each") {
+			elements.dynamic = true
+			return
+		}
+
+		if elements.add(blk, certain) {
+			diags = append(diags, labelDiag(blk, fmt.Sprintf("Duplicate %s", blk.Type),
+				fmt.Sprintf("TM '%s': duplicate %s found in dfd '%s'", tmName, blk.Type, blk.Labels[0])))
+		}
+
+		if zone != nil {
+			if attr, ok := blk.Body.Attributes["trust_zone"]; ok {
+				if tz, ok := stringValue(attr.Expr); ok && tz != "" && tz != zone.Labels[0] {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Trust zone mismatch",
+						Detail:   fmt.Sprintf("TM '%s': %s trust_zone mis-match found in '%s'", tmName, blk.Type, blk.Labels[0]),
+						Subject:  attr.Expr.Range().Ptr(),
+					})
+				}
+			}
+		}
+
+		if blk.Type == "data_store" {
+			if attr, ok := blk.Body.Attributes["information_asset"]; ok {
+				if ref, ok := stringValue(attr.Expr); ok && ref != "" && !assets.has(ref) {
+					diags = append(diags, unknownAssetDiag(ref, attr.Expr.Range()))
+				}
+			}
+		}
+	}
+
+	zones := newNameSet()
+	for _, blk := range dfd.Body.Blocks {
+		if len(blk.Labels) == 0 {
+			continue
+		}
+
+		switch blk.Type {
+		case "process", "external_element", "data_store":
+			checkElement(blk, nil)
+		case "trust_zone":
+			if zones.add(blk, true) {
+				diags = append(diags, labelDiag(blk, "Duplicate trust_zone",
+					fmt.Sprintf("TM '%s': duplicate trust_zone block found '%s'", tmName, blk.Labels[0])))
+			}
+
+			for _, inner := range blk.Body.Blocks {
+				if len(inner.Labels) > 0 {
+					checkElement(inner, blk)
+				}
+			}
+		}
+	}
+
+	flows := newNameSet()
+	for _, blk := range dfd.Body.Blocks {
+		if blk.Type != "flow" || len(blk.Labels) == 0 {
+			continue
+		}
+
+		enabled, certain := blockEnabled(blk)
+		if !enabled || hasAttr(blk, "for_each") {
+			continue
+		}
+
+		from, fromOK := attrString(blk, "from")
+		to, toOK := attrString(blk, "to")
+		if !fromOK || !toOK {
+			continue
+		}
+		edge := fmt.Sprintf("%s:%s", from, to)
+
+		// Flows are unique by their from, to and name
+		key := fmt.Sprintf("%s:%s", edge, blk.Labels[0])
+		if flows.addName(key, certain) {
+			diags = append(diags, labelDiag(blk, "Duplicate flow",
+				fmt.Sprintf("TM '%s': duplicate flow found in dfd '%s' with name '%s'", tmName, edge, blk.Labels[0])))
+		}
+
+		if !elements.has(from) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid flow from",
+				Detail:   fmt.Sprintf("TM '%s': invalid from connection for flow '%s'", tmName, edge),
+				Subject:  blk.Body.Attributes["from"].Expr.Range().Ptr(),
+			})
+		}
+
+		if !elements.has(to) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid flow to",
+				Detail:   fmt.Sprintf("TM '%s': invalid to connection for flow '%s'", tmName, edge),
+				Subject:  blk.Body.Attributes["to"].Expr.Range().Ptr(),
+			})
+		}
+
+		if from == to {
+			diags = append(diags, labelDiag(blk, "Flow connects to itself",
+				fmt.Sprintf("TM '%s': flow can't connect to itself '%s'", tmName, edge)))
+		}
+	}
+
+	return diags
+}
+
+// nameSet tracks the names of one kind of block. A dynamic set may have names
+// that aren't known statically, so has accepts any name.
+type nameSet struct {
+	names   map[string]bool
+	dynamic bool
+}
+
+func newNameSet() *nameSet {
+	return &nameSet{names: make(map[string]bool)}
+}
+
+// add adds blk's first label, reporting whether it's a duplicate. A block
+// that isn't certain to be in the model (see blockEnabled) is never reported.
+func (s *nameSet) add(blk *hclsyntax.Block, certain bool) bool {
+	return s.addName(blk.Labels[0], certain)
+}
+
+func (s *nameSet) addName(name string, certain bool) bool {
+	seen, ok := s.names[name]
+	if certain {
+		s.names[name] = true
+	} else if !ok {
+		s.names[name] = false
+	}
+
+	return certain && seen
+}
+
+func (s *nameSet) has(name string) bool {
+	_, ok := s.names[name]
+	return ok || s.dynamic
+}
+
+// blockEnabled reports whether blk may be in the parsed model, and whether
+// that's certain. A block whose enabled is a literal false is dropped, and
+// one whose enabled is anything other than a literal may or may not be.
+func blockEnabled(blk *hclsyntax.Block) (enabled, certain bool) {
+	attr, ok := blk.Body.Attributes["enabled"]
+	if !ok {
+		return true, true
+	}
+
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || v.IsNull() || !v.IsKnown() || !v.Type().Equals(cty.Bool) {
+		return true, false
+	}
+
+	return v.True(), true
+}
+
+func hasAttr(blk *hclsyntax.Block, name string) bool {
+	_, ok := blk.Body.Attributes[name]
+	return ok
+}
+
+// attrString returns the literal string value of blk's named attribute
+func attrString(blk *hclsyntax.Block, name string) (string, bool) {
+	attr, ok := blk.Body.Attributes[name]
+	if !ok {
+		return "", false
+	}
+
+	return stringValue(attr.Expr)
+}
+
+func labelDiag(blk *hclsyntax.Block, summary, detail string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   detail,
+		Subject:  blk.LabelRanges[0].Ptr(),
+	}
+}
+
+func unknownAssetDiag(ref string, rng hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Unknown information_asset",
+		Detail:   fmt.Sprintf("trying to refer to non-existent information_asset '%s'", ref),
+		Subject:  rng.Ptr(),
+	}
+}
@@ -0,0 +1,40 @@
+spec_version = "0.3.0"
+
+threatmodel "Semantic" {
+  author = "xntrik"
+
+  information_asset "creds" {}
+  information_asset "creds" {}
+
+  threat "phishing" {
+    description            = "An attacker phishes a user"
+    information_asset_refs = ["creds", "missing"]
+  }
+
+  data_flow_diagram_v2 "main" {
+    process "web" {}
+    data_store "web" {
+      information_asset = "nope"
+    }
+
+    trust_zone "edge" {
+      external_element "user" {
+        trust_zone = "core"
+      }
+    }
+
+    flow "https" {
+      from = "user"
+      to   = "ghost"
+    }
+
+    flow "loop" {
+      from = "web"
+      to   = "web"
+    }
+  }
+}
+
+threatmodel "Semantic" {
+  author = "xntrik"
+}
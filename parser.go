@@ -2,11 +2,14 @@ package spec
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/hashicorp/go-multierror"
@@ -16,7 +19,10 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
-type ThreatmodelParser struct {
+// parserConfig is what a parser is configured with: the spec config, and the
+// enums built from it. It's only read while parsing, so it's shared by every
+// parse, and by the sub-parsers for fetched sources.
+type parserConfig struct {
 	initiativeSizeOptions          map[string]bool
 	defaultInitiativeSize          string
 	infoClassifications            map[string]bool
@@ -27,12 +33,11 @@ type ThreatmodelParser struct {
 	uptimeDepClassification        map[string]bool
 	defaultUptimeDepClassification UptimeDependencyClassification
 	defaultInfoClassification      string
-	wrapped                        *ThreatmodelWrapped
 	specCfg                        *ThreatmodelSpecConfig
 }
 
-func NewThreatmodelParser(cfg *ThreatmodelSpecConfig) *ThreatmodelParser {
-	tmParser := &ThreatmodelParser{
+func newParserConfig(cfg *ThreatmodelSpecConfig) *parserConfig {
+	c := &parserConfig{
 		initiativeSizeOptions:   map[string]bool{},
 		infoClassifications:     map[string]bool{},
 		impactTypes:             map[string]bool{},
@@ -40,24 +45,102 @@ func NewThreatmodelParser(cfg *ThreatmodelSpecConfig) *ThreatmodelParser {
 		riskLevels:              map[string]bool{},
 		severityLevels:          map[string]bool{},
 		uptimeDepClassification: map[string]bool{},
-		wrapped:                 &ThreatmodelWrapped{},
 		specCfg:                 cfg,
 	}
-	tmParser.populateInitiativeSizeOptions()
-	tmParser.populateInfoClassifications()
-	tmParser.populateImpactTypes()
-	tmParser.populateStrideElements()
-	tmParser.populateRiskLevels()
-	tmParser.populateSeverityLevels()
-	tmParser.populateUptimeDepClassifications()
+	c.populateInitiativeSizeOptions()
+	c.populateInfoClassifications()
+	c.populateImpactTypes()
+	c.populateStrideElements()
+	c.populateRiskLevels()
+	c.populateSeverityLevels()
+	c.populateUptimeDepClassifications()
+	return c
+}
+
+// ThreatmodelParser parses threat model files. Every Parse* call parses with a
+// parser of its own that shares only this one's configuration, so once
+// configured a parser can be shared between goroutines and reused for any
+// number of parses. Configure it with its Set* methods before sharing it.
+//
+// Parse and ParseRaw return each call's results as a ParseResult. The other
+// Parse* methods (ParseFile, ParseDir and so on) instead replace the parser's
+// own results with their call's, which GetWrapped, Warnings, DroppedBlocks and
+// IncludeConflicts then return. Those results don't accumulate across
+// calls: to parse several files into one wrapped model, use ParseFiles.
+type ThreatmodelParser struct {
+	*parserConfig
+	resultsMu            sync.RWMutex
+	wrapped              *ThreatmodelWrapped
+	cacheDir             string
+	offline              bool
+	lock                 *lockFile
+	lockSource           string
+	maxIncludeDepth      int
+	includeMergeStrategy IncludeMergeStrategy
+	includeConflicts     []IncludeConflict
+	componentImports     map[string]map[string]*Component
+	varOverrides         map[string]string
+	varEnv               map[string]string
+	varFile              map[string]cty.Value
+	varFilename          string
+	forEachSources       map[string][]byte
+	forEachInstances     map[string]string
+	droppedBlocks        []DroppedBlock
+	warnings             []Warning
+	strict               bool
+	sourceFS             fs.FS
+	resolver             SourceResolver
+	fetchTimeout         time.Duration
+	fetchConcurrency     int
+	fetches              *fetchSession
+}
+
+func NewThreatmodelParser(cfg *ThreatmodelSpecConfig) *ThreatmodelParser {
+	tmParser := newParser(newParserConfig(cfg))
+	tmParser.strict = cfg.Strict
 	return tmParser
 }
 
+// newParser returns a parser with no results yet, using the configuration c
+func newParser(c *parserConfig) *ThreatmodelParser {
+	return &ThreatmodelParser{
+		parserConfig:         c,
+		wrapped:              &ThreatmodelWrapped{},
+		maxIncludeDepth:      DefaultMaxIncludeDepth,
+		includeMergeStrategy: MergeKeepParent,
+		forEachSources:       map[string][]byte{},
+		forEachInstances:     map[string]string{},
+		fetchConcurrency:     DefaultFetchConcurrency,
+	}
+}
+
+// GetWrapped returns the threat models from the parser's latest Parse* call
+// (other than Parse and ParseRaw, which return their own)
 func (p *ThreatmodelParser) GetWrapped() *ThreatmodelWrapped {
+	p.resultsMu.RLock()
+	defer p.resultsMu.RUnlock()
+
 	return p.wrapped
 }
 
+// HclStringOptions configures HclStringWithOptions. The zero value gives the
+// same output as HclString.
+type HclStringOptions struct {
+	// Compact writes blocks that were expanded from a for_each back out as
+	// the original for_each block, along with any locals it may refer to,
+	// instead of as one block per instance. Changes made to the instances
+	// after parsing, such as merged includes, aren't reflected.
+	Compact bool
+}
+
 func (p *ThreatmodelParser) HclString() string {
+	return p.HclStringWithOptions(HclStringOptions{})
+}
+
+func (p *ThreatmodelParser) HclStringWithOptions(opts HclStringOptions) string {
+	p.resultsMu.Lock()
+	defer p.resultsMu.Unlock()
+
 	for _, tm := range p.wrapped.Threatmodels {
 		for _, threat := range tm.Threats {
 			threat.ControlImports = nil
@@ -68,7 +151,17 @@ func (p *ThreatmodelParser) HclString() string {
 			threat.ExpandedControls = nil
 		}
 	}
-	return string(encodeWrappedToHCL(p.wrapped))
+
+	if !opts.Compact {
+		return string(encodeWrappedToHCL(p.wrapped))
+	}
+
+	e := &hclEncoder{
+		compact:          true,
+		forEachSources:   p.forEachSources,
+		forEachInstances: p.forEachInstances,
+	}
+	return string(e.encode(p.wrapped))
 }
 
 func (p *ThreatmodelParser) AddTMAndWrite(tm Threatmodel, f io.Writer, debug bool) error {
@@ -77,6 +170,9 @@ func (p *ThreatmodelParser) AddTMAndWrite(tm Threatmodel, f io.Writer, debug boo
 		spew.Dump(tm)
 	}
 
+	p.resultsMu.Lock()
+	defer p.resultsMu.Unlock()
+
 	if p.wrapped.SpecVersion == "" {
 		// We haven't yet set the SpecVersion for this model, which may mean that we're adding a new TM to an existing wrapped object. Let's set it from the loaded CFG
 		p.wrapped.SpecVersion = p.specCfg.Version
@@ -103,9 +199,16 @@ func (p *ThreatmodelParser) validateTms() error {
 	for _, t := range p.wrapped.Threatmodels {
 		_, err := t.shiftLegacyDfd()
 		if err != nil {
-			errMap = multierror.Append(errMap, fmt.Errorf(
+			errMap = multierror.Append(errMap, t.validationError(
+				CodeInvalidLegacyDfd, blockPath("", "data_flow_diagram", nil), t.DefRange,
 				"TM '%s': error shifting legacy DFD: %s", t.Name, err))
 		}
+		err = t.shiftIncluding()
+		if err != nil {
+			errMap = multierror.Append(errMap, t.validationError(
+				CodeInvalidIncluding, "", t.DefRange,
+				"TM '%s': %s", t.Name, err))
+		}
 		// fmt.Printf("We did a shift: %d\n", shiftedCount)
 		newWrapped = append(newWrapped, t)
 	}
@@ -115,7 +218,8 @@ func (p *ThreatmodelParser) validateTms() error {
 	for _, t := range p.wrapped.Threatmodels {
 		// Validating unique threatmodel name
 		if _, ok := tmMap[t.Name]; ok {
-			errMap = multierror.Append(errMap, fmt.Errorf(
+			errMap = multierror.Append(errMap, t.validationError(
+				CodeDuplicateThreatmodel, "", t.DefRange,
 				"TM '%s': duplicate found",
 				t.Name,
 			))
@@ -166,80 +270,20 @@ func (p *ThreatmodelParser) validateBackend() error {
 	return nil
 }
 
+// validateSpec records a warning if filename doesn't have a spec_version
 func (p *ThreatmodelParser) validateSpec(filename string) {
-	// @TODO: This has been edited to not print to STDOUT - it should be wrapped in a DEBUG flag
-
 	// Check the version in the file against the current config
 	if p.wrapped.SpecVersion != "" {
 		if p.wrapped.SpecVersion != p.specCfg.Version {
-			// fmt.Fprintf(os.Stdout, "%s: Provided version ('%s') doesn't match the hcltm version ('%s')\n", filename, p.wrapped.SpecVersion, p.specCfg.Version)
+			// @TODO: When we tidy up spec versioning, warn that the provided
+			// version doesn't match the hcltm version
 		}
 	} else {
-		fmt.Fprintf(os.Stdout, "%s: No provided version. The current hcltm version is '%s'\n", filename, p.specCfg.Version)
+		p.warn(WarningDeprecated, "", hcl.Range{}, "%s: No provided version. The current hcltm version is '%s'", filename, p.specCfg.Version)
 	}
 
 }
 
-// extractVars does a shallow parsing of an HCL file looking for
-// 'variable' blocks
-func extractVars(f *hcl.File) (map[string]string, error) {
-	output := make(map[string]string)
-	var errMap error
-
-	extract, _, diags := f.Body.PartialContent(&hcl.BodySchema{
-		Blocks: []hcl.BlockHeaderSchema{
-			{
-				Type:       "variable",
-				LabelNames: []string{"name"},
-			},
-		},
-	})
-
-	if diags.HasErrors() {
-		return output, diags
-	}
-
-	for _, b := range extract.Blocks {
-		attributeExtract, _, _ := b.Body.PartialContent(&hcl.BodySchema{
-			Attributes: []hcl.AttributeSchema{
-				{
-					Name: "value",
-				},
-			},
-		})
-
-		if attr, exist := attributeExtract.Attributes["value"]; exist {
-			value_extract := ""
-			attrDiags := gohcl.DecodeExpression(attr.Expr, nil, &value_extract)
-			if attrDiags.HasErrors() {
-				errMap = multierror.Append(errMap, attrDiags)
-			} else {
-				if len(value_extract) > 0 && len(b.Labels) > 0 {
-					output[b.Labels[0]] = value_extract
-				}
-			}
-		}
-	}
-
-	return output, nil
-
-}
-
-func (p *ThreatmodelParser) buildVarCtx(ctx *hcl.EvalContext, varMap map[string]string) error {
-
-	// var varMapOut map[string]cty.Value
-	varMapOut := make(map[string]cty.Value)
-
-	for k, v := range varMap {
-		varMapOut[k] = cty.StringVal(v)
-	}
-
-	ctx.Variables["var"] = cty.ObjectVal(varMapOut)
-
-	return nil
-
-}
-
 // extractImports does a shallow parsing of an HCL file looking for
 // 'threatmodel' blocks that include 'imports' attributes
 func extractImports(f *hcl.File) ([]string, error) {
@@ -293,14 +337,29 @@ func extractImports(f *hcl.File) ([]string, error) {
 	return output, errMap
 }
 
-func (p *ThreatmodelParser) buildCtx(ctx *hcl.EvalContext, imports []string, parentfilename string) error {
+func (p *ThreatmodelParser) buildCtx(ctx context.Context, evalCtx *hcl.EvalContext, imports []string, parentfilename string) error {
 	var controls map[string]cty.Value
 	var expandedControls map[string]cty.Value
 	controls = make(map[string]cty.Value)
 	expandedControls = make(map[string]cty.Value)
 
+	// Components of any other type are under import.TYPE.NAME, so that
+	// import.control only ever refers to controls
+	otherComponents := make(map[string]map[string]cty.Value)
+
+	p.componentImports = make(map[string]map[string]*Component)
+	for _, componentType := range libraryComponentTypes {
+		p.componentImports[componentType] = make(map[string]*Component)
+	}
+
+	baseDir, err := modelBaseDir(parentfilename)
+	if err != nil {
+		return err
+	}
+	p.prefetch(imports, baseDir)
+
 	for _, i := range imports {
-		importTmp, err := fetchRemoteTm(p.specCfg, i, parentfilename)
+		importTmp, _, err := p.fetchRemoteTm(ctx, i, parentfilename)
 		if err != nil {
 			return err
 		}
@@ -361,27 +420,55 @@ func (p *ThreatmodelParser) buildCtx(ctx *hcl.EvalContext, imports []string, par
 				}
 
 				expandedControls[c.ComponentName] = cty.ObjectVal(controlObj)
+			} else if library, ok := p.componentImports[c.ComponentType]; ok {
+				// Library components are available whole, for the
+				// threatmodel's *_imports attributes
+				library[c.ComponentName] = c
 			} else {
 				// For other component types, only description is available
-				controls[c.ComponentName] = cty.ObjectVal(controlObj)
+				if otherComponents[c.ComponentType] == nil {
+					otherComponents[c.ComponentType] = make(map[string]cty.Value)
+				}
+				otherComponents[c.ComponentType][c.ComponentName] = cty.ObjectVal(controlObj)
 			}
 		}
 	}
 
-	// Create the import object with both control types
-	ctx.Variables["import"] = cty.ObjectVal(map[string]cty.Value{
+	// Create the import object with both control types, and each type of
+	// library component
+	importObj := map[string]cty.Value{
 		"control":          cty.ObjectVal(controls),
 		"expanded_control": cty.ObjectVal(expandedControls),
-	})
+	}
+
+	for componentType, library := range p.componentImports {
+		components := make(map[string]cty.Value)
+		for name, c := range library {
+			components[name] = componentCtyVal(c)
+		}
+		importObj[componentType] = cty.ObjectVal(components)
+	}
+
+	for componentType, components := range otherComponents {
+		importObj[componentType] = cty.ObjectVal(components)
+	}
+
+	evalCtx.Variables["import"] = cty.ObjectVal(importObj)
 
 	return nil
 }
 
 // parseHCL actually does the parsing - called by either ParseHCLFile or ParseHCLRaw
-func (p *ThreatmodelParser) parseHCL(f *hcl.File, filename string, isChild bool) error {
+func (p *ThreatmodelParser) parseHCL(ctx context.Context, f *hcl.File, sources sourceFiles, filename string, isChild bool) error {
+
+	baseDir, err := modelBaseDir(filename)
+	if err != nil {
+		return err
+	}
 
-	ctx := &hcl.EvalContext{}
-	ctx.Variables = map[string]cty.Value{}
+	evalCtx := &hcl.EvalContext{}
+	evalCtx.Variables = map[string]cty.Value{}
+	evalCtx.Functions = hclFunctions(baseDir, p.sourceFS)
 
 	// @TODO while imports should only be in the parent, variables can be in sub files?
 	if !isChild {
@@ -394,10 +481,10 @@ func (p *ThreatmodelParser) parseHCL(f *hcl.File, filename string, isChild bool)
 		// if we have imports we need to build EvalContext for them
 		if len(imports) > 0 {
 			if filename == "STDIN" {
-				fmt.Printf("Warning: STDIN processing of hcltm files doesn't handle imports, and we've detected an import\n")
+				p.warn(WarningUnsupported, "", hcl.Range{}, "STDIN processing of hcltm files doesn't handle imports, and we've detected an import. Use ParseHCLRawWithOptions to set the directory they're resolved from")
 			}
 
-			err = p.buildCtx(ctx, imports, filename)
+			err = p.buildCtx(ctx, evalCtx, imports, filename)
 
 			if err != nil {
 				return err
@@ -405,14 +492,14 @@ func (p *ThreatmodelParser) parseHCL(f *hcl.File, filename string, isChild bool)
 		}
 
 		// extract any variables from this hcl file
-		varMap, err := extractVars(f)
+		varMap, err := p.extractVars(f, evalCtx.Functions)
 		if err != nil {
 			return err
 		}
 
 		if len(varMap) > 0 {
 
-			err = p.buildVarCtx(ctx, varMap)
+			err = p.buildVarCtx(evalCtx, varMap)
 
 			if err != nil {
 				return err
@@ -420,19 +507,50 @@ func (p *ThreatmodelParser) parseHCL(f *hcl.File, filename string, isChild bool)
 		}
 	}
 
+	// extract any locals from this hcl file, which may refer to the
+	// variables and imports above
+	localMap, err := extractLocals(f, evalCtx)
+	if err != nil {
+		return err
+	}
+
+	if len(localMap) > 0 {
+		err = p.buildLocalCtx(evalCtx, localMap)
+		if err != nil {
+			return err
+		}
+	}
+
 	// var diags hcl.Diagnostics
 
-	diags := gohcl.DecodeBody(f.Body, ctx, p.wrapped)
+	// for_each blocks are expanded as they're decoded
+	body := newForEachBody(f, sources, evalCtx)
+	diags := gohcl.DecodeBody(body, evalCtx, p.wrapped)
 
 	if diags.HasErrors() {
 		return diags
 	}
 
-	// @TODO: This has been commented out to not print to STDOUT - it should be wrapped in a DEBUG flag
-	// p.validateSpec(filename)
+	p.recordSources(sources)
+	for path, src := range body.exp.origins {
+		p.forEachSources[path] = src
+	}
+	for path, origin := range body.exp.instances {
+		p.forEachInstances[path] = origin
+	}
+	sortDroppedBlocks(body.exp.dropped, f)
+	p.droppedBlocks = append(p.droppedBlocks, body.exp.dropped...)
+
+	p.validateSpec(filename)
+	p.warnDeprecations()
 
 	// Process control imports after parsing
-	err := p.processControlImports(ctx)
+	err = p.processControlImports(evalCtx)
+	if err != nil {
+		return err
+	}
+
+	err = p.processComponentImports()
 	if err != nil {
 		return err
 	}
@@ -442,6 +560,11 @@ func (p *ThreatmodelParser) parseHCL(f *hcl.File, filename string, isChild bool)
 		return err
 	}
 
+	err = p.validateComponents()
+	if err != nil {
+		return err
+	}
+
 	err = p.validateTms()
 	if err != nil {
 		return err
@@ -519,6 +642,10 @@ func (p *ThreatmodelParser) resolveControlImport(controlImport string, ctx *hcl.
 		}
 	}
 
+	if !controlsVal.Type().HasAttribute(controlName) {
+		return nil, fmt.Errorf("control '%s' not found in imports", controlName)
+	}
+
 	controlVal := controlsVal.GetAttr(controlName)
 	if controlVal.IsNull() {
 		return nil, fmt.Errorf("control '%s' not found in imports", controlName)
@@ -570,14 +697,29 @@ func (p *ThreatmodelParser) resolveControlImport(controlImport string, ctx *hcl.
 // ParseFile parses a single Threatmodel file, and will account for either
 // JSON or HCL (this is a wrapper sort of for the two different methods)
 func (p *ThreatmodelParser) ParseFile(filename string, isChild bool) error {
+	return p.ParseFileContext(context.Background(), filename, isChild)
+}
+
+// ParseFileContext is ParseFile, where ctx cancels fetching any imports and
+// including sources
+func (p *ThreatmodelParser) ParseFileContext(ctx context.Context, filename string, isChild bool) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseFile(ctx, filename, isChild)
+	})
+}
+
+func (p *ThreatmodelParser) parseFile(ctx context.Context, filename string, isChild bool) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
 	var err error
 	if filepath.Ext(filename) == ".hcl" {
-		err = p.ParseHCLFile(filename, isChild)
+		err = p.parseHCLFile(ctx, filename, isChild)
 		if err != nil {
 			return err
 		}
 	} else if filepath.Ext(filename) == ".json" {
-		err = p.ParseJSONFile(filename, isChild)
+		err = p.parseJSONFile(ctx, filename, isChild)
 		if err != nil {
 			return err
 		}
@@ -585,22 +727,53 @@ func (p *ThreatmodelParser) ParseFile(filename string, isChild bool) error {
 		return fmt.Errorf("file isn't HCL or JSON")
 	}
 
+	return p.includeAll(ctx, filename)
+
+}
+
+// includeAll merges the including source of every parsed threat model,
+// resolving relative sources against filename
+func (p *ThreatmodelParser) includeAll(ctx context.Context, filename string) error {
+	baseDir, err := modelBaseDir(filename)
+	if err != nil {
+		return err
+	}
+
+	sources := []string{}
+	for _, w := range p.wrapped.Threatmodels {
+		sources = append(sources, w.includingSources()...)
+	}
+	p.prefetch(sources, baseDir)
+
 	for i := 0; i < len(p.wrapped.Threatmodels); i++ {
 		w := &p.wrapped.Threatmodels[i]
-		if w.Including != "" {
-			err = w.Include(p.specCfg, filename)
+		if len(w.includingSources()) > 0 {
+			err := w.include(ctx, p, filename)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	return err
-
+	return nil
 }
 
 // ParseHCLFile parses a single HCL Threatmodel file
 func (p *ThreatmodelParser) ParseHCLFile(filename string, isChild bool) error {
+	return p.ParseHCLFileContext(context.Background(), filename, isChild)
+}
+
+// ParseHCLFileContext is ParseHCLFile, where ctx cancels fetching any imports
+func (p *ThreatmodelParser) ParseHCLFileContext(ctx context.Context, filename string, isChild bool) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseHCLFile(ctx, filename, isChild)
+	})
+}
+
+func (p *ThreatmodelParser) parseHCLFile(ctx context.Context, filename string, isChild bool) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
 	parser := hclparse.NewParser()
 	f, diags := parser.ParseHCLFile(filename)
 
@@ -608,24 +781,48 @@ func (p *ThreatmodelParser) ParseHCLFile(filename string, isChild bool) error {
 		return diags
 	}
 
-	return p.parseHCL(f, filename, isChild)
+	return p.parseHCL(ctx, f, newSourceFiles(f), filename, isChild)
 }
 
 // ParseHCLRaw parses a byte slice into HCL Threatmodels
 // This is used for piping in STDIN
 func (p *ThreatmodelParser) ParseHCLRaw(input []byte) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseHCLBytes(context.Background(), input, "STDIN")
+	})
+}
+
+func (p *ThreatmodelParser) parseHCLBytes(ctx context.Context, input []byte, filename string) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
 	parser := hclparse.NewParser()
-	f, diags := parser.ParseHCL(input, "STDIN")
+	f, diags := parser.ParseHCL(input, filename)
 
 	if diags.HasErrors() {
 		return diags
 	}
 
-	return p.parseHCL(f, "STDIN", false)
+	return p.parseHCL(ctx, f, newSourceFiles(f), filename, false)
 }
 
 // ParseJSONFile parses a single JSON Threatmodel file
 func (p *ThreatmodelParser) ParseJSONFile(filename string, isChild bool) error {
+	return p.ParseJSONFileContext(context.Background(), filename, isChild)
+}
+
+// ParseJSONFileContext is ParseJSONFile, where ctx cancels fetching any
+// imports
+func (p *ThreatmodelParser) ParseJSONFileContext(ctx context.Context, filename string, isChild bool) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseJSONFile(ctx, filename, isChild)
+	})
+}
+
+func (p *ThreatmodelParser) parseJSONFile(ctx context.Context, filename string, isChild bool) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
 	parser := hclparse.NewParser()
 	f, diags := parser.ParseJSONFile(filename)
 
@@ -633,18 +830,27 @@ func (p *ThreatmodelParser) ParseJSONFile(filename string, isChild bool) error {
 		return diags
 	}
 
-	return p.parseHCL(f, filename, isChild)
+	return p.parseHCL(ctx, f, newSourceFiles(f), filename, isChild)
 }
 
 // ParseJSONRaw parses a byte slice into HCL Threatmodels from JSON
 // This is used for piping in STDIN
 func (p *ThreatmodelParser) ParseJSONRaw(input []byte) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseJSONBytes(context.Background(), input, "STDIN")
+	})
+}
+
+func (p *ThreatmodelParser) parseJSONBytes(ctx context.Context, input []byte, filename string) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
 	parser := hclparse.NewParser()
-	f, diags := parser.ParseJSON(input, "STDIN")
+	f, diags := parser.ParseJSON(input, filename)
 
 	if diags.HasErrors() {
 		return diags
 	}
 
-	return p.parseHCL(f, "STDIN", false)
+	return p.parseHCL(ctx, f, newSourceFiles(f), filename, false)
 }
@@ -0,0 +1,181 @@
+package spec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gg "github.com/hashicorp/go-getter"
+)
+
+// SetCacheDir enables the local source cache of the default SourceResolver
+// (see GetterResolver). Fetched `imports` and
+// `including` sources are stored under dir, keyed on the normalized source, so
+// repeated parses don't re-download them. An empty dir disables the cache.
+//
+// Remote sources (and any source with an explicit getter, such as
+// `file::./controls.hcl`) are served from the cache once present. Plain local
+// paths are always re-read, so edits to them are never hidden.
+func (p *ThreatmodelParser) SetCacheDir(dir string) {
+	p.cacheDir = dir
+}
+
+// SetOffline restricts the default SourceResolver to remote sources already
+// in the cache (see SetCacheDir). A remote source that hasn't been cached is
+// an error instead of a download. Plain local paths are still read as usual.
+func (p *ThreatmodelParser) SetOffline(offline bool) {
+	p.offline = offline
+}
+
+// newSubParser returns a parser for fetched threat models which shares p's
+// config, fetch settings and lock file
+func (p *ThreatmodelParser) newSubParser() *ThreatmodelParser {
+	sub := newParser(p.parserConfig)
+	sub.cacheDir = p.cacheDir
+	sub.offline = p.offline
+	sub.lock = p.lock
+	sub.maxIncludeDepth = p.maxIncludeDepth
+	sub.includeMergeStrategy = p.includeMergeStrategy
+	sub.strict = p.strict
+	sub.sourceFS = p.sourceFS
+	sub.resolver = p.resolver
+	sub.fetchTimeout = p.fetchTimeout
+	sub.fetchConcurrency = p.fetchConcurrency
+	sub.fetches = p.fetches
+	return sub
+}
+
+// cacheEntryLocks holds a *sync.Mutex for each cache entry directory that's
+// been fetched into
+var cacheEntryLocks sync.Map
+
+// cachedSource returns the cache entry directory holding the download of
+// getterSrc, fetching it first if needed. source is the full source as
+// written (including any |subpath), which is part of the cache key. If the
+// entry was refreshed, the content of includeFile within it is returned too.
+func (r *GetterResolver) cachedSource(ctx context.Context, source, getterSrc, includeFile, pwd string) (string, []byte, error) {
+	key, local, err := sourceCacheKey(source, pwd)
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry := filepath.Join(r.CacheDir, key)
+
+	// Concurrent parses may fetch the same source at once, so only one of
+	// them checks and refreshes the entry at a time
+	mu, _ := cacheEntryLocks.LoadOrStore(entry, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	_, err = os.Stat(entry)
+	cached := err == nil
+
+	if r.Offline && !local {
+		if !cached {
+			return "", nil, fmt.Errorf("can't fetch '%s' in offline mode: it isn't in the cache at '%s'", source, r.CacheDir)
+		}
+		return entry, nil, nil
+	}
+
+	if cached && !local {
+		return entry, nil, nil
+	}
+
+	err = os.MkdirAll(r.CacheDir, 0o755)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Download next to the entry then swap it in, so an interrupted fetch
+	// never leaves a partial entry behind
+	tmpDir, err := os.MkdirTemp(r.CacheDir, ".fetch-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Local sources are copied rather than symlinked, so the entry still
+	// resolves once the original is gone
+	dst := filepath.Join(tmpDir, "src")
+	err = getSource(ctx, getterSrc, dst, pwd, true)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = os.RemoveAll(entry)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = os.Rename(dst, entry)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Local entries are replaced on every fetch, possibly by a concurrent
+	// parse, so the file is read now rather than after the entry is unlocked.
+	// If it can't be read, that's left to the parser to report.
+	content, err := os.ReadFile(filepath.Join(entry, includeFile))
+	if err != nil {
+		return entry, nil, nil
+	}
+
+	return entry, content, nil
+}
+
+// sourceCacheKey hashes the normalized source (see normalizeSource). local
+// reports whether the source is a plain local path rather than a remote or
+// explicitly forced one.
+func sourceCacheKey(source, pwd string) (key string, local bool, err error) {
+	normalized, err := normalizeSource(source, pwd)
+	if err != nil {
+		return "", false, err
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+
+	local = !strings.Contains(strings.SplitN(source, "|", 2)[0], "::") && isLocalSource(normalized)
+
+	return hex.EncodeToString(sum[:]), local, nil
+}
+
+// normalizeSource runs source through go-getter's detectors (so relative paths
+// become absolute, and shorthand like github.com/org/repo becomes its git URL),
+// keeping any |subpath
+func normalizeSource(source, pwd string) (string, error) {
+	splitSource := strings.SplitN(source, "|", 2)
+
+	detected, err := gg.Detect(splitSource[0], pwd, gg.Detectors)
+	if err != nil {
+		return "", err
+	}
+
+	if len(splitSource) == 2 {
+		return fmt.Sprintf("%s|%s", detected, filepath.Clean(splitSource[1])), nil
+	}
+
+	return detected, nil
+}
+
+// isLocalSource reports whether a normalized source refers to the local
+// filesystem
+func isLocalSource(normalized string) bool {
+	return strings.HasPrefix(normalized, "file://") || strings.HasPrefix(normalized, "file::")
+}
+
+// localSourcePath returns the filesystem path of a normalized local source
+func localSourcePath(normalized string) string {
+	splitSource := strings.SplitN(strings.TrimPrefix(normalized, "file::"), "|", 2)
+
+	path := filepath.FromSlash(strings.TrimPrefix(splitSource[0], "file://"))
+	if len(splitSource) == 2 {
+		path = filepath.Join(path, splitSource[1])
+	}
+
+	return path
+}
@@ -0,0 +1,296 @@
+package spec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const cacheTestTm = `spec_version = "0.1.17"
+
+threatmodel "cached" {
+  author = "@xntrik"
+  imports = ["%s"]
+
+  threat "test_threat" {
+    description = "words"
+    control = import.control.control_name.description
+  }
+}
+`
+
+const cacheTestControls = `spec_version = "0.4.0"
+
+component "control" "control_name" {
+  description = "%s"
+}
+`
+
+// writeCacheTestFiles writes a threat model importing source, and the
+// controls file it refers to, into a new temporary directory
+func writeCacheTestFiles(t *testing.T, source, controlDesc string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "tm.hcl"), []byte(fmt.Sprintf(cacheTestTm, source)), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing tm: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "controls.hcl"), []byte(fmt.Sprintf(cacheTestControls, controlDesc)), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing controls: %s", err)
+	}
+
+	return dir
+}
+
+func cachedControl(t *testing.T, tmParser *ThreatmodelParser) string {
+	t.Helper()
+
+	tms := tmParser.GetWrapped().Threatmodels
+	if len(tms) != 1 || len(tms[0].Threats) != 1 {
+		t.Fatalf("Unexpected threat models: %+v", tms)
+	}
+
+	return tms[0].Threats[0].Control
+}
+
+func TestParseWithCacheOffline(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	dir := writeCacheTestFiles(t, "file::./controls.hcl", "cached control")
+	cacheDir := t.TempDir()
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(cacheDir)
+	err := tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = os.Remove(filepath.Join(dir, "controls.hcl"))
+	if err != nil {
+		t.Fatalf("Error removing controls: %s", err)
+	}
+
+	tmParser = NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(cacheDir)
+	tmParser.SetOffline(true)
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file offline: %s", err)
+	}
+
+	if cachedControl(t, tmParser) != "cached control" {
+		t.Errorf("Expected the import to come from the cache, got '%s'", cachedControl(t, tmParser))
+	}
+}
+
+func TestParseWithCacheLocalRefetch(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name   string
+		source string
+		exp    string
+	}{
+		{
+			"local_path",
+			"controls.hcl",
+			"updated",
+		},
+		{
+			"forced_getter",
+			"file::./controls.hcl",
+			"original",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeCacheTestFiles(t, tc.source, "original")
+			cacheDir := t.TempDir()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			tmParser.SetCacheDir(cacheDir)
+			err := tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			err = os.WriteFile(filepath.Join(dir, "controls.hcl"), []byte(fmt.Sprintf(cacheTestControls, "updated")), 0o644)
+			if err != nil {
+				t.Fatalf("Error updating controls: %s", err)
+			}
+
+			tmParser = NewThreatmodelParser(defaultCfg)
+			tmParser.SetCacheDir(cacheDir)
+			err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			if cachedControl(t, tmParser) != tc.exp {
+				t.Errorf("Expected control '%s', got '%s'", tc.exp, cachedControl(t, tmParser))
+			}
+		})
+	}
+}
+
+func TestParseOfflineErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name     string
+		cacheDir bool
+		exp      string
+	}{
+		{
+			"empty_cache",
+			true,
+			"isn't in the cache",
+		},
+		{
+			"no_cache",
+			false,
+			"offline mode requires a cache directory",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeCacheTestFiles(t, "file::./controls.hcl", "words")
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			if tc.cacheDir {
+				tmParser.SetCacheDir(t.TempDir())
+			}
+			tmParser.SetOffline(true)
+
+			err := tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+			if err == nil {
+				t.Fatalf("Expected an error parsing offline")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Expected error containing '%s', got '%s'", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestParseOfflineLocal(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name     string
+		cacheDir bool
+	}{
+		{
+			"empty_cache",
+			true,
+		},
+		{
+			"no_cache",
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeCacheTestFiles(t, "controls.hcl", "local control")
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			if tc.cacheDir {
+				tmParser.SetCacheDir(t.TempDir())
+			}
+			tmParser.SetOffline(true)
+
+			err := tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file offline: %s", err)
+			}
+
+			if cachedControl(t, tmParser) != "local control" {
+				t.Errorf("Expected the local import to be read, got '%s'", cachedControl(t, tmParser))
+			}
+		})
+	}
+}
+
+func TestParseOfflineLocalRefetch(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	dir := writeCacheTestFiles(t, "controls.hcl", "original")
+	cacheDir := t.TempDir()
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(cacheDir)
+	err := tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "controls.hcl"), []byte(fmt.Sprintf(cacheTestControls, "updated")), 0o644)
+	if err != nil {
+		t.Fatalf("Error updating controls: %s", err)
+	}
+
+	tmParser = NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(cacheDir)
+	tmParser.SetOffline(true)
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file offline: %s", err)
+	}
+
+	if cachedControl(t, tmParser) != "updated" {
+		t.Errorf("Expected control 'updated', got '%s'", cachedControl(t, tmParser))
+	}
+}
+
+func TestParseIncludingWithCacheOffline(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cacheDir := t.TempDir()
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(cacheDir)
+	err := tmParser.ParseFile("./testdata/including/corp-app.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	offlineParser := NewThreatmodelParser(defaultCfg)
+	offlineParser.SetCacheDir(cacheDir)
+	offlineParser.SetOffline(true)
+	err = offlineParser.ParseFile("./testdata/including/corp-app.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file offline: %s", err)
+	}
+
+	online := tmParser.GetWrapped().Threatmodels[0]
+	offline := offlineParser.GetWrapped().Threatmodels[0]
+	if len(online.Threats) != len(offline.Threats) || len(online.InformationAssets) != len(offline.InformationAssets) {
+		t.Errorf("Offline include differs from online include: %+v vs %+v", offline, online)
+	}
+}
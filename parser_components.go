@@ -0,0 +1,201 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// libraryComponentTypes are the component types, other than controls, that
+// can be imported into a threatmodel with the matching *_imports attribute
+var libraryComponentTypes = []string{"threat", "information_asset", "third_party_dependency"}
+
+// componentCtyVal returns the value of a threat, information_asset or
+// third_party_dependency component as seen through import.TYPE.NAME
+func componentCtyVal(c *Component) cty.Value {
+	obj := map[string]cty.Value{
+		"description": cty.StringVal(c.Description),
+		"ref":         cty.StringVal(c.Ref),
+	}
+
+	switch c.ComponentType {
+	case "threat":
+		obj["impacts"] = stringListVal(c.ImpactType)
+		obj["stride"] = stringListVal(c.Stride)
+		obj["information_asset_refs"] = stringListVal(c.InformationAssetRefs)
+	case "information_asset":
+		obj["information_classification"] = cty.StringVal(c.InformationClassification)
+		obj["source"] = cty.StringVal(c.Source)
+	case "third_party_dependency":
+		obj["saas"] = cty.BoolVal(c.Saas)
+		obj["paying_customer"] = cty.BoolVal(c.PayingCustomer)
+		obj["open_source"] = cty.BoolVal(c.OpenSource)
+		obj["uptime_dependency"] = cty.StringVal(string(c.UptimeDependency))
+		obj["uptime_notes"] = cty.StringVal(c.UptimeNotes)
+		obj["infrastructure"] = cty.BoolVal(c.Infrastructure)
+	}
+
+	return cty.ObjectVal(obj)
+}
+
+func stringListVal(in []string) cty.Value {
+	if len(in) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+
+	vals := make([]cty.Value, 0, len(in))
+	for _, s := range in {
+		vals = append(vals, cty.StringVal(s))
+	}
+	return cty.ListVal(vals)
+}
+
+// validateComponents checks that each component only sets the fields of its
+// component type
+func (p *ThreatmodelParser) validateComponents() error {
+	var errMap error
+
+	for _, c := range p.wrapped.Components {
+		fieldErr := func(field, validOn string) {
+			errMap = multierror.Append(errMap, fmt.Errorf(
+				"component '%s' '%s': %s is only valid on %s components",
+				c.ComponentType, c.ComponentName, field, validOn,
+			))
+		}
+
+		if c.ComponentType != "threat" {
+			if len(c.ImpactType) > 0 {
+				fieldErr("impacts", "threat")
+			}
+			if len(c.Stride) > 0 {
+				fieldErr("stride", "threat")
+			}
+			if len(c.InformationAssetRefs) > 0 {
+				fieldErr("information_asset_refs", "threat")
+			}
+			if c.Risk != nil {
+				fieldErr("risk", "threat")
+			}
+			if len(c.Controls) > 0 {
+				fieldErr("control", "threat")
+			}
+		}
+
+		if c.ComponentType != "information_asset" {
+			if c.InformationClassification != "" {
+				fieldErr("information_classification", "information_asset")
+			}
+			if c.Source != "" {
+				fieldErr("source", "information_asset")
+			}
+		}
+
+		if c.ComponentType != "third_party_dependency" {
+			if c.Saas || c.PayingCustomer || c.OpenSource || c.Infrastructure || c.UptimeDependency != "" || c.UptimeNotes != "" {
+				fieldErr("saas, paying_customer, open_source, uptime_dependency, uptime_notes and infrastructure are", "third_party_dependency")
+			}
+		}
+	}
+
+	return errMap
+}
+
+// processComponentImports adds the components referenced by each
+// threatmodel's threat_imports, information_asset_imports and
+// third_party_dependency_imports. An element the threatmodel already defines
+// with the same name is kept instead of the imported one.
+func (p *ThreatmodelParser) processComponentImports() error {
+	for i := range p.wrapped.Threatmodels {
+		tm := &p.wrapped.Threatmodels[i]
+
+		for _, ref := range tm.InformationAssetImports {
+			c, err := p.resolveComponentImport(ref, "information_asset")
+			if err != nil {
+				return fmt.Errorf("TM '%s': %s", tm.Name, err)
+			}
+			tm.addInfoIfNotExist(c.informationAsset())
+		}
+
+		for _, ref := range tm.ThirdPartyDependencyImports {
+			c, err := p.resolveComponentImport(ref, "third_party_dependency")
+			if err != nil {
+				return fmt.Errorf("TM '%s': %s", tm.Name, err)
+			}
+			tm.addTpdIfNotExist(c.thirdPartyDependency())
+		}
+
+		for _, ref := range tm.ThreatImports {
+			c, err := p.resolveComponentImport(ref, "threat")
+			if err != nil {
+				return fmt.Errorf("TM '%s': %s", tm.Name, err)
+			}
+			tm.addTIfNotExist(c.threat())
+		}
+	}
+
+	return nil
+}
+
+// resolveComponentImport resolves a reference such as
+// "import.threat.session_hijacking" to the imported component
+func (p *ThreatmodelParser) resolveComponentImport(ref, componentType string) (*Component, error) {
+	parts := strings.SplitN(ref, ".", 3)
+	if len(parts) != 3 || parts[0] != "import" || parts[1] != componentType {
+		return nil, fmt.Errorf("invalid %s import format: %s (expected: import.%s.%s_name)", componentType, ref, componentType, componentType)
+	}
+
+	c, ok := p.componentImports[componentType][parts[2]]
+	if !ok {
+		return nil, fmt.Errorf("%s '%s' not found in imports", componentType, parts[2])
+	}
+
+	return c, nil
+}
+
+func (c *Component) threat() Threat {
+	t := Threat{
+		Name:                 c.ComponentName,
+		Description:          c.Description,
+		ImpactType:           append([]string{}, c.ImpactType...),
+		Stride:               append([]string{}, c.Stride...),
+		InformationAssetRefs: append([]string{}, c.InformationAssetRefs...),
+		Ref:                  c.Ref,
+	}
+
+	if c.Risk != nil {
+		risk := *c.Risk
+		t.Risk = &risk
+	}
+
+	for _, ctrl := range c.Controls {
+		ctrlCopy := *ctrl
+		t.Controls = append(t.Controls, &ctrlCopy)
+	}
+
+	return t
+}
+
+func (c *Component) informationAsset() InformationAsset {
+	return InformationAsset{
+		Name:                      c.ComponentName,
+		Description:               c.Description,
+		InformationClassification: c.InformationClassification,
+		Source:                    c.Source,
+		Ref:                       c.Ref,
+	}
+}
+
+func (c *Component) thirdPartyDependency() ThirdPartyDependency {
+	return ThirdPartyDependency{
+		Name:             c.ComponentName,
+		Description:      c.Description,
+		Saas:             c.Saas,
+		PayingCustomer:   c.PayingCustomer,
+		OpenSource:       c.OpenSource,
+		UptimeDependency: c.UptimeDependency,
+		UptimeNotes:      c.UptimeNotes,
+		Infrastructure:   c.Infrastructure,
+	}
+}
@@ -0,0 +1,192 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithComponentImports(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-with-component-imports.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if len(tm.InformationAssets) != 1 {
+		t.Fatalf("Expected 1 information asset, got %d", len(tm.InformationAssets))
+	}
+
+	ia := tm.InformationAssets[0]
+	if ia.Name != "session_tokens" || ia.InformationClassification != "Restricted" || ia.Source != "Identity service" {
+		t.Errorf("Information asset wasn't imported with its fields: %+v", ia)
+	}
+
+	if len(tm.ThirdPartyDependencies) != 1 {
+		t.Fatalf("Expected 1 third party dependency, got %d", len(tm.ThirdPartyDependencies))
+	}
+
+	tpd := tm.ThirdPartyDependencies[0]
+	if !tpd.Saas || !tpd.PayingCustomer || tpd.UptimeDependency != HardUptime || tpd.UptimeNotes == "" {
+		t.Errorf("Third party dependency wasn't imported with its fields: %+v", tpd)
+	}
+
+	var imported *Threat
+	for _, threat := range tm.Threats {
+		if threat.Name == "session_hijacking" {
+			imported = threat
+		}
+
+		if threat.Name == "reused_description" && threat.Description != "An attacker takes over a user's session" {
+			t.Errorf("Expected import.threat.NAME.description to resolve, got '%s'", threat.Description)
+		}
+
+		if threat.Name == "card_skimming" && (len(threat.Controls) != 1 || threat.Controls[0].Description != "Multi-factor authentication") {
+			t.Errorf("Control import should be unaffected, got %+v", threat.Controls)
+		}
+	}
+
+	if imported == nil {
+		t.Fatalf("Imported threat not found in %+v", tm.Threats)
+	}
+
+	if imported.Ref != "THREAT-001" || len(imported.InformationAssetRefs) != 1 {
+		t.Errorf("Threat wasn't imported with its fields: %+v", imported)
+	}
+
+	if len(imported.ImpactType) != 1 || imported.ImpactType[0] != "Confidentiality" || len(imported.Stride) != 1 || imported.Stride[0] != "Spoofing" {
+		t.Errorf("Expected normalized impacts and stride, got %v and %v", imported.ImpactType, imported.Stride)
+	}
+
+	if imported.Risk == nil || imported.Risk.Likelihood != RiskLevelMedium || imported.Risk.Impact != RiskLevelHigh {
+		t.Errorf("Risk wasn't imported: %+v", imported.Risk)
+	}
+
+	if len(imported.Controls) != 1 || imported.Controls[0].RiskReduction != 40 || !imported.Controls[0].Implemented {
+		t.Errorf("Controls weren't imported: %+v", imported.Controls)
+	}
+}
+
+func TestParseHCLRawComponentImportErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"wrong_namespace",
+			`threat_imports = ["import.information_asset.session_tokens"]`,
+			"invalid threat import format",
+		},
+		{
+			"missing",
+			`information_asset_imports = ["import.information_asset.nope"]`,
+			"information_asset 'nope' not found in imports",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(`spec_version = "0.4.0"
+
+threatmodel "test" {
+  author = "@xntrik"
+  ` + tc.in + `
+}
+`))
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Expected error containing '%s', got '%v'", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawComponentNotAControl(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"control_imports",
+			`control_imports = ["import.control.session_hijacking"]`,
+			"control 'session_hijacking' not found in imports",
+		},
+		{
+			"expression",
+			`control = import.control.payments_vendor.description`,
+			"Unsupported attribute",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Library components aren't controls, so aren't under
+			// import.control
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRawWithOptions([]byte(`spec_version = "0.4.0"
+
+threatmodel "test" {
+  author  = "@xntrik"
+  imports = ["library.hcl"]
+
+  threat "t" {
+    description = "words"
+    `+tc.in+`
+  }
+}
+`), RawParseOptions{BaseDir: "./testdata"})
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Expected error containing '%s', got '%v'", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawComponentFieldValidation(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLRaw([]byte(`spec_version = "0.4.0"
+
+component "control" "mfa" {
+  description = "Multi-factor authentication"
+  stride = ["Spoofing"]
+}
+
+component "information_asset" "tokens" {
+  description = "Tokens"
+  saas = true
+}
+`))
+	if err == nil {
+		t.Fatalf("Expected errors for fields on the wrong component type")
+	}
+
+	for _, exp := range []string{
+		"component 'control' 'mfa': stride is only valid on threat components",
+		"component 'information_asset' 'tokens': saas, paying_customer",
+	} {
+		if !strings.Contains(err.Error(), exp) {
+			t.Errorf("Expected error containing '%s', got '%s'", exp, err)
+		}
+	}
+}
@@ -2,136 +2,244 @@ package spec
 
 import (
 	"fmt"
+	"sync"
 
 	version "github.com/hashicorp/go-version"
 )
 
-type hcltmConstraint interface {
-	// You can see the format used for verConstraint() here:
+// Constraint is a deprecation rule checked against parsed threat models by
+// CheckConstraints. The built-in constraints cover the deprecated hcltm
+// blocks and attributes, and more can be added with RegisterConstraint.
+type Constraint interface {
+	// ID uniquely identifies the constraint, such as "multi_dfd"
+	ID() string
+
+	// VersionConstraint is the range of spec_version the constraint applies
+	// to. You can see the format used here:
 	// https://github.com/hashicorp/go-version
 	//
 	// Examples include:
 	// ">= 0.0.1"
 	// ">= 0.0.1, < 1.4"
+	VersionConstraint() string
+
+	// AsOf is the version the deprecation was introduced in
+	AsOf() string
+
+	// Message describes the deprecation and what to do about it
+	Message() string
+
+	// Check returns the names of the elements in tm the constraint applies
+	// to, or nothing if it doesn't apply
+	Check(tm *Threatmodel) []string
+}
+
+// ConstraintFinding is a Constraint that applies to a threat model
+type ConstraintFinding struct {
+	// ID is the ID of the Constraint
+	ID string
+	// AsOf is the version the deprecation was introduced in
+	AsOf string
+	// Threatmodel is the name of the threat model it applies to
+	Threatmodel string
+	// Elements are the names of the elements it applies to, such as threats
+	Elements []string
+	Message  string
+}
+
+func (f ConstraintFinding) String() string {
+	return fmt.Sprintf("[threatmodel: %s] %s", f.Threatmodel, f.Message)
+}
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = []Constraint{
+		&controlStringToBlock{},
+		&proposedControlToBlock{},
+		&expandedControlToControl{},
+		&multiDfd{},
+	}
+)
+
+// RegisterConstraint adds c to the constraints checked by CheckConstraints,
+// after the built-in and previously registered ones. It's an error for c to
+// have an empty or existing ID, or an invalid VersionConstraint.
+func RegisterConstraint(c Constraint) error {
+	if c.ID() == "" {
+		return fmt.Errorf("constraint must have an ID")
+	}
+
+	if _, err := version.NewConstraint(c.VersionConstraint()); err != nil {
+		return fmt.Errorf("constraint '%s' has an invalid version constraint: %s", c.ID(), err)
+	}
+
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+
+	for _, existing := range constraints {
+		if existing.ID() == c.ID() {
+			return fmt.Errorf("constraint '%s' is already registered", c.ID())
+		}
+	}
+
+	constraints = append(constraints, c)
 
-	verConstraint() string
-	msg() string
-	asOf() string
-	tmCheck(tm *Threatmodel) bool
+	return nil
+}
+
+// registeredConstraints returns a copy of the registered constraints, in the
+// order they were registered
+func registeredConstraints() []Constraint {
+	constraintsMu.RLock()
+	defer constraintsMu.RUnlock()
+
+	return append([]Constraint{}, constraints...)
+}
+
+// CheckConstraints returns every finding of the registered constraints that
+// apply to tmw's spec_version, ordered by threat model and then by the order
+// the constraints were registered in (the built-in ones first).
+func CheckConstraints(tmw *ThreatmodelWrapped) ([]ConstraintFinding, error) {
+	currVer, err := version.NewVersion(tmw.SpecVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	applicable := []Constraint{}
+	for _, c := range registeredConstraints() {
+		verConst, err := version.NewConstraint(c.VersionConstraint())
+		if err != nil {
+			return nil, err
+		}
+
+		if verConst.Check(currVer) {
+			applicable = append(applicable, c)
+		}
+	}
+
+	findings := []ConstraintFinding{}
+	for i := range tmw.Threatmodels {
+		tm := &tmw.Threatmodels[i]
+
+		for _, c := range applicable {
+			elements := c.Check(tm)
+			if len(elements) == 0 {
+				continue
+			}
+
+			findings = append(findings, ConstraintFinding{
+				ID:          c.ID(),
+				AsOf:        c.AsOf(),
+				Threatmodel: tm.Name,
+				Elements:    elements,
+				Message:     c.Message(),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// VersionConstraints returns the first finding from CheckConstraints for tmw
+// as a string, or "" if there are none. emit is ignored, as the library no
+// longer writes to stdout: print the returned message, or use the parser's
+// Warnings.
+//
+// Deprecated: use CheckConstraints, which returns every finding.
+func VersionConstraints(tmw *ThreatmodelWrapped, emit bool) (string, error) {
+	findings, err := CheckConstraints(tmw)
+	if err != nil || len(findings) == 0 {
+		return "", err
+	}
+
+	return findings[0].String(), nil
 }
 
 type controlStringToBlock struct{}
 
-func (c *controlStringToBlock) asOf() string {
+func (c *controlStringToBlock) ID() string {
+	return "control_string_to_block"
+}
+func (c *controlStringToBlock) AsOf() string {
 	return "0.1.5"
 }
-func (c *controlStringToBlock) verConstraint() string {
+func (c *controlStringToBlock) VersionConstraint() string {
 	return ">= 0.0.1"
 }
-func (c *controlStringToBlock) msg() string {
+func (c *controlStringToBlock) Message() string {
 	return "Deprecation warning: This threat model has defined `control` strings inside of `threat` blocks. As of v0.1.5 It's recommended that you update these to `expanded_control` blocks, as they may be cause errors in future versions of hcltm."
 }
-func (c *controlStringToBlock) tmCheck(tm *Threatmodel) bool {
-
-	for _, t := range tm.Threats {
-		if t.Control != "" {
-			return true
-		}
-	}
-	return false
+func (c *controlStringToBlock) Check(tm *Threatmodel) []string {
+	return threatsWhere(tm, func(t *Threat) bool { return t.Control != "" })
 }
 
 type proposedControlToBlock struct{}
 
-func (c *proposedControlToBlock) asOf() string {
+func (c *proposedControlToBlock) ID() string {
+	return "proposed_control_to_block"
+}
+func (c *proposedControlToBlock) AsOf() string {
 	return "0.1.5"
 }
-func (c *proposedControlToBlock) verConstraint() string {
+func (c *proposedControlToBlock) VersionConstraint() string {
 	return ">= 0.0.1"
 }
-func (c *proposedControlToBlock) msg() string {
+func (c *proposedControlToBlock) Message() string {
 	return "Deprecation warning: This threat model has defined `proposed_control` block(s) inside of `threat` blocks. As of v0.1.5 It's recommended that you update these to `expanded_control` blocks, as they may be cause errors in future versions of hcltm."
 }
-func (c *proposedControlToBlock) tmCheck(tm *Threatmodel) bool {
-
-	for _, t := range tm.Threats {
-		if len(t.ProposedControls) > 0 {
-			return true
-		}
-	}
-	return false
+func (c *proposedControlToBlock) Check(tm *Threatmodel) []string {
+	return threatsWhere(tm, func(t *Threat) bool { return len(t.ProposedControls) > 0 })
 }
 
 type expandedControlToControl struct{}
 
-func (c *expandedControlToControl) asOf() string {
+func (c *expandedControlToControl) ID() string {
+	return "expanded_control_to_control"
+}
+func (c *expandedControlToControl) AsOf() string {
 	return "0.1.17"
 }
-func (c *expandedControlToControl) verConstraint() string {
+func (c *expandedControlToControl) VersionConstraint() string {
 	return ">= 0.0.1"
 }
-func (c *expandedControlToControl) msg() string {
+func (c *expandedControlToControl) Message() string {
 	return "Deprecation warning: This threat model has defined `expanded_control` block(s) inside of `threat` blocks. As of v0.1.17 it is recommended that you update these to `control` blocks, as they may cause errors in future versions of hcltm."
 }
-func (c *expandedControlToControl) tmCheck(tm *Threatmodel) bool {
-	for _, t := range tm.Threats {
-		if len(t.ExpandedControls) > 0 {
-			return true
-		}
-	}
-	return false
+func (c *expandedControlToControl) Check(tm *Threatmodel) []string {
+	return threatsWhere(tm, func(t *Threat) bool { return len(t.ExpandedControls) > 0 })
 }
 
 type multiDfd struct{}
 
-func (c *multiDfd) asOf() string {
+func (c *multiDfd) ID() string {
+	return "multi_dfd"
+}
+func (c *multiDfd) AsOf() string {
 	return "0.1.6"
 }
-func (c *multiDfd) verConstraint() string {
+func (c *multiDfd) VersionConstraint() string {
 	return ">= 0.0.1"
 }
-func (c *multiDfd) msg() string {
+func (c *multiDfd) Message() string {
 	return "Deprecation warning: This threat model has a defined `data_flow_diagram` block inside of a `threat` block. As of v0.1.6 it is recommended that you update these to `data_flow_diagram_v2` blocks. In the future, we may retire the old block. The new block requires a `title` label."
 }
-func (c *multiDfd) tmCheck(tm *Threatmodel) bool {
+func (c *multiDfd) Check(tm *Threatmodel) []string {
+	names := []string{}
 	for _, d := range tm.DataFlowDiagrams {
 		if d.ShiftedFromLegacy {
-			return true
+			names = append(names, d.Name)
 		}
 	}
-	return false
+	return names
 }
 
-func VersionConstraints(tmw *ThreatmodelWrapped, emit bool) (string, error) {
-	hcltmConstraints := make(map[string]hcltmConstraint)
-	hcltmConstraints["control_string_to_block"] = &controlStringToBlock{}
-	hcltmConstraints["proposed_control_to_block"] = &proposedControlToBlock{}
-	hcltmConstraints["expanded_control_to_control"] = &expandedControlToControl{}
-	hcltmConstraints["multi_dfd"] = &multiDfd{}
-
-	for _, cval := range hcltmConstraints {
-		newConst, err := version.NewConstraint(cval.verConstraint())
-		if err != nil {
-			return "", err
-		}
-
-		currVer, err := version.NewVersion(tmw.SpecVersion)
-		if err != nil {
-			return "", err
-		}
-
-		if newConst.Check(currVer) {
-			for _, tm := range tmw.Threatmodels {
-				if cval.tmCheck(&tm) {
-					if emit {
-						fmt.Printf("[threatmodel: %s] %s\n", tm.Name, cval.msg())
-					}
-					return fmt.Sprintf("[threatmodel: %s] %s", tm.Name, cval.msg()), nil
-				}
-			}
+// threatsWhere returns the names of tm's threats that match
+func threatsWhere(tm *Threatmodel, match func(t *Threat) bool) []string {
+	names := []string{}
+	for _, t := range tm.Threats {
+		if match(t) {
+			names = append(names, t.Name)
 		}
 	}
-
-	return "", nil
-
+	return names
 }
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -73,3 +74,120 @@ func TestControlStringConstraint(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckConstraints(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFile("./testdata/tm-migrate.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	// Run it more than once, as the order has to be stable
+	for i := 0; i < 5; i++ {
+		findings, err := CheckConstraints(tmParser.GetWrapped())
+		if err != nil {
+			t.Fatalf("Error checking constraints: %s", err)
+		}
+
+		got := []string{}
+		for _, f := range findings {
+			got = append(got, fmt.Sprintf("%s %s %s %v", f.ID, f.AsOf, f.Threatmodel, f.Elements))
+		}
+
+		expected := []string{
+			"control_string_to_block 0.1.5 migrate [phishing]",
+			"proposed_control_to_block 0.1.5 migrate [phishing]",
+			"expanded_control_to_control 0.1.17 migrate [phishing]",
+			"multi_dfd 0.1.6 migrate [Legacy DFD]",
+		}
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("Expected findings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+
+		if !strings.HasPrefix(findings[3].Message, "Deprecation warning: This threat model has a defined `data_flow_diagram`") {
+			t.Errorf("Incorrect message: %s", findings[3].Message)
+		}
+	}
+}
+
+type testConstraint struct {
+	id         string
+	constraint string
+}
+
+func (c *testConstraint) ID() string                { return c.id }
+func (c *testConstraint) AsOf() string              { return "0.2.0" }
+func (c *testConstraint) VersionConstraint() string { return c.constraint }
+func (c *testConstraint) Message() string           { return "this threat is deprecated" }
+func (c *testConstraint) Check(tm *Threatmodel) []string {
+	return threatsWhere(tm, func(t *Threat) bool { return t.Name == "registered_constraint_threat" })
+}
+
+func TestRegisterConstraint(t *testing.T) {
+	err := RegisterConstraint(&testConstraint{"test_registered", ">= 0.0.1"})
+	if err != nil {
+		t.Fatalf("Error registering constraint: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		c    Constraint
+		exp  string
+	}{
+		{"duplicate", &testConstraint{"test_registered", ">= 0.0.1"}, "constraint 'test_registered' is already registered"},
+		{"builtin", &testConstraint{"multi_dfd", ">= 0.0.1"}, "constraint 'multi_dfd' is already registered"},
+		{"no_id", &testConstraint{"", ">= 0.0.1"}, "constraint must have an ID"},
+		{"bad_version", &testConstraint{"test_bad_version", "nope"}, "constraint 'test_bad_version' has an invalid version constraint"},
+	}
+
+	for _, tc := range cases {
+		err := RegisterConstraint(tc.c)
+		if err == nil {
+			t.Fatalf("%s: Expected an error", tc.name)
+		}
+
+		if !strings.Contains(err.Error(), tc.exp) {
+			t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+		}
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err = tmParser.ParseHCLRaw([]byte(`spec_version = "0.1.17"
+
+threatmodel "tm" {
+  author = "@me"
+
+  threat "registered_constraint_threat" {
+    description = "words"
+    control     = "a control string"
+  }
+}
+`))
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	findings, err := CheckConstraints(tmParser.GetWrapped())
+	if err != nil {
+		t.Fatalf("Error checking constraints: %s", err)
+	}
+
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d", len(findings))
+	}
+
+	// Registered constraints come after the built-in ones
+	if findings[0].ID != "control_string_to_block" || findings[1].ID != "test_registered" {
+		t.Errorf("Incorrect findings order: %+v", findings)
+	}
+
+	if findings[1].String() != "[threatmodel: tm] this threat is deprecated" {
+		t.Errorf("Incorrect finding: %s", findings[1])
+	}
+}
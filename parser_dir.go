@@ -0,0 +1,311 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// ParseDir parses every .hcl and .json file in dir (not recursing into sub
+// directories) as a single threat model. See ParseFiles for how the files are
+// combined. Dotfiles, such as the lock file (see DefaultLockFilename), are
+// skipped, as are the lock file and var file the parser is configured with.
+func (p *ThreatmodelParser) ParseDir(dir string) error {
+	return p.ParseDirContext(context.Background(), dir)
+}
+
+// ParseDirContext is ParseDir, where ctx cancels fetching any imports and
+// including sources
+func (p *ThreatmodelParser) ParseDirContext(ctx context.Context, dir string) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseDir(ctx, dir)
+	})
+}
+
+func (p *ThreatmodelParser) parseDir(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	skip := map[string]bool{}
+	for _, filename := range []string{p.varFilename, p.lockFilename()} {
+		if filename == "" {
+			continue
+		}
+
+		if abs, err := filepath.Abs(filename); err == nil {
+			skip[abs] = true
+		}
+	}
+
+	filenames := []string{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		filename := filepath.Join(dir, e.Name())
+		if abs, err := filepath.Abs(filename); err == nil && skip[abs] {
+			continue
+		}
+
+		switch filepath.Ext(e.Name()) {
+		case ".hcl", ".json":
+			filenames = append(filenames, filename)
+		}
+	}
+
+	if len(filenames) == 0 {
+		return fmt.Errorf("no HCL or JSON files found in '%s'", dir)
+	}
+
+	return p.parseFiles(ctx, filenames)
+}
+
+// ParseFiles parses a set of HCL and/or JSON files into one wrapped model, in
+// the same way Terraform treats the files of a module. Top-level blocks from
+// every file are combined, and `threatmodel` blocks sharing a label are merged
+// into a single threat model, so (for example) threats, assets and DFDs can
+// live in separate files. An attribute may only be set once per threat model
+// across all files, and spec_version must agree wherever it is set.
+//
+// Variables and imports are visible to every file, and validation runs once
+// on the merged result. Relative imports and including sources are resolved
+// against the directory of the first file.
+func (p *ThreatmodelParser) ParseFiles(filenames []string) error {
+	return p.ParseFilesContext(context.Background(), filenames)
+}
+
+// ParseFilesContext is ParseFiles, where ctx cancels fetching any imports and
+// including sources
+func (p *ThreatmodelParser) ParseFilesContext(ctx context.Context, filenames []string) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseFiles(ctx, filenames)
+	})
+}
+
+func (p *ThreatmodelParser) parseFiles(ctx context.Context, filenames []string) error {
+	if len(filenames) == 0 {
+		return fmt.Errorf("no threat model files provided")
+	}
+
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
+	parser := hclparse.NewParser()
+	bodies := mergedTmBody{}
+	files := make([]*hcl.File, 0, len(filenames))
+
+	for _, filename := range filenames {
+		var f *hcl.File
+		var diags hcl.Diagnostics
+
+		switch filepath.Ext(filename) {
+		case ".hcl":
+			f, diags = parser.ParseHCLFile(filename)
+		case ".json":
+			f, diags = parser.ParseJSONFile(filename)
+		default:
+			return fmt.Errorf("file '%s' isn't HCL or JSON", filename)
+		}
+
+		if diags.HasErrors() {
+			return diags
+		}
+
+		bodies = append(bodies, f.Body)
+		files = append(files, f)
+	}
+
+	err := p.parseHCL(ctx, &hcl.File{Body: bodies}, newSourceFiles(files...), filenames[0], false)
+	if err != nil {
+		return err
+	}
+
+	return p.includeAll(ctx, filenames[0])
+}
+
+// mergedTmBody is an hcl.Body spanning several threat model files. Like
+// hcl.MergeFiles it concatenates each file's top-level content, but
+// `threatmodel` blocks with the same label are folded into one block whose
+// body is the hcl.MergeBodies of each file's block, and a top-level attribute
+// may be repeated as long as every file sets the same value.
+type mergedTmBody []hcl.Body
+
+func (mb mergedTmBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, _, diags := mb.mergedContent(schema, false)
+	return content, diags
+}
+
+func (mb mergedTmBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	return mb.mergedContent(schema, true)
+}
+
+func (mb mergedTmBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return hcl.MergeBodies(mb).JustAttributes()
+}
+
+func (mb mergedTmBody) MissingItemRange() hcl.Range {
+	if len(mb) == 0 {
+		return hcl.Range{}
+	}
+	return mb[0].MissingItemRange()
+}
+
+func (mb mergedTmBody) mergedContent(schema *hcl.BodySchema, partial bool) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	// Any one file can provide a required attribute, so they're checked once
+	// everything has been merged
+	mergedSchema := optionalAttrs(schema)
+
+	content := &hcl.BodyContent{
+		Attributes: hcl.Attributes{},
+	}
+	var leftovers []hcl.Body
+	var diags hcl.Diagnostics
+
+	tmBlocks := make(map[string]*hcl.Block)
+	tmBodies := make(map[string][]hcl.Body)
+
+	for _, body := range mb {
+		var thisContent *hcl.BodyContent
+		var thisLeftovers hcl.Body
+		var thisDiags hcl.Diagnostics
+
+		if partial {
+			thisContent, thisLeftovers, thisDiags = body.PartialContent(mergedSchema)
+		} else {
+			thisContent, thisDiags = body.Content(mergedSchema)
+		}
+
+		diags = append(diags, thisDiags...)
+		if thisLeftovers != nil {
+			leftovers = append(leftovers, thisLeftovers)
+		}
+		if thisContent == nil {
+			continue
+		}
+
+		for name, attr := range thisContent.Attributes {
+			existing, ok := content.Attributes[name]
+			if !ok {
+				content.Attributes[name] = attr
+				continue
+			}
+
+			if !sameAttrValue(existing, attr) {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Conflicting argument",
+					Detail: fmt.Sprintf(
+						"Argument %q was already set to a different value at %s",
+						name, existing.NameRange.String(),
+					),
+					Subject: attr.NameRange.Ptr(),
+				})
+			}
+		}
+
+		for _, blk := range thisContent.Blocks {
+			if blk.Type != "threatmodel" || len(blk.Labels) != 1 {
+				content.Blocks = append(content.Blocks, blk)
+				continue
+			}
+
+			label := blk.Labels[0]
+			if _, ok := tmBlocks[label]; !ok {
+				merged := *blk
+				tmBlocks[label] = &merged
+				content.Blocks = append(content.Blocks, &merged)
+			}
+			tmBodies[label] = append(tmBodies[label], blk.Body)
+		}
+	}
+
+	for label, blk := range tmBlocks {
+		if len(tmBodies[label]) > 1 {
+			blk.Body = mergedBlockBody(tmBodies[label])
+		}
+	}
+
+	diags = append(diags, missingAttrs(schema, content.Attributes, mb.MissingItemRange())...)
+
+	return content, mergedTmBody(leftovers), diags
+}
+
+// mergedBlockBody is the hcl.MergeBodies of a threatmodel block's body in
+// each file, except that a missing required argument is reported at the
+// block in the first file rather than without a location
+type mergedBlockBody []hcl.Body
+
+func (mb mergedBlockBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := hcl.MergeBodies(mb).Content(optionalAttrs(schema))
+	if content != nil {
+		diags = append(diags, missingAttrs(schema, content.Attributes, mb.MissingItemRange())...)
+	}
+	return content, diags
+}
+
+func (mb mergedBlockBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, leftovers, diags := hcl.MergeBodies(mb).PartialContent(optionalAttrs(schema))
+	if content != nil {
+		diags = append(diags, missingAttrs(schema, content.Attributes, mb.MissingItemRange())...)
+	}
+	return content, leftovers, diags
+}
+
+func (mb mergedBlockBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return hcl.MergeBodies(mb).JustAttributes()
+}
+
+func (mb mergedBlockBody) MissingItemRange() hcl.Range {
+	if len(mb) == 0 {
+		return hcl.Range{}
+	}
+	return mb[0].MissingItemRange()
+}
+
+// optionalAttrs returns schema with none of its attributes required
+func optionalAttrs(schema *hcl.BodySchema) *hcl.BodySchema {
+	optional := &hcl.BodySchema{
+		Blocks: schema.Blocks,
+	}
+	for _, attrS := range schema.Attributes {
+		attrS.Required = false
+		optional.Attributes = append(optional.Attributes, attrS)
+	}
+	return optional
+}
+
+// missingAttrs returns an error at rng for each attribute schema requires
+// that isn't in attrs
+func missingAttrs(schema *hcl.BodySchema, attrs hcl.Attributes, rng hcl.Range) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, attrS := range schema.Attributes {
+		if attrS.Required && attrs[attrS.Name] == nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Missing required argument",
+				Detail:   fmt.Sprintf("The argument %q is required, but was not set.", attrS.Name),
+				Subject:  rng.Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// sameAttrValue reports whether two attributes evaluate (without any context)
+// to the same known value.
+func sameAttrValue(a, b *hcl.Attribute) bool {
+	aVal, aDiags := a.Expr.Value(nil)
+	bVal, bDiags := b.Expr.Value(nil)
+	if aDiags.HasErrors() || bDiags.HasErrors() || !aVal.IsWhollyKnown() || !bVal.IsWhollyKnown() {
+		return false
+	}
+	return aVal.Equals(bVal).True()
+}
@@ -0,0 +1,289 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestParseDir(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseDir("./testdata/split")
+	if err != nil {
+		t.Fatalf("Error parsing split TM dir: %s", err)
+	}
+
+	wrapped := tmParser.GetWrapped()
+
+	if len(wrapped.Threatmodels) != 2 {
+		t.Fatalf("Expected 2 threat models, got %d", len(wrapped.Threatmodels))
+	}
+
+	var tm *Threatmodel
+	for i := range wrapped.Threatmodels {
+		if wrapped.Threatmodels[i].Name == "Split App" {
+			tm = &wrapped.Threatmodels[i]
+		}
+	}
+
+	if tm == nil {
+		t.Fatal("Couldn't find the merged 'Split App' threat model")
+	}
+
+	if tm.Author != "@xntrik" {
+		t.Errorf("Expected the author from assets.hcl, got '%s'", tm.Author)
+	}
+
+	if tm.Description != "A billing service split across files" {
+		t.Errorf("Expected the description from threats.hcl, got '%s'", tm.Description)
+	}
+
+	if len(tm.InformationAssets) != 1 || len(tm.Threats) != 1 || len(tm.DataFlowDiagrams) != 1 {
+		t.Errorf("Expected blocks from every file to be merged, got %d assets, %d threats, %d dfds",
+			len(tm.InformationAssets), len(tm.Threats), len(tm.DataFlowDiagrams))
+	}
+
+	if wrapped.SpecVersion != "0.4.0" {
+		t.Errorf("Expected spec_version '0.4.0', got '%s'", wrapped.SpecVersion)
+	}
+}
+
+func TestParseDirSkipsLockAndVarFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	entries, err := os.ReadDir("./testdata/split")
+	if err != nil {
+		t.Fatalf("Error reading dir: %s", err)
+	}
+
+	for _, e := range entries {
+		src, err := os.ReadFile(filepath.Join("./testdata/split", e.Name()))
+		if err != nil {
+			t.Fatalf("Error reading file: %s", err)
+		}
+
+		err = os.WriteFile(filepath.Join(dir, e.Name()), src, 0o644)
+		if err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	files := map[string]string{
+		DefaultLockFilename: `source "https://example.com/controls.hcl" {
+  hash = "abc"
+}
+`,
+		"prod.hcl": `environment = "prod"` + "\n",
+		"variables.hcl": `variable "environment" {
+  value = "dev"
+}
+`,
+		".scratch.hcl": `not valid {`,
+	}
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err = tmParser.SetLockFile(filepath.Join(dir, DefaultLockFilename), LockVerify)
+	if err != nil {
+		t.Fatalf("Error loading lock file: %s", err)
+	}
+
+	err = tmParser.SetVarFile(filepath.Join(dir, "prod.hcl"))
+	if err != nil {
+		t.Fatalf("Error loading var file: %s", err)
+	}
+
+	err = tmParser.ParseDir(dir)
+	if err != nil {
+		t.Fatalf("Error parsing split TM dir: %s", err)
+	}
+
+	if len(tmParser.GetWrapped().Threatmodels) != 2 {
+		t.Errorf("Expected 2 threat models, got %d", len(tmParser.GetWrapped().Threatmodels))
+	}
+
+	// The lock file is a dotfile, so it's skipped even when it isn't
+	// configured, unlike a var file
+	unconfigured := NewThreatmodelParser(defaultCfg)
+	err = unconfigured.ParseDir(dir)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	if strings.Contains(err.Error(), DefaultLockFilename) || !strings.Contains(err.Error(), "prod.hcl") {
+		t.Errorf("Expected only the var file to be parsed, got '%s'", err)
+	}
+}
+
+func TestParseDirCrossFileValidation(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseDir("./testdata/split-invalid")
+	if err == nil {
+		t.Fatal("Expected cross-file validation errors")
+	}
+
+	for _, want := range []string{
+		"duplicate information_asset 'customer data'",
+		"non-existent information_asset 'payment data'",
+		"invalid to connection for flow 'api:db'",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got: %s", want, err)
+		}
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	cases := []struct {
+		name      string
+		files     []string
+		exp       string
+		invalid   bool
+		tmCount   int
+		tmThreats int
+	}{
+		{
+			"subset",
+			[]string{"./testdata/split/assets.hcl", "./testdata/split/threats.hcl"},
+			"",
+			false,
+			1,
+			1,
+		},
+		{
+			"missing author",
+			[]string{"./testdata/split/dfd.hcl"},
+			"The argument \"author\" is required",
+			true,
+			0,
+			0,
+		},
+		{
+			"missing author across files",
+			[]string{"./testdata/split/dfd.hcl", "./testdata/split/threats.hcl"},
+			"./testdata/split/dfd.hcl:1,25-25: Missing required argument; The argument \"author\" is required",
+			true,
+			0,
+			0,
+		},
+		{
+			"conflicting attribute",
+			[]string{"./testdata/split/threats.hcl", "./testdata/split/threats.hcl", "./testdata/split/assets.hcl"},
+			"Duplicate argument",
+			true,
+			0,
+			0,
+		},
+		{
+			"bad extension",
+			[]string{"./testdata/tm1.csv"},
+			"isn't HCL or JSON",
+			true,
+			0,
+			0,
+		},
+		{
+			"no files",
+			[]string{},
+			"no threat model files provided",
+			true,
+			0,
+			0,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			defaultCfg := &ThreatmodelSpecConfig{}
+			defaultCfg.setDefaults()
+			tmParser := NewThreatmodelParser(defaultCfg)
+
+			err := tmParser.ParseFiles(tc.files)
+
+			if tc.invalid {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				if !strings.Contains(err.Error(), tc.exp) {
+					t.Errorf("Expected error to contain %q, got: %s", tc.exp, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Error parsing files: %s", err)
+			}
+
+			if len(tmParser.GetWrapped().Threatmodels) != tc.tmCount {
+				t.Fatalf("Expected %d threat models, got %d", tc.tmCount, len(tmParser.GetWrapped().Threatmodels))
+			}
+
+			if len(tmParser.GetWrapped().Threatmodels[0].Threats) != tc.tmThreats {
+				t.Errorf("Expected %d threats, got %d", tc.tmThreats, len(tmParser.GetWrapped().Threatmodels[0].Threats))
+			}
+		})
+	}
+}
+
+func TestMergedTmBodySpecVersionConflict(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFiles([]string{"./testdata/split/assets.hcl", "./testdata/tm1.hcl"})
+	if err == nil {
+		t.Fatal("Expected an error for mismatched spec_version values")
+	}
+
+	if !strings.Contains(err.Error(), "Conflicting argument") {
+		t.Errorf("Expected a conflicting argument error, got: %s", err)
+	}
+}
+
+func TestSourceFilesUseParsedBytes(t *testing.T) {
+	// tm1.hcl exists on disk with different content, so the source has to come
+	// from what was parsed rather than the file
+	filename := "./testdata/tm1.hcl"
+
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseHCL([]byte("locals {\n  note = \"in memory\"\n}\n"), filename)
+	if diags.HasErrors() {
+		t.Fatalf("Error parsing legit TM file: %s", diags)
+	}
+
+	sources := newSourceFiles(f)
+
+	attr := f.Body.(*hclsyntax.Body).Blocks[0].Body.Attributes["note"]
+	src := string(sources.rangeSource(attr.SrcRange))
+	if src != `note = "in memory"` {
+		t.Errorf("Expected the parsed source, got '%s'", src)
+	}
+
+	missing := attr.SrcRange
+	missing.Filename = "./testdata/tm1.json"
+	if src := sources.rangeSource(missing); src != nil {
+		t.Errorf("Expected no source for a file that wasn't parsed, got '%s'", src)
+	}
+}
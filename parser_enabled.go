@@ -0,0 +1,149 @@
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// enabledBlockTypes are the blocks that accept the enabled meta-argument
+var enabledBlockTypes = map[string]bool{
+	"threat":                 true,
+	"control":                true,
+	"third_party_dependency": true,
+	"process":                true,
+	"external_element":       true,
+	"data_store":             true,
+	"flow":                   true,
+}
+
+// DroppedBlock is a block that was left out of the parsed model because its
+// enabled expression was false.
+type DroppedBlock struct {
+	// Threatmodel is the name of the threat model the block was in
+	Threatmodel string
+	// Kind is the block's type, such as "threat", "control" or "process"
+	Kind string
+	// Name is the block's label. Instances of a for_each block are named
+	// "<label>[<key>]".
+	Name string
+	// Condition is the source of the enabled expression, such as
+	// "var.handles_card_data"
+	Condition string
+	// Range is where the block is defined
+	Range hcl.Range
+}
+
+func (d DroppedBlock) String() string {
+	element := d.Kind
+	if d.Name != "" {
+		element = fmt.Sprintf("%s '%s'", d.Kind, d.Name)
+	}
+
+	return fmt.Sprintf("TM '%s': %s was dropped as enabled (%s) is false, at %s", d.Threatmodel, element, d.Condition, d.Range)
+}
+
+// DroppedBlocks returns every block that was left out of the parsed threat
+// models (and the threat models they include) because its enabled expression
+// was false, in the order they appear in each file, with ParseFiles taking the
+// files in the order they were given.
+func (p *ThreatmodelParser) DroppedBlocks() []DroppedBlock {
+	p.resultsMu.RLock()
+	defer p.resultsMu.RUnlock()
+
+	return p.droppedBlocks
+}
+
+// sortDroppedBlocks puts dropped, which gohcl decodes in no particular order,
+// back in the order they appear in f. When f merges several files (see
+// ParseFiles) they're ordered by file first, in the order the files were
+// given, then by where they are in the file.
+func sortDroppedBlocks(dropped []DroppedBlock, f *hcl.File) {
+	bodies, ok := f.Body.(mergedTmBody)
+	if !ok {
+		bodies = mergedTmBody{f.Body}
+	}
+
+	fileOrder := make(map[string]int, len(bodies))
+	for i, body := range bodies {
+		filename := body.MissingItemRange().Filename
+		if _, seen := fileOrder[filename]; !seen {
+			fileOrder[filename] = i
+		}
+	}
+
+	sort.SliceStable(dropped, func(i, j int) bool {
+		a, b := dropped[i].Range, dropped[j].Range
+		if a.Filename == b.Filename {
+			return a.Start.Byte < b.Start.Byte
+		}
+
+		aOrder, aKnown := fileOrder[a.Filename]
+		bOrder, bKnown := fileOrder[b.Filename]
+		switch {
+		case aKnown && bKnown:
+			return aOrder < bOrder
+		case aKnown != bKnown:
+			return aKnown
+		default:
+			return a.Filename < b.Filename
+		}
+	})
+}
+
+// keepEnabled evaluates the enabled attribute of blk, which may be an instance
+// of a for_each block, reporting whether it's true. A block that isn't kept is
+// added to the dropped blocks.
+func (b *forEachBody) keepEnabled(blk *hcl.Block, enabled *hcl.Attribute) (bool, hcl.Diagnostics) {
+	instance, ok := blk.Body.(*forEachBody)
+	if !ok {
+		return true, nil
+	}
+
+	val, diags := instance.wrapAttr(enabled).Expr.Value(b.exp.ctx)
+	if diags.HasErrors() {
+		return false, diags
+	}
+
+	if val.IsNull() || !val.IsWhollyKnown() {
+		return false, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid enabled",
+			Detail:   "enabled must be a known bool.",
+			Subject:  enabled.Expr.Range().Ptr(),
+		}}
+	}
+
+	val, err := convert.Convert(val, cty.Bool)
+	if err != nil {
+		return false, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid enabled",
+			Detail:   fmt.Sprintf("enabled must be a bool: %s", err),
+			Subject:  enabled.Expr.Range().Ptr(),
+		}}
+	}
+
+	if val.True() {
+		return true, nil
+	}
+
+	var name string
+	if len(blk.Labels) > 0 {
+		name = blk.Labels[len(blk.Labels)-1]
+	}
+
+	b.exp.dropped = append(b.exp.dropped, DroppedBlock{
+		Threatmodel: instance.tm,
+		Kind:        blk.Type,
+		Name:        name,
+		Condition:   strings.TrimSpace(string(b.exp.sources.rangeSource(enabled.Expr.Range()))),
+		Range:       blk.DefRange,
+	})
+
+	return false, nil
+}
@@ -0,0 +1,213 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithEnabled(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-enabled.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	threats := []string{}
+	for _, threat := range tm.Threats {
+		threats = append(threats, threat.Name)
+	}
+	if strings.Join(threats, ", ") != "credential stuffing, admin takeover[admin]" {
+		t.Errorf("Incorrect threats: %s", strings.Join(threats, ", "))
+	}
+
+	if len(tm.Threats[0].Controls) != 1 || tm.Threats[0].Controls[0].Name != "rate limiting" {
+		t.Errorf("Incorrect controls: %+v", tm.Threats[0].Controls)
+	}
+
+	if len(tm.ThirdPartyDependencies) != 0 {
+		t.Errorf("Expected no third party dependencies, got %d", len(tm.ThirdPartyDependencies))
+	}
+
+	dfd := tm.DataFlowDiagrams[0]
+	if len(dfd.DataStores) != 0 || len(dfd.Flows) != 1 || dfd.Flows[0].Name != "https" {
+		t.Errorf("Incorrect dfd elements: %+v %+v", dfd.DataStores, dfd.Flows)
+	}
+
+	dropped := []string{}
+	for _, d := range tmParser.DroppedBlocks() {
+		if d.Threatmodel != "enabled" || d.Range.Filename != "./testdata/tm-enabled.hcl" {
+			t.Errorf("Incorrect dropped block: %+v", d)
+		}
+		dropped = append(dropped, d.Kind+" "+d.Name+": "+d.Condition)
+	}
+	expected := []string{
+		"threat card skimming: var.handles_card_data",
+		"control pci scope reduction: var.handles_card_data",
+		"threat admin takeover[api]: each.key == \"admin\"",
+		"third_party_dependency payment gateway: var.handles_card_data",
+		"data_store cards: var.handles_card_data",
+		"flow store: var.handles_card_data",
+	}
+	if strings.Join(dropped, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Incorrect dropped blocks:\n%s", strings.Join(dropped, "\n"))
+	}
+
+	exp := "TM 'enabled': threat 'card skimming' was dropped as enabled (var.handles_card_data) is false"
+	if !strings.HasPrefix(tmParser.DroppedBlocks()[0].String(), exp) {
+		t.Errorf("'%s' doesn't start with '%s'", tmParser.DroppedBlocks()[0], exp)
+	}
+}
+
+func TestParseFilesWithEnabled(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	// The second file's dropped block comes before the first file's in
+	// bytes, but they're still reported file by file
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.hcl": `spec_version = "0.1.17"
+
+threatmodel "split" {
+  author      = "@me"
+  description = "A threat model whose threats are split across two files"
+
+  threat "kept" {
+    description = "A threat that's kept"
+  }
+
+  threat "first" {
+    enabled     = false
+    description = "A threat that's dropped"
+  }
+}
+`,
+		"b.hcl": `threatmodel "split" {
+  threat "second" {
+    enabled     = false
+    description = "A threat that's dropped"
+  }
+}
+`,
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("Error writing file: %s", err)
+		}
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.ParseFiles([]string{filepath.Join(dir, "a.hcl"), filepath.Join(dir, "b.hcl")})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	dropped := []string{}
+	for _, d := range tmParser.DroppedBlocks() {
+		dropped = append(dropped, filepath.Base(d.Range.Filename)+": "+d.Name)
+	}
+	if strings.Join(dropped, ", ") != "a.hcl: first, b.hcl: second" {
+		t.Errorf("Incorrect dropped blocks: %s", strings.Join(dropped, ", "))
+	}
+}
+
+func TestParseHCLFileWithEnabledOverride(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetVariables(map[string]string{"handles_card_data": "true"})
+
+	err := tmParser.ParseHCLFile("./testdata/tm-enabled.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if len(tm.Threats) != 3 || len(tm.ThirdPartyDependencies) != 1 || len(tm.DataFlowDiagrams[0].Flows) != 2 {
+		t.Errorf("Expected the card data blocks to be kept: %+v", tm)
+	}
+
+	if len(tmParser.DroppedBlocks()) != 1 {
+		t.Errorf("Expected 1 dropped block, got %v", tmParser.DroppedBlocks())
+	}
+}
+
+func TestParseHCLRawEnabledErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name    string
+		enabled string
+		exp     string
+	}{
+		{
+			"string",
+			`"maybe"`,
+			"enabled must be a bool",
+		},
+		{
+			"null",
+			`null`,
+			"enabled must be a known bool",
+		},
+		{
+			"unknown_variable",
+			`var.nope`,
+			"Unknown variable",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  threat "t" {
+    enabled     = ` + tc.enabled + `
+    description = "words"
+  }
+}
+`))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawEnabledUnsupported(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	// Only the listed block types take enabled
+	err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  information_asset "a" {
+    enabled     = false
+    description = "words"
+  }
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "Unsupported argument") {
+		t.Errorf("Expected an unsupported argument error, got '%v'", err)
+	}
+}
@@ -0,0 +1,164 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultFetchConcurrency is how many sources a parser fetches at once,
+// unless changed with SetFetchConcurrency.
+const DefaultFetchConcurrency = 4
+
+// SetFetchConcurrency sets how many `imports` and `including` sources are
+// fetched at once. Sources are still merged in the order they're listed, and
+// the first one (in that order) that fails is the error returned, however
+// long each takes.
+func (p *ThreatmodelParser) SetFetchConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.fetchConcurrency = n
+}
+
+// fetchSession holds every source fetched during one parse, including by
+// sub-parsers, so each distinct source is only fetched once, and everything
+// fetched can be cleaned up once the parse is done
+type fetchSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	fetches map[string]*fetchResult
+}
+
+// fetchResult is a source that's being, or has been, fetched. done is closed
+// once resolved or err is set.
+type fetchResult struct {
+	done     chan struct{}
+	resolved *ResolvedSource
+	err      error
+}
+
+// beginFetch starts the fetch session for a parse, unless p already has one
+// (as sub-parsers share their parent's). The returned end must be called once
+// the parse is done: it stops any fetches that are still running, and cleans
+// up everything that was fetched.
+func (p *ThreatmodelParser) beginFetch(ctx context.Context) (context.Context, func()) {
+	if p.fetches != nil {
+		return ctx, func() {}
+	}
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	s := &fetchSession{
+		ctx:     sessionCtx,
+		cancel:  cancel,
+		sem:     make(chan struct{}, p.fetchConcurrency),
+		fetches: make(map[string]*fetchResult),
+	}
+	p.fetches = s
+
+	return sessionCtx, func() {
+		p.fetches = nil
+		s.end()
+	}
+}
+
+func (s *fetchSession) end() {
+	s.cancel()
+	s.wg.Wait()
+
+	for _, f := range s.fetches {
+		if f.resolved != nil {
+			f.resolved.cleanup()
+		}
+	}
+}
+
+// prefetch starts fetching each source in the background, so that fetch
+// finds them ready (or in progress) when they're needed in order
+func (p *ThreatmodelParser) prefetch(sources []string, baseDir string) {
+	if p.fetches == nil || len(sources) < 2 {
+		return
+	}
+
+	for _, source := range sources {
+		f, start := p.fetches.result(source, baseDir)
+		if f == nil || !start {
+			continue
+		}
+
+		s := p.fetches
+		s.wg.Add(1)
+		go func(source string) {
+			defer s.wg.Done()
+			p.runFetch(s, f, source, baseDir)
+		}(source)
+	}
+}
+
+// fetch resolves source against baseDir, sharing the result with any other
+// fetch of the same source during the parse. The result is cleaned up when
+// the parse ends, rather than by the caller.
+func (p *ThreatmodelParser) fetch(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	s := p.fetches
+	if s == nil {
+		return p.resolveSource(ctx, source, baseDir)
+	}
+
+	f, start := s.result(source, baseDir)
+	if f == nil {
+		return p.resolveSource(ctx, source, baseDir)
+	}
+
+	if start {
+		p.runFetch(s, f, source, baseDir)
+	}
+
+	select {
+	case <-f.done:
+		return f.resolved, f.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("can't fetch '%s': %w", source, ctx.Err())
+	}
+}
+
+// result returns the fetch of source, and whether the caller has to start
+// it. Sources are the same if they normalize to the same thing; one that
+// can't be normalized isn't shared, and nil is returned.
+func (s *fetchSession) result(source, baseDir string) (*fetchResult, bool) {
+	key, err := normalizeSource(source, baseDir)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.fetches[key]; ok {
+		return f, false
+	}
+
+	f := &fetchResult{done: make(chan struct{})}
+	s.fetches[key] = f
+
+	return f, true
+}
+
+// runFetch resolves source into f, waiting for one of the session's fetch
+// slots first
+func (p *ThreatmodelParser) runFetch(s *fetchSession, f *fetchResult, source, baseDir string) {
+	defer close(f.done)
+
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	case <-s.ctx.Done():
+		f.err = fmt.Errorf("can't fetch '%s': %w", source, s.ctx.Err())
+		return
+	}
+
+	f.resolved, f.err = p.resolveSource(s.ctx, source, baseDir)
+}
@@ -0,0 +1,186 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowResolver delays each source by its own amount before passing it on
+type slowResolver struct {
+	next   SourceResolver
+	delays map[string]time.Duration
+}
+
+func (r *slowResolver) Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	select {
+	case <-time.After(r.delays[source]):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return r.next.Resolve(ctx, source, baseDir)
+}
+
+func fetchTestFake(n int) *FakeResolver {
+	fake := &FakeResolver{Sources: map[string]string{}}
+	for i := 0; i < n; i++ {
+		fake.Sources[fmt.Sprintf("inc%d.hcl", i)] = fmt.Sprintf(`threatmodel "inc%d" {
+  author = "@me"
+
+  threat "threat_%d" {
+    description = "From inc%d"
+  }
+}
+`, i, i, i)
+	}
+
+	return fake
+}
+
+func TestParallelFetch(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	fake := fetchTestFake(4)
+	fake.Delay = 200 * time.Millisecond
+	tmParser.SetSourceResolver(fake)
+	tmParser.SetFetchConcurrency(4)
+
+	start := time.Now()
+	err := tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "tm" {
+  author    = "@me"
+  including = ["inc0.hcl", "inc1.hcl", "inc2.hcl", "inc3.hcl"]
+}
+`), RawParseOptions{})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Errorf("Expected the sources to be fetched concurrently, took %s", elapsed)
+	}
+
+	threats := []string{}
+	for _, th := range tmParser.GetWrapped().Threatmodels[0].Threats {
+		threats = append(threats, th.Name)
+	}
+	if strings.Join(threats, ",") != "threat_0,threat_1,threat_2,threat_3" {
+		t.Errorf("Expected the threats in including order, got %v", threats)
+	}
+}
+
+func TestParallelFetchOrder(t *testing.T) {
+	// Later sources finish first, but are still merged in the order listed
+	delays := map[string]time.Duration{
+		"inc0.hcl": 60 * time.Millisecond,
+		"inc1.hcl": 40 * time.Millisecond,
+		"inc2.hcl": 20 * time.Millisecond,
+		"inc3.hcl": 0,
+	}
+
+	for i := 0; i < 3; i++ {
+		defaultCfg := &ThreatmodelSpecConfig{}
+		defaultCfg.setDefaults()
+		tmParser := NewThreatmodelParser(defaultCfg)
+		tmParser.SetSourceResolver(&slowResolver{next: fetchTestFake(4), delays: delays})
+
+		err := tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "tm" {
+  author    = "@me"
+  including = ["inc0.hcl", "inc1.hcl", "inc2.hcl", "inc3.hcl"]
+
+  threat "own" {
+    description = "words"
+  }
+}
+`), RawParseOptions{})
+		if err != nil {
+			t.Fatalf("Error parsing legit TM file: %s", err)
+		}
+
+		threats := []string{}
+		for _, th := range tmParser.GetWrapped().Threatmodels[0].Threats {
+			threats = append(threats, th.Name)
+		}
+		if strings.Join(threats, ",") != "own,threat_0,threat_1,threat_2,threat_3" {
+			t.Errorf("Expected the threats in including order, got %v", threats)
+		}
+	}
+}
+
+func TestParallelFetchError(t *testing.T) {
+	// The first source listed that fails is the error, even though a later
+	// one fails sooner
+	delays := map[string]time.Duration{
+		"missing_slow.hcl": 80 * time.Millisecond,
+		"inc0.hcl":         0,
+		"missing_fast.hcl": 0,
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceResolver(&slowResolver{next: fetchTestFake(1), delays: delays})
+
+	err := tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "tm" {
+  author    = "@me"
+  including = ["missing_slow.hcl", "inc0.hcl", "missing_fast.hcl"]
+}
+`), RawParseOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	exp := "can't fetch 'missing_slow.hcl'"
+	if !strings.Contains(err.Error(), exp) {
+		t.Errorf("Error '%s' doesn't contain '%s'", err, exp)
+	}
+}
+
+func TestFetchDedup(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	fake := fetchTestFake(2)
+	fake.Sources["controls.hcl"] = `component "control" "mfa" {
+  description = "Use MFA"
+}
+`
+	tmParser.SetSourceResolver(fake)
+
+	err := tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "one" {
+  author    = "@me"
+  imports   = ["controls.hcl", "./controls.hcl"]
+  including = ["inc0.hcl", "inc1.hcl"]
+}
+
+threatmodel "two" {
+  author    = "@me"
+  including = ["inc1.hcl", "./inc0.hcl"]
+}
+`), RawParseOptions{})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	counts := map[string]int{}
+	for _, source := range fake.Resolved() {
+		counts[strings.TrimPrefix(source, "./")]++
+	}
+
+	for _, source := range []string{"controls.hcl", "inc0.hcl", "inc1.hcl"} {
+		if counts[source] != 1 {
+			t.Errorf("Expected '%s' to be fetched once, got %d", source, counts[source])
+		}
+	}
+
+	for _, tm := range tmParser.GetWrapped().Threatmodels {
+		if len(tm.Threats) != 2 {
+			t.Errorf("Expected TM '%s' to include 2 threats, got %d", tm.Name, len(tm.Threats))
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// forEachBlockTypes are the blocks that accept the for_each meta-argument
+var forEachBlockTypes = map[string]bool{
+	"threat":            true,
+	"control":           true,
+	"information_asset": true,
+	"process":           true,
+	"flow":              true,
+}
+
+// forEachBody wraps an hcl.Body so any for_each blocks within it are expanded
+// into one block per element, and any blocks whose enabled is false are
+// dropped (see parser_enabled.go), before gohcl decodes them. Each instance is
+// labelled "<label>[<key>]", and its expressions can refer to each.key and
+// each.value.
+type forEachBody struct {
+	hcl.Body
+
+	// each is the each object of the instance this body belongs to, or
+	// cty.NilVal outside of any for_each
+	each cty.Value
+
+	// meta are the meta-arguments of the block this body belongs to, which
+	// are dropped as they have no struct field
+	meta []string
+
+	// path identifies the body by the type and labels of the blocks leading
+	// to it, such as "/threatmodel/tm/threat/sqli[api]"
+	path string
+
+	// tm is the name of the threat model the body is in, if any
+	tm string
+
+	exp *forEachExpander
+}
+
+// forEachExpander holds what's shared by every forEachBody of one file
+type forEachExpander struct {
+	ctx     *hcl.EvalContext
+	sources sourceFiles
+
+	// origins is the source of each for_each block, by the path of the block
+	// as written (without an instance key)
+	origins map[string][]byte
+
+	// instances maps the path of every instance to the path of the block it
+	// was expanded from
+	instances map[string]string
+
+	// dropped are the blocks left out because their enabled was false
+	dropped []DroppedBlock
+}
+
+func newForEachBody(f *hcl.File, sources sourceFiles, ctx *hcl.EvalContext) *forEachBody {
+	return &forEachBody{
+		Body: f.Body,
+		each: cty.NilVal,
+		exp: &forEachExpander{
+			ctx:       ctx,
+			sources:   sources,
+			origins:   make(map[string][]byte),
+			instances: make(map[string]string),
+		},
+	}
+}
+
+func (b *forEachBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := b.Body.Content(b.schema(schema))
+	return b.expand(content, diags)
+}
+
+func (b *forEachBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := b.Body.PartialContent(b.schema(schema))
+	content, diags = b.expand(content, diags)
+
+	if remain != nil {
+		remain = &forEachBody{Body: remain, each: b.each, meta: b.meta, path: b.path, tm: b.tm, exp: b.exp}
+	}
+
+	return content, remain, diags
+}
+
+func (b *forEachBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := b.Body.JustAttributes()
+	for _, name := range b.meta {
+		delete(attrs, name)
+	}
+
+	for name, attr := range attrs {
+		attrs[name] = b.wrapAttr(attr)
+	}
+
+	return attrs, diags
+}
+
+// schema adds the meta-arguments to the body's schema, so the underlying body
+// accepts them
+func (b *forEachBody) schema(schema *hcl.BodySchema) *hcl.BodySchema {
+	if len(b.meta) == 0 {
+		return schema
+	}
+
+	attrs := make([]hcl.AttributeSchema, 0, len(b.meta)+len(schema.Attributes))
+	for _, name := range b.meta {
+		attrs = append(attrs, hcl.AttributeSchema{Name: name})
+	}
+
+	withMeta := &hcl.BodySchema{
+		Attributes: append(attrs, schema.Attributes...),
+		Blocks:     schema.Blocks,
+	}
+	return withMeta
+}
+
+func (b *forEachBody) wrapAttr(attr *hcl.Attribute) *hcl.Attribute {
+	if b.each.IsNull() {
+		return attr
+	}
+
+	wrapped := *attr
+	wrapped.Expr = &eachExpr{Expression: attr.Expr, each: b.each}
+	return &wrapped
+}
+
+func (b *forEachBody) expand(content *hcl.BodyContent, diags hcl.Diagnostics) (*hcl.BodyContent, hcl.Diagnostics) {
+	if content == nil {
+		return content, diags
+	}
+
+	for _, name := range b.meta {
+		delete(content.Attributes, name)
+	}
+
+	for name, attr := range content.Attributes {
+		content.Attributes[name] = b.wrapAttr(attr)
+	}
+
+	blocks := make(hcl.Blocks, 0, len(content.Blocks))
+	for _, blk := range content.Blocks {
+		path := blockPath(b.path, blk.Type, blk.Labels)
+
+		tm := b.tm
+		if blk.Type == "threatmodel" && len(blk.Labels) > 0 {
+			tm = blk.Labels[0]
+		}
+
+		instances := hcl.Blocks{}
+		forEach := metaAttr(blk, "for_each", forEachBlockTypes)
+		if forEach == nil {
+			wrapped := *blk
+			wrapped.Body = &forEachBody{Body: blk.Body, each: b.each, meta: metaArguments(blk.Type), path: path, tm: tm, exp: b.exp}
+			instances = append(instances, &wrapped)
+		} else {
+			var instanceDiags hcl.Diagnostics
+			instances, instanceDiags = b.instances(blk, forEach, path, tm)
+			diags = append(diags, instanceDiags...)
+		}
+
+		enabled := metaAttr(blk, "enabled", enabledBlockTypes)
+		if enabled == nil {
+			blocks = append(blocks, instances...)
+			continue
+		}
+
+		for _, instance := range instances {
+			keep, enabledDiags := b.keepEnabled(instance, enabled)
+			diags = append(diags, enabledDiags...)
+			if keep {
+				blocks = append(blocks, instance)
+			}
+		}
+	}
+	content.Blocks = blocks
+
+	return content, diags
+}
+
+// metaArguments are the meta-arguments a block of type typeName accepts
+func metaArguments(typeName string) []string {
+	meta := []string{}
+	if forEachBlockTypes[typeName] {
+		meta = append(meta, "for_each")
+	}
+	if enabledBlockTypes[typeName] {
+		meta = append(meta, "enabled")
+	}
+
+	return meta
+}
+
+// metaAttr returns blk's meta-argument name, if blk is one of the types that
+// can have it
+func metaAttr(blk *hcl.Block, name string, types map[string]bool) *hcl.Attribute {
+	if !types[blk.Type] {
+		return nil
+	}
+
+	content, _, _ := blk.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: name}},
+	})
+	if content == nil {
+		return nil
+	}
+
+	return content.Attributes[name]
+}
+
+// instances expands blk into a block per element of its for_each
+func (b *forEachBody) instances(blk *hcl.Block, forEach *hcl.Attribute, path, tm string) (hcl.Blocks, hcl.Diagnostics) {
+	if len(blk.Labels) == 0 {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid for_each",
+			Detail:   fmt.Sprintf("A %s block needs a label to use for_each.", blk.Type),
+			Subject:  forEach.Range.Ptr(),
+		}}
+	}
+
+	val, diags := b.wrapAttr(forEach).Expr.Value(b.exp.ctx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	elements, err := forEachElements(val)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid for_each",
+			Detail:   err.Error(),
+			Subject:  forEach.Expr.Range().Ptr(),
+		}}
+	}
+
+	b.exp.origins[path] = blockSource(b.exp.sources, blk)
+
+	name := blk.Labels[len(blk.Labels)-1]
+	blocks := make(hcl.Blocks, 0, len(elements))
+	for _, e := range elements {
+		instance := *blk
+		instance.Labels = append([]string{}, blk.Labels...)
+		instance.Labels[len(instance.Labels)-1] = fmt.Sprintf("%s[%s]", name, e.key)
+
+		instancePath := blockPath(b.path, blk.Type, instance.Labels)
+		b.exp.instances[instancePath] = path
+
+		instance.Body = &forEachBody{
+			Body: blk.Body,
+			each: cty.ObjectVal(map[string]cty.Value{
+				"key":   cty.StringVal(e.key),
+				"value": e.value,
+			}),
+			meta: metaArguments(blk.Type),
+			path: instancePath,
+			tm:   tm,
+			exp:  b.exp,
+		}
+		blocks = append(blocks, &instance)
+	}
+
+	return blocks, nil
+}
+
+// blockPath is the path of a block of type typeName with labels, inside the
+// body at parentPath
+func blockPath(parentPath, typeName string, labels []string) string {
+	return strings.Join(append([]string{parentPath, typeName}, labels...), "/")
+}
+
+type forEachElement struct {
+	key   string
+	value cty.Value
+}
+
+// forEachElements reads a for_each value, which is either a map or object
+// (keyed by its keys) or a set or list of strings (keyed by the strings)
+func forEachElements(val cty.Value) ([]forEachElement, error) {
+	if val.IsNull() || !val.IsWhollyKnown() {
+		return nil, fmt.Errorf("for_each must be a known map, or set of strings")
+	}
+
+	ty := val.Type()
+	elements := []forEachElement{}
+	switch {
+	case ty.IsMapType() || ty.IsObjectType():
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			elements = append(elements, forEachElement{key: k.AsString(), value: v})
+		}
+	case ty.IsSetType() || ty.IsListType() || ty.IsTupleType():
+		seen := make(map[string]bool)
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			if v.IsNull() || !v.Type().Equals(cty.String) {
+				return nil, fmt.Errorf("for_each must be a map, or set of strings, but it has a %s element", v.Type().FriendlyName())
+			}
+
+			key := v.AsString()
+			if seen[key] {
+				return nil, fmt.Errorf("for_each has the duplicate key '%s'", key)
+			}
+			seen[key] = true
+
+			elements = append(elements, forEachElement{key: key, value: v})
+		}
+	default:
+		return nil, fmt.Errorf("for_each must be a map, or set of strings, not %s", ty.FriendlyName())
+	}
+
+	return elements, nil
+}
+
+// eachExpr evaluates an expression in a for_each instance, with each.key and
+// each.value available
+type eachExpr struct {
+	hcl.Expression
+	each cty.Value
+}
+
+func (e *eachExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	if ctx == nil {
+		ctx = &hcl.EvalContext{}
+	}
+
+	child := ctx.NewChild()
+	child.Variables = map[string]cty.Value{"each": e.each}
+
+	return e.Expression.Value(child)
+}
+
+// blockSource returns the source text of blk, or nil if it isn't native
+// syntax
+func blockSource(sources sourceFiles, blk *hcl.Block) []byte {
+	body, ok := blk.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	return sources.rangeSource(hcl.RangeBetween(blk.DefRange, body.SrcRange))
+}
+
+// sourceFiles is the source text of each parsed file, by filename, so the
+// source of a range can be found even when several files are merged (see
+// ParseFiles) or the input never came from disk
+type sourceFiles map[string][]byte
+
+func newSourceFiles(files ...*hcl.File) sourceFiles {
+	sources := make(sourceFiles, len(files))
+	for _, f := range files {
+		sources[f.Body.MissingItemRange().Filename] = f.Bytes
+	}
+
+	return sources
+}
+
+// rangeSource returns the source text of rng, or nil if it isn't in one of
+// the parsed files
+func (s sourceFiles) rangeSource(rng hcl.Range) []byte {
+	src, ok := s[rng.Filename]
+	if !ok {
+		return nil
+	}
+
+	if rng.Start.Byte > rng.End.Byte || rng.End.Byte > len(src) {
+		return nil
+	}
+
+	return append([]byte{}, src[rng.Start.Byte:rng.End.Byte]...)
+}
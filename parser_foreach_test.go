@@ -0,0 +1,179 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithForEach(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-foreach.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if len(tm.InformationAssets) != 2 || tm.InformationAssets[0].Name != "store[api]" ||
+		tm.InformationAssets[0].Description != "Data owned by platform for api" {
+		t.Errorf("Information assets weren't expanded: %+v", tm.InformationAssets)
+	}
+
+	if len(tm.Threats) != 2 {
+		t.Fatalf("Expected 2 threats, got %d", len(tm.Threats))
+	}
+
+	billing := tm.Threats[1]
+	if billing.Name != "sql injection[billing]" || billing.Description != "SQL injection against billing" {
+		t.Errorf("Incorrect threat instance: %+v", billing)
+	}
+
+	if len(billing.InformationAssetRefs) != 1 || billing.InformationAssetRefs[0] != "store[billing]" {
+		t.Errorf("Incorrect information asset refs: %v", billing.InformationAssetRefs)
+	}
+
+	// The outer each is visible to a control without its own for_each, and a
+	// control's for_each replaces it
+	controls := []string{}
+	for _, c := range billing.Controls {
+		controls = append(controls, c.Name+": "+c.Description)
+	}
+	expected := []string{
+		"parameterized queries: Queries in billing are parameterized",
+		"waf[edge]: WAF at the edge",
+		"waf[internal]: WAF at the internal",
+	}
+	if strings.Join(controls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Incorrect controls:\n%s", strings.Join(controls, "\n"))
+	}
+
+	dfd := tm.DataFlowDiagrams[0]
+	if len(dfd.Processes) != 2 || dfd.Processes[1].Name != "svc[billing]" {
+		t.Errorf("Processes weren't expanded: %+v", dfd.Processes)
+	}
+
+	if len(dfd.Flows) != 2 || dfd.Flows[0].Name != "https[api]" || dfd.Flows[0].To != "svc[api]" {
+		t.Errorf("Flows weren't expanded: %+v", dfd.Flows)
+	}
+}
+
+func TestParseHCLRawForEachErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name    string
+		forEach string
+		exp     string
+	}{
+		{
+			"number",
+			`4`,
+			"for_each must be a map, or set of strings, not number",
+		},
+		{
+			"list_of_numbers",
+			`[1, 2]`,
+			"but it has a number element",
+		},
+		{
+			"duplicate_key",
+			`["a", "a"]`,
+			"for_each has the duplicate key 'a'",
+		},
+		{
+			"unknown_variable",
+			`var.nope`,
+			"Unknown variable",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  threat "t" {
+    for_each    = ` + tc.forEach + `
+    description = "words"
+  }
+}
+`))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawForEachDuplicateName(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	// An expanded instance is validated like a hand-written process
+	err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  data_flow_diagram_v2 "dfd" {
+    process "svc[a]" {}
+
+    process "svc" {
+      for_each = ["a", "b"]
+    }
+  }
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "duplicate process found in dfd 'svc[a]'") {
+		t.Errorf("Expected a duplicate process error, got '%v'", err)
+	}
+}
+
+func TestHclStringForEachForms(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-foreach.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	expanded := tmParser.HclString()
+	if strings.Contains(expanded, "for_each") || !strings.Contains(expanded, `threat "sql injection[api]"`) {
+		t.Errorf("Expected the expanded form:\n%s", expanded)
+	}
+
+	compact := tmParser.HclStringWithOptions(HclStringOptions{Compact: true})
+	if strings.Count(compact, "for_each") != 5 || strings.Contains(compact, "sql injection[api]") {
+		t.Errorf("Expected the compact form:\n%s", compact)
+	}
+
+	if !strings.Contains(compact, "locals {") {
+		t.Errorf("Expected the compact form to keep locals:\n%s", compact)
+	}
+
+	for _, out := range []string{expanded, compact} {
+		p := NewThreatmodelParser(defaultCfg)
+		err = p.ParseHCLRaw([]byte(out))
+		if err != nil {
+			t.Fatalf("round-trip parse failed:\n--- HCL ---\n%s\n--- ERR ---\n%s", out, err)
+		}
+
+		tm := p.GetWrapped().Threatmodels[0]
+		if len(tm.Threats) != 2 || len(tm.Threats[0].Controls) != 3 || len(tm.DataFlowDiagrams[0].Flows) != 2 {
+			t.Errorf("Round trip lost instances:\n%s", out)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// SetSourceFS resolves local `imports` and `including` sources from fsys
+// instead of the filesystem (see FSResolver), in front of the parser's
+// SourceResolver. The file functions, such as file and templatefile, read
+// from fsys as well, so nothing on the filesystem can be read at all. Paths
+// are resolved as if fsys were mounted at the filesystem root, so it's mostly
+// useful with the raw parse variants (see ParseHCLRawWithOptions), where the
+// input's BaseDir is a directory within fsys. An AllowlistResolver set with
+// SetSourceResolver still checks every source, including those read from
+// fsys, with its Root being a directory within fsys. A nil fsys restores the
+// default.
+func (p *ThreatmodelParser) SetSourceFS(fsys fs.FS) {
+	p.sourceFS = fsys
+}
+
+// FSResolver reads local sources from FS, as if it were mounted at the
+// filesystem root, and passes remote sources on to Next. Local sources can't
+// refer to anything outside of FS.
+type FSResolver struct {
+	FS fs.FS
+	// Next fetches remote sources. Defaults to a GetterResolver.
+	Next SourceResolver
+}
+
+func (r *FSResolver) Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	normalized, err := normalizeSource(source, baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isLocalSource(normalized) {
+		next := r.Next
+		if next == nil {
+			next = &GetterResolver{}
+		}
+
+		return next.Resolve(ctx, source, baseDir)
+	}
+
+	path := localSourcePath(normalized)
+
+	content, err := fs.ReadFile(r.FS, fsPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("can't read '%s': %w", source, err)
+	}
+
+	return &ResolvedSource{Path: path, Content: content}, nil
+}
+
+// fsPath converts an absolute path into the equivalent fs.FS path
+func fsPath(path string) string {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	path = strings.TrimPrefix(filepath.ToSlash(path), "/")
+
+	if path == "" {
+		return "."
+	}
+
+	return path
+}
@@ -0,0 +1,361 @@
+package spec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// hclFunctions returns the functions available to threat model expressions.
+// The file functions read paths relative to baseDir, the directory of the
+// threat model file (the same directory relative imports are resolved from),
+// and can't read anything outside of it. If fsys is set they read from it
+// instead of the filesystem, in the same way as local sources (see
+// SetSourceFS).
+func hclFunctions(baseDir string, fsys fs.FS) map[string]function.Function {
+	files := modelFiles{baseDir: baseDir, fsys: fsys}
+
+	funcs := map[string]function.Function{
+		// strings
+		"chomp":         stdlib.ChompFunc,
+		"format":        stdlib.FormatFunc,
+		"formatlist":    stdlib.FormatListFunc,
+		"indent":        stdlib.IndentFunc,
+		"join":          stdlib.JoinFunc,
+		"lower":         stdlib.LowerFunc,
+		"regex":         stdlib.RegexFunc,
+		"regexall":      stdlib.RegexAllFunc,
+		"regex_replace": stdlib.RegexReplaceFunc,
+		"replace":       stdlib.ReplaceFunc,
+		"split":         stdlib.SplitFunc,
+		"strlen":        stdlib.StrlenFunc,
+		"strrev":        stdlib.ReverseFunc,
+		"substr":        stdlib.SubstrFunc,
+		"title":         stdlib.TitleFunc,
+		"trim":          stdlib.TrimFunc,
+		"trimprefix":    stdlib.TrimPrefixFunc,
+		"trimspace":     stdlib.TrimSpaceFunc,
+		"trimsuffix":    stdlib.TrimSuffixFunc,
+		"upper":         stdlib.UpperFunc,
+
+		// collections
+		"chunklist":    stdlib.ChunklistFunc,
+		"coalesce":     stdlib.CoalesceFunc,
+		"coalescelist": stdlib.CoalesceListFunc,
+		"compact":      stdlib.CompactFunc,
+		"concat":       stdlib.ConcatFunc,
+		"contains":     stdlib.ContainsFunc,
+		"distinct":     stdlib.DistinctFunc,
+		"element":      stdlib.ElementFunc,
+		"flatten":      stdlib.FlattenFunc,
+		"keys":         stdlib.KeysFunc,
+		"length":       stdlib.LengthFunc,
+		"lookup":       stdlib.LookupFunc,
+		"merge":        stdlib.MergeFunc,
+		"range":        stdlib.RangeFunc,
+		"reverse":      stdlib.ReverseListFunc,
+		"setunion":     stdlib.SetUnionFunc,
+		"slice":        stdlib.SliceFunc,
+		"sort":         stdlib.SortFunc,
+		"values":       stdlib.ValuesFunc,
+		"zipmap":       stdlib.ZipmapFunc,
+
+		// numbers
+		"abs":      stdlib.AbsoluteFunc,
+		"ceil":     stdlib.CeilFunc,
+		"floor":    stdlib.FloorFunc,
+		"max":      stdlib.MaxFunc,
+		"min":      stdlib.MinFunc,
+		"parseint": stdlib.ParseIntFunc,
+
+		// type conversion
+		"tobool":   makeToFunc(cty.Bool),
+		"tolist":   makeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tonumber": makeToFunc(cty.Number),
+		"toset":    makeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"tostring": makeToFunc(cty.String),
+
+		// encoding
+		"base64decode": base64DecodeFunc,
+		"base64encode": base64EncodeFunc,
+		"csvdecode":    stdlib.CSVDecodeFunc,
+		"jsondecode":   stdlib.JSONDecodeFunc,
+		"jsonencode":   stdlib.JSONEncodeFunc,
+		"urlencode":    urlEncodeFunc,
+
+		// files
+		"file":       makeFileFunc(files, false),
+		"filebase64": makeFileFunc(files, true),
+		"fileexists": makeFileExistsFunc(files),
+	}
+
+	// A template can use every function other than templatefile itself
+	templateFuncs := make(map[string]function.Function, len(funcs))
+	for name, f := range funcs {
+		templateFuncs[name] = f
+	}
+	funcs["templatefile"] = makeTemplateFileFunc(files, templateFuncs)
+
+	return funcs
+}
+
+// modelBaseDir is the directory file functions and relative imports are
+// resolved from for the threat model at filename
+func modelBaseDir(filename string) (string, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Dir(absPath), nil
+}
+
+// resolveModelPath resolves path, which must be relative, against baseDir and
+// makes sure it doesn't lead outside of baseDir, including through symlinks
+func resolveModelPath(baseDir, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("'%s' must be relative to the threat model's directory", path)
+	}
+
+	full := filepath.Join(baseDir, path)
+	if !withinDir(baseDir, full) {
+		return "", fmt.Errorf("'%s' is outside the threat model's directory", path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		// It doesn't exist, so reading it will fail on its own
+		return full, nil
+	}
+
+	resolvedBase, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	if !withinDir(resolvedBase, resolved) {
+		return "", fmt.Errorf("'%s' is outside the threat model's directory", path)
+	}
+
+	return full, nil
+}
+
+// modelFiles is where the file functions read from
+type modelFiles struct {
+	baseDir string
+	// fsys, if set, is read from instead of the filesystem, as if it were
+	// mounted at the filesystem root
+	fsys fs.FS
+}
+
+// resolve returns the full path of path, which must be relative to baseDir
+// and within it
+func (m modelFiles) resolve(path string) (string, error) {
+	if m.fsys == nil {
+		return resolveModelPath(m.baseDir, path)
+	}
+
+	// Nothing outside of fsys can be reached through it, so only the path
+	// itself has to stay within baseDir
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("'%s' must be relative to the threat model's directory", path)
+	}
+
+	full := filepath.Join(m.baseDir, path)
+	if !withinDir(m.baseDir, full) {
+		return "", fmt.Errorf("'%s' is outside the threat model's directory", path)
+	}
+
+	return full, nil
+}
+
+func (m modelFiles) readFile(full string) ([]byte, error) {
+	if m.fsys == nil {
+		return os.ReadFile(full)
+	}
+
+	return fs.ReadFile(m.fsys, fsPath(full))
+}
+
+func (m modelFiles) stat(full string) (fs.FileInfo, error) {
+	if m.fsys == nil {
+		return os.Stat(full)
+	}
+
+	return fs.Stat(m.fsys, fsPath(full))
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func makeFileFunc(files modelFiles, encodeBase64 bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, err := files.resolve(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.String), err
+			}
+
+			src, err := files.readFile(path)
+			if err != nil {
+				return cty.UnknownVal(cty.String), fmt.Errorf("can't read '%s': %s", args[0].AsString(), err)
+			}
+
+			if encodeBase64 {
+				return cty.StringVal(base64.StdEncoding.EncodeToString(src)), nil
+			}
+
+			if !utf8.Valid(src) {
+				return cty.UnknownVal(cty.String), fmt.Errorf("'%s' isn't valid UTF-8, use filebase64 instead", args[0].AsString())
+			}
+
+			return cty.StringVal(string(src)), nil
+		},
+	})
+}
+
+func makeFileExistsFunc(files modelFiles) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, err := files.resolve(args[0].AsString())
+			if err != nil {
+				return cty.UnknownVal(cty.Bool), err
+			}
+
+			info, err := files.stat(path)
+			if err != nil {
+				return cty.False, nil
+			}
+
+			return cty.BoolVal(info.Mode().IsRegular()), nil
+		},
+	})
+}
+
+func makeTemplateFileFunc(files modelFiles, funcs map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+			{Name: "vars", Type: cty.DynamicPseudoType},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, err := files.resolve(args[0].AsString())
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+
+			src, err := files.readFile(path)
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("can't read '%s': %s", args[0].AsString(), err)
+			}
+
+			vars := args[1]
+			if !vars.Type().IsObjectType() && !vars.Type().IsMapType() {
+				return cty.DynamicVal, fmt.Errorf("templatefile vars must be an object or a map")
+			}
+
+			ctx := &hcl.EvalContext{
+				Variables: map[string]cty.Value{},
+				Functions: funcs,
+			}
+			for it := vars.ElementIterator(); it.Next(); {
+				k, v := it.Element()
+				ctx.Variables[k.AsString()] = v
+			}
+
+			expr, diags := hclsyntax.ParseTemplate(src, path, hcl.InitialPos)
+			if diags.HasErrors() {
+				return cty.DynamicVal, diags
+			}
+
+			val, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				return cty.DynamicVal, diags
+			}
+
+			return val, nil
+		},
+	})
+}
+
+func makeToFunc(ty cty.Type) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "v", Type: cty.DynamicPseudoType, AllowNull: true},
+		},
+		Type: function.StaticReturnType(ty),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			val, err := convert.Convert(args[0], ty)
+			if err != nil {
+				return cty.UnknownVal(ty), fmt.Errorf("can't convert to %s: %s", ty.FriendlyName(), err)
+			}
+			return val, nil
+		},
+	})
+}
+
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		decoded, err := base64.StdEncoding.DecodeString(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), fmt.Errorf("invalid base64: %s", err)
+		}
+
+		if !utf8.Valid(decoded) {
+			return cty.UnknownVal(cty.String), fmt.Errorf("the decoded value isn't valid UTF-8")
+		}
+
+		return cty.StringVal(string(decoded)), nil
+	},
+})
+
+var urlEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(url.QueryEscape(args[0].AsString())), nil
+	},
+})
@@ -0,0 +1,167 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithFunctions(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/functions/tm.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if tm.Description != "PAYMENTS stores cards, tokens\n" {
+		t.Errorf("Incorrect templatefile result: '%s'", tm.Description)
+	}
+
+	if tm.Link != "https://payments-prod.example.com" {
+		t.Errorf("Incorrect link: %s", tm.Link)
+	}
+
+	if tm.InformationAssets[0].Description != "payments-db" {
+		t.Errorf("Incorrect information asset description: %s", tm.InformationAssets[0].Description)
+	}
+
+	if tm.Threats[0].Description != "PROD" {
+		t.Errorf("Incorrect threat description: %s", tm.Threats[0].Description)
+	}
+
+	if tm.Threats[0].Control != "Sessions are bound to the client certificate." {
+		t.Errorf("Incorrect file result: '%s'", tm.Threats[0].Control)
+	}
+}
+
+func TestParseHCLFileFunctionValidation(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetVariables(map[string]string{"env": "dev"})
+
+	err := tmParser.ParseHCLFile("./testdata/functions/tm.hcl", false)
+	if err == nil || !strings.Contains(err.Error(), "env must be staging or prod") {
+		t.Errorf("Expected a validation error, got '%v'", err)
+	}
+}
+
+func TestParseHCLFileFunctionPaths(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	dir := t.TempDir()
+	modelDir := filepath.Join(dir, "model")
+	err := os.Mkdir(modelDir, 0o755)
+	if err != nil {
+		t.Fatalf("Error creating model dir: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	err = os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(modelDir, "link.txt"))
+	if err != nil {
+		t.Fatalf("Error creating symlink: %s", err)
+	}
+
+	cases := []struct {
+		name string
+		expr string
+		exp  string
+	}{
+		{
+			"parent_dir",
+			`file("../secret.txt")`,
+			"outside the threat model's directory",
+		},
+		{
+			"absolute",
+			`file("` + filepath.ToSlash(filepath.Join(dir, "secret.txt")) + `")`,
+			"must be relative to the threat model's directory",
+		},
+		{
+			"symlink",
+			`file("link.txt")`,
+			"outside the threat model's directory",
+		},
+		{
+			"missing",
+			`file("missing.txt")`,
+			"can't read 'missing.txt'",
+		},
+		{
+			"templatefile_parent_dir",
+			`templatefile("../secret.txt", {})`,
+			"outside the threat model's directory",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmFile := filepath.Join(modelDir, tc.name+".hcl")
+			err := os.WriteFile(tmFile, []byte("threatmodel \"tm\" {\n  author = \"@me\"\n  description = "+tc.expr+"\n}\n"), 0o644)
+			if err != nil {
+				t.Fatalf("Error writing TM file: %s", err)
+			}
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err = tmParser.ParseHCLFile(tmFile, false)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawFunctions(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		expr string
+		exp  string
+	}{
+		{"join", `join(", ", ["a", "b"])`, "a, b"},
+		{"replace", `replace("a-b-c", "-", "_")`, "a_b_c"},
+		{"base64", `base64decode(base64encode("words"))`, "words"},
+		{"urlencode", `urlencode("a b&c")`, "a+b%26c"},
+		{"jsonencode", `jsonencode({ a = 1 })`, `{"a":1}`},
+		{"length", `tostring(length(["a", "b", "c"]))`, "3"},
+		{"fileexists", `tostring(fileexists("nope.md"))`, "false"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte("threatmodel \"tm\" {\n  author = \"@me\"\n  description = " + tc.expr + "\n}\n"))
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			got := tmParser.GetWrapped().Threatmodels[0].Description
+			if got != tc.exp {
+				t.Errorf("Expected '%s', got '%s'", tc.exp, got)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
@@ -17,9 +18,115 @@ import (
 // list-of-objects attribute encoding (`control = [{...}]`), which doesn't
 // round-trip through the parser.
 func encodeWrappedToHCL(w *ThreatmodelWrapped) []byte {
+	return (&hclEncoder{}).encode(w)
+}
+
+// hclEncoder holds the state of one encoding. Its zero value writes each
+// for_each instance as a block of its own (the expanded form).
+type hclEncoder struct {
+	// compact writes the first instance of each for_each block as the
+	// original for_each block from forEachSources, skips the other
+	// instances, and writes out the locals they may refer to
+	compact          bool
+	forEachSources   map[string][]byte
+	forEachInstances map[string]string
+	written          map[string]bool
+}
+
+func (e *hclEncoder) encode(w *ThreatmodelWrapped) []byte {
+	encoded := *w
+
+	// Locals have already been substituted into the values that use them,
+	// and their expressions can't be encoded, so they're left out
+	encoded.Locals = nil
+
+	// Including and IncludingSources are decoded through IncludingRaw, so
+	// they're encoded the same way, as a single source or a list
+	encoded.Threatmodels = make([]Threatmodel, len(w.Threatmodels))
+	for i, tm := range w.Threatmodels {
+		switch {
+		case len(tm.IncludingSources) > 0:
+			sources := make([]cty.Value, 0, len(tm.IncludingSources))
+			for _, source := range tm.IncludingSources {
+				sources = append(sources, cty.StringVal(source))
+			}
+			tm.IncludingRaw = cty.ListVal(sources)
+		case tm.Including != "":
+			tm.IncludingRaw = cty.StringVal(tm.Including)
+		}
+		encoded.Threatmodels[i] = tm
+	}
+
 	f := hclwrite.NewEmptyFile()
-	encodeBody(f.Body(), reflect.ValueOf(w).Elem())
-	return f.Bytes()
+	e.written = make(map[string]bool)
+	e.encodeBody(f.Body(), reflect.ValueOf(&encoded).Elem(), "")
+
+	if !e.compact {
+		return f.Bytes()
+	}
+
+	// The compact form can refer to locals, so they're written back out from
+	// their source
+	for _, l := range w.Locals {
+		if len(l.src) == 0 {
+			continue
+		}
+
+		src := []byte("locals {\n")
+		for _, attrSrc := range l.src {
+			src = append(src, attrSrc...)
+			src = append(src, '\n')
+		}
+		src = append(src, "}\n"...)
+
+		f.Body().AppendNewline()
+		f.Body().AppendUnstructuredTokens(rawTokens(src))
+	}
+
+	return hclwrite.Format(f.Bytes())
+}
+
+var hclExpressionType = reflect.TypeOf((*hcl.Expression)(nil)).Elem()
+
+// exprSourcer is implemented by blocks with hcl.Expression fields to return
+// the source text of the expression for the named attribute
+type exprSourcer interface {
+	exprSource(attr string) []byte
+}
+
+// rawTokens turns the source text of a whole block or attribute back into
+// tokens, or nil if there's no source or it doesn't parse
+func rawTokens(src []byte) hclwrite.Tokens {
+	if len(src) == 0 {
+		return nil
+	}
+
+	f, diags := hclwrite.ParseConfig(src, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	return f.BuildTokens(nil)
+}
+
+// rawExprTokens turns an expression's source text back into tokens, or nil if
+// there's no source or it doesn't parse
+func rawExprTokens(src []byte) hclwrite.Tokens {
+	if len(src) == 0 {
+		return nil
+	}
+
+	f, diags := hclwrite.ParseConfig(append([]byte("expr = "), src...), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	attr := f.Body().GetAttribute("expr")
+	if attr == nil {
+		return nil
+	}
+
+	return attr.Expr().BuildTokens(nil)
 }
 
 type hclTagInfo struct {
@@ -38,12 +145,17 @@ func parseHclTag(t reflect.StructTag) hclTagInfo {
 	if len(parts) > 1 {
 		info.kind = parts[1]
 	}
+	// Source ranges (such as def_range) and bodies are filled in by the
+	// decoder, and aren't part of the document
+	if strings.HasSuffix(info.kind, "range") || info.kind == "body" {
+		info.skip = true
+	}
 	return info
 }
 
-// encodeBody writes the fields of struct value v into body. Attributes are
-// emitted before blocks so the output reads naturally.
-func encodeBody(body *hclwrite.Body, v reflect.Value) {
+// encodeBody writes the fields of struct value v, the body at path, into
+// body. Attributes are emitted before blocks so the output reads naturally.
+func (e *hclEncoder) encodeBody(body *hclwrite.Body, v reflect.Value, path string) {
 	for v.Kind() == reflect.Pointer {
 		if v.IsNil() {
 			return
@@ -61,6 +173,18 @@ func encodeBody(body *hclwrite.Body, v reflect.Value) {
 			continue
 		}
 		fv := v.Field(i)
+		if fv.Type() == hclExpressionType {
+			// An unevaluated expression has no value to encode, so it's
+			// written back out from its source text where that was kept
+			if v.CanAddr() {
+				if s, ok := v.Addr().Interface().(exprSourcer); ok {
+					if tokens := rawExprTokens(s.exprSource(tag.name)); tokens != nil {
+						body.SetAttributeRaw(tag.name, tokens)
+					}
+				}
+			}
+			continue
+		}
 		if tag.kind == "optional" && isZeroForHcl(fv) {
 			continue
 		}
@@ -76,11 +200,11 @@ func encodeBody(body *hclwrite.Body, v reflect.Value) {
 		if tag.skip || tag.kind != "block" {
 			continue
 		}
-		emitBlockField(body, tag.name, v.Field(i))
+		e.emitBlockField(body, tag.name, v.Field(i), path)
 	}
 }
 
-func emitBlockField(parent *hclwrite.Body, name string, fv reflect.Value) {
+func (e *hclEncoder) emitBlockField(parent *hclwrite.Body, name string, fv reflect.Value, path string) {
 	switch fv.Kind() {
 	case reflect.Slice, reflect.Array:
 		for i := 0; i < fv.Len(); i++ {
@@ -88,19 +212,19 @@ func emitBlockField(parent *hclwrite.Body, name string, fv reflect.Value) {
 			if elem.Kind() == reflect.Pointer && elem.IsNil() {
 				continue
 			}
-			emitOneBlock(parent, name, elem)
+			e.emitOneBlock(parent, name, elem, path)
 		}
 	case reflect.Pointer:
 		if fv.IsNil() {
 			return
 		}
-		emitOneBlock(parent, name, fv)
+		e.emitOneBlock(parent, name, fv, path)
 	case reflect.Struct:
-		emitOneBlock(parent, name, fv)
+		e.emitOneBlock(parent, name, fv, path)
 	}
 }
 
-func emitOneBlock(parent *hclwrite.Body, typeName string, elem reflect.Value) {
+func (e *hclEncoder) emitOneBlock(parent *hclwrite.Body, typeName string, elem reflect.Value, parentPath string) {
 	for elem.Kind() == reflect.Pointer {
 		if elem.IsNil() {
 			return
@@ -118,8 +242,24 @@ func emitOneBlock(parent *hclwrite.Body, typeName string, elem reflect.Value) {
 			labels = append(labels, fmt.Sprintf("%v", elem.Field(i).Interface()))
 		}
 	}
+	path := blockPath(parentPath, typeName, labels)
+
+	if e.compact {
+		if origin, ok := e.forEachInstances[path]; ok {
+			if tokens := rawTokens(e.forEachSources[origin]); tokens != nil {
+				if !e.written[origin] {
+					e.written[origin] = true
+					parent.AppendNewline()
+					parent.AppendUnstructuredTokens(tokens)
+					parent.AppendNewline()
+				}
+				return
+			}
+		}
+	}
+
 	block := parent.AppendNewBlock(typeName, labels)
-	encodeBody(block.Body(), elem)
+	e.encodeBody(block.Body(), elem, path)
 }
 
 // isZeroForHcl decides whether a field should be skipped when its hcl tag is
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 )
@@ -325,3 +326,68 @@ func TestRoundTripExistingFixture(t *testing.T) {
 		t.Errorf("tm1.hcl encoding is not stable across round-trips")
 	}
 }
+
+func TestRoundTripIncluding(t *testing.T) {
+	cases := []struct {
+		name      string
+		including string
+		expHcl    string
+		expJSON   string
+		exp       []string
+	}{
+		{
+			"single",
+			`"baselines/web.hcl"`,
+			`including = "baselines/web.hcl"`,
+			`"including":"baselines/web.hcl"`,
+			[]string{"baselines/web.hcl"},
+		},
+		{
+			"list",
+			`["baselines/web.hcl", "baselines/pci.hcl"]`,
+			`including = ["baselines/web.hcl", "baselines/pci.hcl"]`,
+			`"includingSources":["baselines/web.hcl","baselines/pci.hcl"]`,
+			[]string{"baselines/web.hcl", "baselines/pci.hcl"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := `spec_version = "` + Version + `"
+
+threatmodel "Repro" {
+  author = "tester"
+  including = ` + tc.including + `
+}
+`
+			cfg := &ThreatmodelSpecConfig{}
+			cfg.setDefaults()
+			p := NewThreatmodelParser(cfg)
+			if err := p.ParseHCLRaw([]byte(src)); err != nil {
+				t.Fatalf("initial parse failed: %s", err)
+			}
+
+			out := p.HclString()
+			if !strings.Contains(out, tc.expHcl) {
+				t.Errorf("expected %s, got:\n%s", tc.expHcl, out)
+			}
+
+			p2 := reparse(t, p)
+			got := p2.GetWrapped().Threatmodels[0].includingSources()
+			if strings.Join(got, ",") != strings.Join(tc.exp, ",") {
+				t.Errorf("including = %v, want %v", got, tc.exp)
+			}
+
+			j, err := json.Marshal(p2.GetWrapped().Threatmodels[0])
+			if err != nil {
+				t.Fatalf("Error marshalling JSON: %s", err)
+			}
+			if !strings.Contains(string(j), tc.expJSON) {
+				t.Errorf("expected %s, got:\n%s", tc.expJSON, j)
+			}
+		})
+	}
+}
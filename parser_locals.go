@@ -0,0 +1,128 @@
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// extractLocals does a shallow parsing of an HCL file looking for 'locals'
+// blocks, and evaluates each local value against ctx. A local can refer to
+// var.*, import.* and to other locals, as long as they don't refer back to it.
+func extractLocals(f *hcl.File, ctx *hcl.EvalContext) (map[string]cty.Value, error) {
+	extract, _, diags := f.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type: "locals",
+			},
+		},
+	})
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	exprs := make(map[string]hcl.Expression)
+	for _, b := range extract.Blocks {
+		attrs, diags := b.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for name, attr := range attrs {
+			if _, ok := exprs[name]; ok {
+				return nil, fmt.Errorf("local '%s' is defined more than once", name)
+			}
+			exprs[name] = attr.Expr
+		}
+	}
+
+	r := &localsResolver{
+		exprs:    exprs,
+		ctx:      ctx,
+		values:   make(map[string]cty.Value, len(exprs)),
+		visiting: make(map[string]bool),
+	}
+
+	// Resolve in name order, so the same file always reports the same error
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := r.resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r.values, nil
+}
+
+// localsResolver evaluates locals depth first, so each local's dependencies
+// are known before it's evaluated
+type localsResolver struct {
+	exprs    map[string]hcl.Expression
+	ctx      *hcl.EvalContext
+	values   map[string]cty.Value
+	visiting map[string]bool
+}
+
+func (r *localsResolver) resolve(name string, chain []string) error {
+	if _, ok := r.values[name]; ok {
+		return nil
+	}
+
+	chain = append(chain, name)
+	if r.visiting[name] {
+		return fmt.Errorf("locals cycle detected: %s", strings.Join(chain, " -> "))
+	}
+	r.visiting[name] = true
+	defer delete(r.visiting, name)
+
+	expr := r.exprs[name]
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+
+		// An unknown local is reported when the expression is evaluated
+		if _, ok := r.exprs[attr.Name]; !ok {
+			continue
+		}
+
+		err := r.resolve(attr.Name, chain)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := r.ctx.NewChild()
+	ctx.Variables = map[string]cty.Value{
+		"local": cty.ObjectVal(r.values),
+	}
+
+	val, diags := expr.Value(ctx)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	r.values[name] = val
+	return nil
+}
+
+func (p *ThreatmodelParser) buildLocalCtx(ctx *hcl.EvalContext, localMap map[string]cty.Value) error {
+	ctx.Variables["local"] = cty.ObjectVal(localMap)
+
+	return nil
+}
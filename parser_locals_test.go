@@ -0,0 +1,119 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithLocals(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-withlocals.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if tm.Link != "https://payments.prod.example.com" {
+		t.Errorf("Incorrect link: %s", tm.Link)
+	}
+
+	if tm.InformationAssets[0].Description != "payments-db" {
+		t.Errorf("Incorrect information asset description: %s", tm.InformationAssets[0].Description)
+	}
+
+	if tm.Threats[0].Description != "Injection into payments-db" {
+		t.Errorf("Incorrect threat description: %s", tm.Threats[0].Description)
+	}
+
+	if tm.Threats[0].Control != "Reviewed for PROD" {
+		t.Errorf("Incorrect control: %s", tm.Threats[0].Control)
+	}
+}
+
+func TestParseHCLRawLocalsErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"cycle",
+			`locals {
+  a = local.b
+  b = "${local.c}-b"
+  c = local.a
+}`,
+			"locals cycle detected: a -> b -> c -> a",
+		},
+		{
+			"self_reference",
+			`locals {
+  a = local.a
+}`,
+			"locals cycle detected: a -> a",
+		},
+		{
+			"duplicate",
+			`locals {
+  a = "one"
+}
+
+locals {
+  a = "two"
+}`,
+			"local 'a' is defined more than once",
+		},
+		{
+			"unknown_local",
+			`locals {
+  a = local.nope
+}`,
+			"Unsupported attribute",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(tc.in + "\nthreatmodel \"tm\" {\n  author = \"@me\"\n}\n"))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestRoundTripLocals(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-withlocals.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	out := tmParser.HclString()
+	if strings.Contains(out, "locals {") {
+		t.Errorf("locals weren't stripped:\n%s", out)
+	}
+
+	p2 := reparse(t, tmParser)
+	if p2.GetWrapped().Threatmodels[0].Link != "https://payments.prod.example.com" {
+		t.Errorf("Resolved local lost in round trip: %s", p2.GetWrapped().Threatmodels[0].Link)
+	}
+}
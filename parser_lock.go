@@ -0,0 +1,244 @@
+package spec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DefaultLockFilename is the conventional name of a threat model lock file,
+// kept alongside the threat model files.
+const DefaultLockFilename = ".threatcl.lock.hcl"
+
+// LockMode controls what the parser does with its lock file.
+type LockMode int
+
+const (
+	// LockOff ignores the lock file.
+	LockOff LockMode = iota
+	// LockUpdate records the hash of every fetched remote source, replacing
+	// any previous entry for that source. Call WriteLockFile to save it.
+	LockUpdate
+	// LockVerify refuses any fetched remote source that isn't in the lock
+	// file, or whose content doesn't match its recorded hash.
+	LockVerify
+)
+
+const lockFileHeader = `# This file is maintained automatically by threatcl.
+# It records the content hash of each remote imports and including source.
+
+`
+
+// lockFile is the in-memory lock file, shared between a parser, the sub
+// parsers it creates for fetched sources, and any concurrent parses (see
+// Parse)
+type lockFile struct {
+	filename string
+	mode     LockMode
+
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+type lockFileHCL struct {
+	Sources []*lockedSource `hcl:"source,block"`
+}
+
+type lockedSource struct {
+	Source string `hcl:"source,label"`
+	Hash   string `hcl:"hash"`
+}
+
+// SetLockFile configures the lock file used to pin remote `imports` and
+// `including` sources. If filename already exists its entries are loaded. A
+// mode of LockOff removes any configured lock file.
+//
+// Local sources aren't locked, as they're reviewed along with the threat
+// model itself. Relative sources within a fetched remote file are locked
+// along with it.
+func (p *ThreatmodelParser) SetLockFile(filename string, mode LockMode) error {
+	if mode == LockOff {
+		p.lock = nil
+		return nil
+	}
+
+	lock := &lockFile{
+		filename: filename,
+		mode:     mode,
+		hashes:   make(map[string]string),
+	}
+
+	_, err := os.Stat(filename)
+	if err == nil {
+		parser := hclparse.NewParser()
+		f, diags := parser.ParseHCLFile(filename)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		decoded := &lockFileHCL{}
+		diags = gohcl.DecodeBody(f.Body, nil, decoded)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		for _, s := range decoded.Sources {
+			lock.hashes[s.Source] = s.Hash
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	p.lock = lock
+	return nil
+}
+
+// lockFilename is the name of the configured lock file, or "" if there isn't
+// one
+func (p *ThreatmodelParser) lockFilename() string {
+	if p.lock == nil {
+		return ""
+	}
+
+	return p.lock.filename
+}
+
+// WriteLockFile saves the lock file configured with SetLockFile, with its
+// sources sorted so that the output is stable.
+func (p *ThreatmodelParser) WriteLockFile() error {
+	if p.lock == nil {
+		return fmt.Errorf("no lock file configured")
+	}
+
+	p.lock.mu.Lock()
+	defer p.lock.mu.Unlock()
+
+	sources := make([]string, 0, len(p.lock.hashes))
+	for source := range p.lock.hashes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	for i, source := range sources {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		block := body.AppendNewBlock("source", []string{source})
+		block.Body().SetAttributeValue("hash", cty.StringVal(p.lock.hashes[source]))
+	}
+
+	return os.WriteFile(p.lock.filename, append([]byte(lockFileHeader), f.Bytes()...), 0o644)
+}
+
+// checkLock records or verifies the hash of the file fetched from source,
+// depending on the lock mode. It returns the key source is locked under, or ""
+// if it isn't locked.
+func (p *ThreatmodelParser) checkLock(source, currentFilename string, resolved *ResolvedSource) (string, error) {
+	if p.lock == nil {
+		return "", nil
+	}
+
+	key, err := p.lockKey(source, currentFilename)
+	if err != nil || key == "" {
+		return "", err
+	}
+
+	hash := contentHash(resolved.Content)
+	if resolved.Content == nil {
+		hash, err = fileHash(resolved.Path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	p.lock.mu.Lock()
+	defer p.lock.mu.Unlock()
+
+	switch p.lock.mode {
+	case LockUpdate:
+		p.lock.hashes[key] = hash
+	case LockVerify:
+		locked, ok := p.lock.hashes[key]
+		if !ok {
+			return "", fmt.Errorf("source '%s' isn't in the lock file '%s'", key, p.lock.filename)
+		}
+		if locked != hash {
+			return "", fmt.Errorf("checksum mismatch for '%s': lock file has '%s' but fetched '%s'", key, locked, hash)
+		}
+	}
+
+	return key, nil
+}
+
+// lockKey returns the key source, referred to from currentFilename, is locked
+// under, or "" if it isn't locked. Only sources that are local to the
+// top-level threat model are left unlocked: a relative source within a
+// fetched remote file is keyed by that file's source and the relative path, so
+// a locked remote model can't pull in unlocked content alongside it.
+func (p *ThreatmodelParser) lockKey(source, currentFilename string) (string, error) {
+	absPath, err := filepath.Abs(currentFilename)
+	if err != nil {
+		return "", err
+	}
+
+	normalized, err := normalizeSource(source, filepath.Dir(absPath))
+	if err != nil {
+		return "", err
+	}
+
+	if !isLocalSource(normalized) {
+		return normalized, nil
+	}
+
+	if p.lockSource == "" {
+		return "", nil
+	}
+
+	rel := strings.TrimPrefix(source, "file::")
+	if filepath.IsAbs(strings.SplitN(rel, "|", 2)[0]) {
+		return normalized, nil
+	}
+
+	return relativeLockKey(p.lockSource, rel), nil
+}
+
+// relativeLockKey returns the key of rel, a relative source within the file
+// locked as parent
+func relativeLockKey(parent, rel string) string {
+	rel = path.Clean(strings.ReplaceAll(filepath.ToSlash(rel), "|", "/"))
+
+	splitParent := strings.SplitN(parent, "|", 2)
+	if len(splitParent) == 1 {
+		return fmt.Sprintf("%s|%s", parent, rel)
+	}
+
+	return fmt.Sprintf("%s|%s", splitParent[0], path.Join(path.Dir(splitParent[1]), rel))
+}
+
+func fileHash(filename string) (string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return contentHash(content), nil
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(sum[:]))
+}
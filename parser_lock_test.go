@@ -0,0 +1,219 @@
+package spec
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lockTestServer serves a controls file whose description can be changed
+// between fetches
+func lockTestServer(t *testing.T, controlDesc *string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, cacheTestControls, *controlDesc)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestLockFileUpdateAndVerify(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	desc := "locked control"
+	srv := lockTestServer(t, &desc)
+
+	dir := writeCacheTestFiles(t, srv.URL+"/controls.hcl", "unused")
+	lockFilename := filepath.Join(dir, DefaultLockFilename)
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.SetLockFile(lockFilename, LockUpdate)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = tmParser.WriteLockFile()
+	if err != nil {
+		t.Fatalf("Error writing lock file: %s", err)
+	}
+
+	lockContent, err := os.ReadFile(lockFilename)
+	if err != nil {
+		t.Fatalf("Error reading lock file: %s", err)
+	}
+
+	if !strings.Contains(string(lockContent), fmt.Sprintf("source \"%s/controls.hcl\"", srv.URL)) ||
+		!strings.Contains(string(lockContent), "hash = \"sha256:") {
+		t.Errorf("Lock file is missing the source:\n%s", lockContent)
+	}
+
+	tmParser = NewThreatmodelParser(defaultCfg)
+	err = tmParser.SetLockFile(lockFilename, LockVerify)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Fatalf("Error verifying unchanged source: %s", err)
+	}
+
+	desc = "tampered control"
+
+	tmParser = NewThreatmodelParser(defaultCfg)
+	err = tmParser.SetLockFile(lockFilename, LockVerify)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Expected a checksum mismatch, got '%v'", err)
+	}
+}
+
+func TestLockFileVerifyMissingSource(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	desc := "words"
+	srv := lockTestServer(t, &desc)
+
+	dir := writeCacheTestFiles(t, srv.URL+"/controls.hcl", "unused")
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.SetLockFile(filepath.Join(dir, DefaultLockFilename), LockVerify)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err == nil || !strings.Contains(err.Error(), "isn't in the lock file") {
+		t.Errorf("Expected a missing lock entry error, got '%v'", err)
+	}
+}
+
+func TestLockFileIgnoresLocalSources(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	dir := writeCacheTestFiles(t, "controls.hcl", "words")
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.SetLockFile(filepath.Join(dir, DefaultLockFilename), LockVerify)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLFile(filepath.Join(dir, "tm.hcl"), false)
+	if err != nil {
+		t.Errorf("Error parsing legit TM file: %s", err)
+	}
+}
+
+func TestLockFileInvalid(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	lockFilename := filepath.Join(t.TempDir(), DefaultLockFilename)
+	err := os.WriteFile(lockFilename, []byte(`source "x" {}`), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing lock file: %s", err)
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err = tmParser.SetLockFile(lockFilename, LockVerify)
+	if err == nil {
+		t.Errorf("Expected an error loading a lock file entry without a hash")
+	}
+
+	err = tmParser.WriteLockFile()
+	if err == nil {
+		t.Errorf("Expected an error writing without a configured lock file")
+	}
+}
+
+func TestLockFileRelativeToRemoteSource(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	dir := t.TempDir()
+	lockFilename := filepath.Join(dir, DefaultLockFilename)
+
+	fake := &FakeResolver{
+		Sources: map[string]string{
+			"github.com/org/shared|models/base.hcl": `threatmodel "base" {
+  author    = "@me"
+  including = ["./other.hcl"]
+}
+`,
+			"./other.hcl": `threatmodel "other" {
+  author = "@me"
+
+  threat "sibling" {
+    description = "From alongside the base model"
+  }
+}
+`,
+		},
+	}
+
+	tm := []byte(`threatmodel "tm" {
+  author    = "@me"
+  including = ["github.com/org/shared|models/base.hcl"]
+}
+`)
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceResolver(fake)
+	err := tmParser.SetLockFile(lockFilename, LockUpdate)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLRawWithOptions(tm, RawParseOptions{BaseDir: dir})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = tmParser.WriteLockFile()
+	if err != nil {
+		t.Fatalf("Error writing lock file: %s", err)
+	}
+
+	lockContent, err := os.ReadFile(lockFilename)
+	if err != nil {
+		t.Fatalf("Error reading lock file: %s", err)
+	}
+
+	exp := `source "git::https://github.com/org/shared.git|models/other.hcl"`
+	if !strings.Contains(string(lockContent), exp) {
+		t.Errorf("Lock file doesn't contain '%s':\n%s", exp, lockContent)
+	}
+
+	fake.Sources["./other.hcl"] = strings.Replace(fake.Sources["./other.hcl"], "From alongside", "Tampered with alongside", 1)
+
+	tmParser = NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceResolver(fake)
+	err = tmParser.SetLockFile(lockFilename, LockVerify)
+	if err != nil {
+		t.Fatalf("Error setting lock file: %s", err)
+	}
+
+	err = tmParser.ParseHCLRawWithOptions(tm, RawParseOptions{BaseDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch for 'git::https://github.com/org/shared.git|models/other.hcl'") {
+		t.Errorf("Expected a checksum mismatch, got '%v'", err)
+	}
+}
@@ -0,0 +1,290 @@
+package spec
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// IncludeMergeStrategy decides which side wins when an included threat model
+// and the including (parent) threat model both define the same element.
+type IncludeMergeStrategy string
+
+const (
+	// MergeKeepParent keeps the parent's element and drops the included one.
+	// This is the default.
+	MergeKeepParent IncludeMergeStrategy = "keep_parent"
+	// MergeKeepIncluded replaces the parent's element with the included one.
+	// With several including sources, a later source replaces an earlier one.
+	MergeKeepIncluded IncludeMergeStrategy = "keep_included"
+	// MergeDeepMerge combines threats: the parent's fields win where set, but
+	// controls are combined by name, a missing risk block is filled in, and
+	// STRIDE, impacts and information asset refs are unioned. Other elements
+	// are kept from the parent, as with MergeKeepParent.
+	MergeDeepMerge IncludeMergeStrategy = "deep_merge"
+)
+
+// Values of IncludeConflict.Kept
+const (
+	KeptParent   = "parent"
+	KeptIncluded = "included"
+	KeptMerged   = "merged"
+)
+
+// IncludeConflict is an element defined by both an including threat model and
+// one of its included sources, and how it was resolved.
+type IncludeConflict struct {
+	// Threatmodel is the name of the including threat model
+	Threatmodel string
+	// Source is the including source the conflicting element came from
+	Source string
+	// Kind is the element's block or attribute name, such as "threat",
+	// "information_asset", "control" or "description"
+	Kind string
+	// Name identifies the element. Controls are named "<threat>/<control>",
+	// and attributes have no name.
+	Name string
+	// Kept is KeptParent, KeptIncluded or KeptMerged
+	Kept string
+}
+
+func (c IncludeConflict) String() string {
+	element := c.Kind
+	if c.Name != "" {
+		element = fmt.Sprintf("%s '%s'", c.Kind, c.Name)
+	}
+
+	switch c.Kept {
+	case KeptIncluded:
+		return fmt.Sprintf("TM '%s': %s was overridden by '%s'", c.Threatmodel, element, c.Source)
+	case KeptMerged:
+		return fmt.Sprintf("TM '%s': %s was merged with '%s'", c.Threatmodel, element, c.Source)
+	default:
+		return fmt.Sprintf("TM '%s': %s shadows the one from '%s'", c.Threatmodel, element, c.Source)
+	}
+}
+
+// SetIncludeMergeStrategy sets how elements defined both in a threat model and
+// in its `including` sources are merged.
+func (p *ThreatmodelParser) SetIncludeMergeStrategy(strategy IncludeMergeStrategy) error {
+	switch strategy {
+	case MergeKeepParent, MergeKeepIncluded, MergeDeepMerge:
+		p.includeMergeStrategy = strategy
+		return nil
+	}
+
+	return fmt.Errorf("unknown include merge strategy '%s'", strategy)
+}
+
+// IncludeConflicts returns every element that was defined both by a parsed
+// threat model and by one of the sources it includes (at any depth), in the
+// order they were merged.
+func (p *ThreatmodelParser) IncludeConflicts() []IncludeConflict {
+	p.resultsMu.RLock()
+	defer p.resultsMu.RUnlock()
+
+	return p.includeConflicts
+}
+
+// mergeIncluded merges subTm, fetched from source, into tm using p's merge
+// strategy, recording a conflict for each element both define
+func (p *ThreatmodelParser) mergeIncluded(tm, subTm *Threatmodel, source string) {
+	keepIncluded := p.includeMergeStrategy == MergeKeepIncluded
+
+	conflict := func(kind, name, origin, kept string) {
+		if origin == "" {
+			origin = source
+		}
+		p.includeConflicts = append(p.includeConflicts, IncludeConflict{
+			Threatmodel: tm.Name,
+			Source:      origin,
+			Kind:        kind,
+			Name:        name,
+			Kept:        kept,
+		})
+	}
+
+	kept := KeptParent
+	if keepIncluded {
+		kept = KeptIncluded
+	}
+
+	mergeString := func(kind string, parent *string, included string) {
+		switch {
+		case included == "":
+		case *parent == "":
+			*parent = included
+		case *parent != included:
+			if keepIncluded {
+				*parent = included
+			}
+			conflict(kind, "", "", kept)
+		}
+	}
+
+	mergeString("description", &tm.Description, subTm.Description)
+	mergeString("link", &tm.Link, subTm.Link)
+	mergeString("diagram_link", &tm.DiagramLink, subTm.DiagramLink)
+
+	if len(subTm.Repository) > 0 {
+		if len(tm.Repository) == 0 {
+			tm.Repository = subTm.Repository
+		} else if !reflect.DeepEqual(tm.Repository, subTm.Repository) {
+			if keepIncluded {
+				tm.Repository = subTm.Repository
+			}
+			conflict("repository", "", "", kept)
+		}
+	}
+
+	if subTm.Attributes != nil {
+		if tm.Attributes == nil {
+			tm.Attributes = subTm.Attributes
+		} else if *tm.Attributes != *subTm.Attributes {
+			if keepIncluded {
+				tm.Attributes = subTm.Attributes
+			}
+			conflict("attributes", "", "", kept)
+		}
+	}
+
+	for _, ia := range subTm.InformationAssets {
+		if existing := tm.addInfoIfNotExist(*ia); existing != nil {
+			if keepIncluded {
+				*existing = *ia
+			}
+			conflict("information_asset", ia.Name, ia.IncludedFrom, kept)
+		}
+	}
+
+	// Use cases and exclusions are matched on their whole description, so a
+	// match is the same element rather than a conflict
+	for _, uc := range subTm.UseCases {
+		tm.addUcIfNotExist(*uc)
+	}
+
+	for _, ex := range subTm.Exclusions {
+		tm.addExclIfNotExist(*ex)
+	}
+
+	for _, tpd := range subTm.ThirdPartyDependencies {
+		if existing := tm.addTpdIfNotExist(*tpd); existing != nil {
+			if keepIncluded {
+				*existing = *tpd
+			}
+			conflict("third_party_dependency", tpd.Name, "", kept)
+		}
+	}
+
+	for _, dfd := range subTm.DataFlowDiagrams {
+		if existing := tm.addDfdIfNotExist(*dfd); existing != nil {
+			if keepIncluded {
+				*existing = *dfd
+			}
+			conflict("data_flow_diagram_v2", dfd.Name, dfd.IncludedFrom, kept)
+		}
+	}
+
+	for _, mermaid := range subTm.MermaidDiagrams {
+		if existing := tm.addMermaidIfNotExist(*mermaid); existing != nil {
+			if keepIncluded {
+				*existing = *mermaid
+			}
+			conflict("mermaid", mermaid.Name, "", kept)
+		}
+	}
+
+	for _, t := range subTm.Threats {
+		existing := tm.addTIfNotExist(*t)
+		if existing == nil {
+			continue
+		}
+
+		switch p.includeMergeStrategy {
+		case MergeKeepIncluded:
+			*existing = *t
+			conflict("threat", t.Name, t.IncludedFrom, KeptIncluded)
+		case MergeDeepMerge:
+			for _, shadowed := range existing.deepMerge(t) {
+				conflict("control", fmt.Sprintf("%s/%s", t.Name, shadowed), t.IncludedFrom, KeptParent)
+			}
+			conflict("threat", t.Name, t.IncludedFrom, KeptMerged)
+		default:
+			conflict("threat", t.Name, t.IncludedFrom, KeptParent)
+		}
+	}
+}
+
+// deepMerge fills in t from the included threat inc. t's own values win, but
+// controls are combined by name, a missing risk block is taken from inc, and
+// list attributes are unioned. It returns the names of any of inc's controls
+// that t's controls shadow.
+func (t *Threat) deepMerge(inc *Threat) []string {
+	if t.Description == "" {
+		t.Description = inc.Description
+	}
+
+	if t.Control == "" {
+		t.Control = inc.Control
+	}
+
+	if t.Ref == "" {
+		t.Ref = inc.Ref
+	}
+
+	if t.Risk == nil {
+		t.Risk = inc.Risk
+	}
+
+	t.ImpactType = unionStrings(t.ImpactType, inc.ImpactType)
+	t.Stride = unionStrings(t.Stride, inc.Stride)
+	t.InformationAssetRefs = unionStrings(t.InformationAssetRefs, inc.InformationAssetRefs)
+
+	for _, pc := range inc.ProposedControls {
+		found := false
+		for _, existing := range t.ProposedControls {
+			if existing.Description == pc.Description {
+				found = true
+			}
+		}
+
+		if !found {
+			t.ProposedControls = append(t.ProposedControls, pc)
+		}
+	}
+
+	shadowed := []string{}
+	for _, c := range inc.Controls {
+		found := false
+		for _, existing := range t.Controls {
+			if existing.Name == c.Name {
+				found = true
+			}
+		}
+
+		if found {
+			shadowed = append(shadowed, c.Name)
+		} else {
+			t.Controls = append(t.Controls, c)
+		}
+	}
+
+	return shadowed
+}
+
+// unionStrings appends the values of b that aren't already in a
+func unionStrings(a, b []string) []string {
+	for _, v := range b {
+		found := false
+		for _, existing := range a {
+			if existing == v {
+				found = true
+			}
+		}
+
+		if !found {
+			a = append(a, v)
+		}
+	}
+
+	return a
+}
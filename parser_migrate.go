@@ -0,0 +1,220 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// legacyDfdName is the name a legacy data_flow_diagram is given when it's
+// migrated, which is also the name it's shifted to when it's parsed
+const legacyDfdName = "Legacy DFD"
+
+// MigrateHCL rewrites the deprecated constructs CheckConstraints reports in
+// src, the source of the HCL threat model file filename, into their
+// replacements, and sets spec_version to the current version:
+//
+//   - a threat's control string becomes a control block named "control", in
+//     place of the attribute
+//   - proposed_control blocks become control blocks named "proposed_control"
+//   - expanded_control blocks become control blocks
+//   - a legacy data_flow_diagram becomes a data_flow_diagram_v2 named
+//     "Legacy DFD"
+//
+// Generated names get a numeric suffix where they'd clash with an existing
+// name. Only the migrated tokens are rewritten, so everything else in src,
+// including comments and alignment, is kept byte for byte. It returns the new
+// source and a description of each change made.
+func MigrateHCL(src []byte, filename string) ([]byte, []string, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return nil, nil, fmt.Errorf("can't migrate '%s': only HCL files can be migrated", filename)
+	}
+
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	body, ok := f.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil, fmt.Errorf("can't migrate '%s': it isn't native HCL syntax", filename)
+	}
+
+	m := &migration{src: src}
+	for _, tmBlock := range body.Blocks {
+		if tmBlock.Type != "threatmodel" {
+			continue
+		}
+
+		m.threatmodel(strings.Join(tmBlock.Labels, " "), tmBlock.Body)
+	}
+
+	// spec_version is replaced in place, or added at the top of the file
+	version := fmt.Sprintf("%q", Version)
+	if attr, ok := body.Attributes["spec_version"]; ok {
+		if string(attr.Expr.Range().SliceBytes(src)) != version {
+			m.replace(attr.Expr.Range(), version)
+			m.changes = append(m.changes, fmt.Sprintf("spec_version set to '%s'", Version))
+		}
+	} else {
+		m.insert(0, fmt.Sprintf("spec_version = %s\n\n", version))
+		m.changes = append(m.changes, fmt.Sprintf("spec_version set to '%s'", Version))
+	}
+
+	return m.apply(), m.changes, nil
+}
+
+// migration collects the edits MigrateHCL makes to src
+type migration struct {
+	src     []byte
+	edits   []migrationEdit
+	changes []string
+}
+
+// migrationEdit replaces src[start:end] with text
+type migrationEdit struct {
+	start, end int
+	text       string
+}
+
+func (m *migration) replace(rng hcl.Range, text string) {
+	m.edits = append(m.edits, migrationEdit{start: rng.Start.Byte, end: rng.End.Byte, text: text})
+}
+
+func (m *migration) insert(at int, text string) {
+	m.edits = append(m.edits, migrationEdit{start: at, end: at, text: text})
+}
+
+// apply returns src with every edit made. Edits never overlap.
+func (m *migration) apply() []byte {
+	sort.SliceStable(m.edits, func(i, j int) bool {
+		return m.edits[i].start < m.edits[j].start
+	})
+
+	out := make([]byte, 0, len(m.src))
+	last := 0
+	for _, e := range m.edits {
+		out = append(out, m.src[last:e.start]...)
+		out = append(out, e.text...)
+		last = e.end
+	}
+
+	return append(out, m.src[last:]...)
+}
+
+// relabel replaces the type of blk, and its labels with label if it's set
+func (m *migration) relabel(blk *hclsyntax.Block, blockType, label string) {
+	if label == "" {
+		m.replace(blk.TypeRange, blockType)
+		return
+	}
+
+	labelled := fmt.Sprintf("%s %q", blockType, label)
+	if len(blk.LabelRanges) == 0 {
+		m.replace(blk.TypeRange, labelled)
+		return
+	}
+
+	m.replace(hcl.RangeBetween(blk.TypeRange, blk.LabelRanges[len(blk.LabelRanges)-1]), labelled)
+}
+
+func (m *migration) threatmodel(tmName string, body *hclsyntax.Body) {
+	dfdNames := make(map[string]bool)
+	for _, blk := range body.Blocks {
+		if blk.Type == "data_flow_diagram_v2" && len(blk.Labels) > 0 {
+			dfdNames[blk.Labels[0]] = true
+		}
+	}
+
+	for _, blk := range body.Blocks {
+		switch blk.Type {
+		case "threat":
+			m.threat(tmName, blk)
+		case "data_flow_diagram":
+			name := uniqueName(legacyDfdName, dfdNames)
+			m.relabel(blk, "data_flow_diagram_v2", name)
+			m.changes = append(m.changes, fmt.Sprintf("TM '%s': data_flow_diagram migrated to data_flow_diagram_v2 '%s'", tmName, name))
+		}
+	}
+}
+
+func (m *migration) threat(tmName string, threat *hclsyntax.Block) {
+	threatName := strings.Join(threat.Labels, " ")
+	body := threat.Body
+
+	controlNames := make(map[string]bool)
+	for _, blk := range body.Blocks {
+		if (blk.Type == "control" || blk.Type == "expanded_control") && len(blk.Labels) > 0 {
+			controlNames[blk.Labels[0]] = true
+		}
+	}
+
+	for _, blk := range body.Blocks {
+		switch blk.Type {
+		case "expanded_control":
+			m.relabel(blk, "control", "")
+			m.changes = append(m.changes, fmt.Sprintf("TM '%s' / Threat '%s': expanded_control '%s' migrated to a control block", tmName, threatName, strings.Join(blk.Labels, " ")))
+		case "proposed_control":
+			name := uniqueName("proposed_control", controlNames)
+			m.relabel(blk, "control", name)
+			m.changes = append(m.changes, fmt.Sprintf("TM '%s' / Threat '%s': proposed_control migrated to control '%s'", tmName, threatName, name))
+		}
+	}
+
+	if attr, ok := body.Attributes["control"]; ok {
+		name := uniqueName("control", controlNames)
+		m.controlBlock(threat, attr, name)
+		m.changes = append(m.changes, fmt.Sprintf("TM '%s' / Threat '%s': control string migrated to control '%s'", tmName, threatName, name))
+	}
+}
+
+// controlBlock replaces the control attribute of threat with a control block
+// named name, where the attribute was. Anything after the attribute on its
+// line, such as a comment, stays with the description.
+func (m *migration) controlBlock(threat *hclsyntax.Block, attr *hclsyntax.Attribute, name string) {
+	description := string(attr.Expr.Range().SliceBytes(m.src))
+
+	// A single line threat block can only hold the attribute, and can't hold
+	// a block, so it's spread over multiple lines
+	if threat.OpenBraceRange.Start.Line == threat.CloseBraceRange.Start.Line {
+		indent := lineIndent(m.src, threat.TypeRange.Start.Byte)
+		m.replace(hcl.Range{Start: threat.OpenBraceRange.End, End: threat.CloseBraceRange.Start},
+			fmt.Sprintf("\n%s  control %q {\n%s    description = %s\n%s  }\n%s", indent, name, indent, description, indent, indent))
+		return
+	}
+
+	indent := lineIndent(m.src, attr.SrcRange.Start.Byte)
+	m.replace(attr.SrcRange, fmt.Sprintf("control %q {\n%s  description = %s", name, indent, description))
+
+	end := attr.SrcRange.End.Byte
+	if i := bytes.IndexByte(m.src[end:], '\n'); i >= 0 {
+		m.insert(end+i+1, indent+"}\n")
+		return
+	}
+	m.insert(len(m.src), "\n"+indent+"}")
+}
+
+// lineIndent returns the whitespace at the start of the line holding offset
+func lineIndent(src []byte, offset int) string {
+	lineStart := bytes.LastIndexByte(src[:offset], '\n') + 1
+	line := src[lineStart:offset]
+
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// uniqueName returns base, or base with the lowest numeric suffix from 2 up
+// that isn't in used, and adds it to used
+func uniqueName(base string, used map[string]bool) string {
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	used[name] = true
+
+	return name
+}
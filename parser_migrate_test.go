@@ -0,0 +1,302 @@
+package spec
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestMigrateHCL(t *testing.T) {
+	src, err := os.ReadFile("./testdata/tm-migrate.hcl")
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	out, changes, err := MigrateHCL(src, "tm-migrate.hcl")
+	if err != nil {
+		t.Fatalf("Error migrating TM file: %s", err)
+	}
+
+	expectedChanges := []string{
+		"TM 'migrate' / Threat 'phishing': proposed_control migrated to control 'proposed_control'",
+		"TM 'migrate' / Threat 'phishing': proposed_control migrated to control 'proposed_control_2'",
+		"TM 'migrate' / Threat 'phishing': expanded_control 'control' migrated to a control block",
+		"TM 'migrate' / Threat 'phishing': control string migrated to control 'control_2'",
+		"TM 'migrate': data_flow_diagram migrated to data_flow_diagram_v2 'Legacy DFD'",
+		"spec_version set to '" + Version + "'",
+	}
+	if strings.Join(changes, "\n") != strings.Join(expectedChanges, "\n") {
+		t.Errorf("Expected changes:\n%s\ngot:\n%s", strings.Join(expectedChanges, "\n"), strings.Join(changes, "\n"))
+	}
+
+	expected := `// A threat model using every deprecated construct
+spec_version = "` + Version + `"
+
+threatmodel "migrate" {
+  author = "@xntrik" # the author
+
+  threat "phishing" {
+    description = "An attacker phishes a user"
+    control "control_2" {
+      description = "Use MFA"   # note
+    }
+
+    // proposed controls predate control blocks
+    control "proposed_control" {
+      implemented = true
+      description = "Train users" # yearly
+    }
+
+    control "proposed_control_2" {
+      description = "Hardware keys"
+    }
+
+    control "control" {
+      description = "Block lookalike domains"
+    }
+  }
+
+  threat "untouched" {
+    description = "Nothing to migrate here"       # comments are kept
+  }
+
+  # the legacy diagram
+  data_flow_diagram_v2 "Legacy DFD" {
+    process "web" {}
+  }
+}
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err = tmParser.ParseHCLRaw(out)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	for _, w := range tmParser.Warnings() {
+		if w.Kind == WarningDeprecated {
+			t.Errorf("Unexpected deprecation warning: %s", w)
+		}
+	}
+
+	msg, err := VersionConstraints(tmParser.GetWrapped(), false)
+	if err != nil {
+		t.Fatalf("Error checking constraints: %s", err)
+	}
+	if msg != "" {
+		t.Errorf("Expected no version constraints, got '%s'", msg)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if len(tm.Threats[0].Controls) != 4 {
+		t.Errorf("Expected 4 controls, got %d", len(tm.Threats[0].Controls))
+	}
+
+	controls := map[string]string{}
+	for _, c := range tm.Threats[0].Controls {
+		controls[c.Name] = c.Description
+	}
+	if controls["control_2"] != "Use MFA" {
+		t.Errorf("Expected control_2 to be 'Use MFA', got '%s'", controls["control_2"])
+	}
+	if controls["proposed_control"] != "Train users" {
+		t.Errorf("Expected proposed_control to be 'Train users', got '%s'", controls["proposed_control"])
+	}
+
+	if len(tm.DataFlowDiagrams) != 1 || tm.DataFlowDiagrams[0].Name != legacyDfdName {
+		t.Errorf("Expected a single '%s' dfd, got %+v", legacyDfdName, tm.DataFlowDiagrams)
+	}
+}
+
+func TestMigrateHCLUntouched(t *testing.T) {
+	head := `spec_version = "0.1.4"   # old
+
+/* a block comment */
+threatmodel "tm" {
+  author      = "@me"          # aligned
+  description = <<EOT
+  Spaced    out
+EOT
+
+  threat "before" {
+    description = "y"       # spaced
+    impacts     = ["Confidentiality"]   // also spaced
+  }
+
+`
+	migrated := `  threat "migrated" {
+    description = "x"
+    control   = "Use MFA"     # note
+  }
+`
+	tail := `
+  threat "after" { description = "z" }
+
+  information_asset "creds" {
+    information_classification  =   "Confidential"
+  }
+}
+`
+
+	out, changes, err := MigrateHCL([]byte(head+migrated+tail), "untouched.hcl")
+	if err != nil {
+		t.Fatalf("Error migrating TM file: %s", err)
+	}
+
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 changes, got %v", changes)
+	}
+
+	expected := strings.Replace(head, `"0.1.4"`, `"`+Version+`"`, 1) + `  threat "migrated" {
+    description = "x"
+    control "control" {
+      description = "Use MFA"     # note
+    }
+  }
+` + tail
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err = tmParser.ParseHCLRaw(out)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+}
+
+func TestMigrateHCLSingleLine(t *testing.T) {
+	src := `spec_version = "` + Version + `"
+
+threatmodel "tm" {
+  author = "@me"
+
+  threat "t" { control = "Use MFA" }
+}
+`
+
+	out, _, err := MigrateHCL([]byte(src), "single.hcl")
+	if err != nil {
+		t.Fatalf("Error migrating TM file: %s", err)
+	}
+
+	expected := strings.Replace(src, `threat "t" { control = "Use MFA" }`, `threat "t" {
+    control "control" {
+      description = "Use MFA"
+    }
+  }`, 1)
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	// A single line threat has no room for a description, so it's only
+	// checked to be valid HCL
+	_, diags := hclsyntax.ParseConfig(out, "single.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Errorf("Error parsing migrated HCL: %s", diags)
+	}
+}
+
+func TestMigrateHCLNoChanges(t *testing.T) {
+	src := []byte(`spec_version = "` + Version + `"
+
+// already current
+threatmodel "tm" {
+  author = "@me"
+
+  threat "t" {
+    description = "words"
+
+    control "mfa" {
+      description = "Use MFA"
+    }
+  }
+}
+`)
+
+	out, changes, err := MigrateHCL(src, "current.hcl")
+	if err != nil {
+		t.Fatalf("Error migrating TM file: %s", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+
+	if string(out) != string(src) {
+		t.Errorf("Expected the source to be unchanged, got:\n%s", out)
+	}
+}
+
+func TestMigrateHCLAddsVersion(t *testing.T) {
+	src := []byte(`threatmodel "tm" {
+  author = "@me"
+}
+`)
+
+	out, changes, err := MigrateHCL(src, "noversion.hcl")
+	if err != nil {
+		t.Fatalf("Error migrating TM file: %s", err)
+	}
+
+	expected := `spec_version = "` + Version + `"
+
+` + string(src)
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if len(changes) != 1 {
+		t.Errorf("Expected 1 change, got %v", changes)
+	}
+}
+
+func TestMigrateHCLErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		in       string
+		filename string
+		exp      string
+	}{
+		{
+			"json",
+			`{}`,
+			"tm.json",
+			"only HCL files can be migrated",
+		},
+		{
+			"invalid",
+			`threatmodel "tm" {`,
+			"tm.hcl",
+			"Unclosed configuration block",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := MigrateHCL([]byte(tc.in), tc.filename)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package spec
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/threatcl/go-otm/pkg/otm"
+)
+
+// otmDfdAttr is the trustZone/component/dataflow attribute that records which
+// data_flow_diagram_v2 an OTM element belongs to. OTM has a single flat
+// architecture per project, so without it multiple DFDs would collapse into one.
+const otmDfdAttr = "dfd"
+
+// ParseOtm converts an Open Threat Model document into a Threatmodel, which
+// becomes the parser's wrapped model (see GetWrapped). It is the inverse of
+// RenderOtm:
+//
+//   - assets become information_asset blocks
+//   - threats become threat blocks, with OTM's 0–100 risk values mapped back
+//     onto the nearest RiskLevels
+//   - mitigations become control blocks on the threat they mitigate, and any
+//     mitigation not linked to a threat becomes a `component "control"`
+//   - trustZones, components and dataflows become data_flow_diagram_v2 blocks,
+//     with a zone's trustRating kept as its trust_rating unless it's the
+//     DefaultTrustRating
+//
+// Anything that can't be mapped, such as a threat category that isn't a STRIDE
+// element or impact, is reported as a warning (see Warnings). The resulting
+// threat model is validated like a parsed file.
+func (p *ThreatmodelParser) ParseOtm(o otm.OtmSchemaJson) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseOtm(o)
+	})
+}
+
+func (p *ThreatmodelParser) parseOtm(o otm.OtmSchemaJson) error {
+	tm, unlinked, err := p.otmToThreatmodel(o)
+	if err != nil {
+		return err
+	}
+
+	if p.wrapped.SpecVersion == "" {
+		p.wrapped.SpecVersion = p.specCfg.Version
+	}
+
+	for _, c := range unlinked {
+		p.addComponentIfNotExist(controlToComponent(c))
+	}
+
+	p.wrapped.Threatmodels = append(p.wrapped.Threatmodels, *tm)
+
+	return p.validateTms()
+}
+
+func (p *ThreatmodelParser) otmToThreatmodel(o otm.OtmSchemaJson) (*Threatmodel, []*Control, error) {
+	if o.Project.Name == "" {
+		return nil, nil, fmt.Errorf("otm project has no name")
+	}
+
+	tm := &Threatmodel{
+		Name:        o.Project.Name,
+		Description: strFromP(o.Project.Description),
+		Author:      strFromP(o.Project.Owner),
+	}
+
+	tm.setOtmAttributes(o.Project.Attributes)
+
+	assetNames := make(map[string]string)
+	for _, a := range o.Assets {
+		ia := &InformationAsset{
+			Name:        a.Name,
+			Description: strFromP(a.Description),
+		}
+		ia.InformationClassification, _ = otmString(a.Attributes["information_classification"])
+		ia.Source, _ = otmString(a.Attributes["source"])
+		ia.Ref, _ = otmString(a.Attributes["ref"])
+
+		assetNames[a.Id] = a.Name
+		tm.InformationAssets = append(tm.InformationAssets, ia)
+	}
+
+	threatsByID := make(map[string]*Threat)
+	for _, ot := range o.Threats {
+		t := &Threat{
+			Name:        ot.Name,
+			Description: strFromP(ot.Description),
+		}
+
+		for _, category := range ot.Categories {
+			if category == nil {
+				continue
+			}
+			// OTM has a single categories list, so STRIDE elements and impacts
+			// are told apart by the configured enums. Anything else has no
+			// threatcl equivalent and is dropped.
+			if stride := p.normalizeStride(*category); stride != "" {
+				t.Stride = append(t.Stride, stride)
+			} else if impact := p.normalizeImpactType(*category); impact != "" {
+				t.ImpactType = append(t.ImpactType, impact)
+			} else {
+				p.warn(WarningReplaced, tm.Name, hcl.Range{},
+					"unknown category '%s' of threat '%s' isn't a stride or impact, and was dropped", *category, ot.Name)
+			}
+		}
+
+		t.Risk = otmToRisk(ot)
+
+		threatsByID[ot.Id] = t
+		tm.Threats = append(tm.Threats, t)
+	}
+
+	// Standard OTM links mitigations to threats through the threat instances
+	// on components and dataflows.
+	mitigatedBy := make(map[string][]string)
+	linkThreats := func(instances []otm.Threat) {
+		for _, ti := range instances {
+			for _, m := range ti.Mitigations {
+				if m.Mitigation != nil {
+					mitigatedBy[*m.Mitigation] = append(mitigatedBy[*m.Mitigation], ti.Threat)
+				}
+			}
+		}
+	}
+	for _, c := range o.Components {
+		linkThreats(c.Threats)
+	}
+	for _, df := range o.Dataflows {
+		linkThreats(df.Threats)
+	}
+
+	unlinked := []*Control{}
+	for _, m := range o.Mitigations {
+		threatIDs := mitigatedBy[m.Id]
+		if owner, ok := otmString(m.Attributes["threat"]); ok {
+			threatIDs = []string{owner}
+		}
+
+		linked := false
+		for _, id := range threatIDs {
+			if t, ok := threatsByID[id]; ok {
+				t.addControlIfNotExist(otmToControl(m))
+				linked = true
+			}
+		}
+
+		if !linked {
+			unlinked = append(unlinked, otmToControl(m))
+		}
+	}
+
+	if repr := otmDiagramLink(o.Representations); repr != "" {
+		tm.DiagramLink = repr
+	}
+
+	tm.DataFlowDiagrams = p.otmToDfds(tm.Name, o, assetNames)
+
+	return tm, unlinked, nil
+}
+
+// setOtmAttributes maps OTM project attributes back onto the threat model. The
+// keys RenderOtm writes from the attributes block and repository are restored
+// to their fields, everything else becomes an additional_attribute.
+func (tm *Threatmodel) setOtmAttributes(attrs otm.OtmSchemaJsonProjectAttributes) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := attrs[k]
+		switch k {
+		case "new_initiative":
+			tm.otmAttributeBlock().NewInitiative = otmBool(v)
+		case "internet_facing":
+			tm.otmAttributeBlock().InternetFacing = otmBool(v)
+		case "initiative_size":
+			tm.otmAttributeBlock().InitiativeSize, _ = otmString(v)
+		case "repository":
+			tm.Repository = otmStrings(v)
+		default:
+			tm.AdditionalAttributes = append(tm.AdditionalAttributes, &AdditionalAttribute{
+				Name:  k,
+				Value: fmt.Sprint(v),
+			})
+		}
+	}
+}
+
+func (tm *Threatmodel) otmAttributeBlock() *Attribute {
+	if tm.Attributes == nil {
+		tm.Attributes = &Attribute{}
+	}
+	return tm.Attributes
+}
+
+// otmToRisk rebuilds a threat's risk block. RenderOtm always writes a
+// likelihood when a risk block exists, so a nil likelihood means there wasn't
+// one. A severity that differs from the matrix result was an override.
+func otmToRisk(ot otm.OtmSchemaJsonThreatsElem) *Risk {
+	if ot.Risk.Likelihood == nil {
+		return nil
+	}
+
+	r := &Risk{
+		Likelihood: defaultRiskModel.levelForOtm(*ot.Risk.Likelihood),
+		Impact:     defaultRiskModel.levelForOtm(ot.Risk.Impact),
+	}
+
+	if ot.Risk.LikelihoodComment != nil {
+		r.Rationale = *ot.Risk.LikelihoodComment
+	} else if ot.Risk.ImpactComment != nil {
+		r.Rationale = *ot.Risk.ImpactComment
+	}
+
+	if severity, ok := otmString(ot.Attributes["risk_severity"]); ok {
+		if severity != defaultRiskModel.severity(r.Likelihood, r.Impact) {
+			r.SeverityOverride = severity
+		}
+	}
+
+	return r
+}
+
+func otmToControl(m otm.OtmSchemaJsonMitigationsElem) *Control {
+	c := &Control{
+		Name:          m.Name,
+		Description:   strFromP(m.Description),
+		RiskReduction: int(m.RiskReduction),
+	}
+
+	keys := make([]string, 0, len(m.Attributes))
+	for k := range m.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m.Attributes[k]
+		switch k {
+		case "implemented":
+			c.Implemented = otmBool(v)
+		case "implementation_notes":
+			c.ImplementationNotes, _ = otmString(v)
+		case "threat":
+			// Link back to the owning threat, handled by the caller
+		default:
+			c.Attributes = append(c.Attributes, &ControlAttribute{
+				Name:  k,
+				Value: fmt.Sprint(v),
+			})
+		}
+	}
+
+	return c
+}
+
+func otmDiagramLink(reprs []otm.OtmSchemaJsonRepresentationsElem) string {
+	for _, r := range reprs {
+		if r.Type == "diagram" && r.Description != nil {
+			return *r.Description
+		}
+	}
+	return ""
+}
+
+// otmToDfds groups the OTM architecture into data flow diagrams by their
+// otmDfdAttr attribute, falling back to a single diagram named after the
+// project for OTM documents produced by other tools. A component whose parent
+// trust zone isn't one of the trustZones keeps the zone's id as its
+// trust_zone, with a warning.
+func (p *ThreatmodelParser) otmToDfds(tm string, o otm.OtmSchemaJson, assetNames map[string]string) []*DataFlowDiagram {
+	if len(o.TrustZones) == 0 && len(o.Components) == 0 && len(o.Dataflows) == 0 {
+		return nil
+	}
+
+	dfds := []*DataFlowDiagram{}
+	dfdByName := make(map[string]*DataFlowDiagram)
+	getDfd := func(attrs map[string]interface{}) *DataFlowDiagram {
+		name, ok := otmString(attrs[otmDfdAttr])
+		if !ok || name == "" {
+			name = o.Project.Name
+		}
+		if d, ok := dfdByName[name]; ok {
+			return d
+		}
+		d := &DataFlowDiagram{Name: name}
+		dfdByName[name] = d
+		dfds = append(dfds, d)
+		return d
+	}
+
+	zones := make(map[string]*DfdTrustZone)
+	for _, otz := range o.TrustZones {
+		d := getDfd(otz.Attributes)
+		tz := &DfdTrustZone{Name: otz.Name}
+		if otz.Risk.TrustRating != DefaultTrustRating {
+			rating := int(math.Round(otz.Risk.TrustRating))
+			tz.TrustRating = &rating
+		}
+		zones[otz.Id] = tz
+		d.TrustZones = append(d.TrustZones, tz)
+	}
+
+	componentNames := make(map[string]string)
+	for _, c := range o.Components {
+		componentNames[c.Id] = c.Name
+	}
+
+	for _, c := range o.Components {
+		d := getDfd(c.Attributes)
+
+		var zone *DfdTrustZone
+		zoneName := ""
+		if c.Parent.TrustZone != nil {
+			if tz, ok := zones[*c.Parent.TrustZone]; ok {
+				zone = tz
+			} else {
+				zoneName = *c.Parent.TrustZone
+				p.warn(WarningUnsupported, tm, hcl.Range{},
+					"component '%s' has parent trust zone '%s', which isn't one of the trustZones, so its id was kept as the trust_zone", c.Name, zoneName)
+			}
+		}
+
+		switch otmComponentKind(c.Type) {
+		case "external_element":
+			e := &DfdExternal{Name: c.Name, TrustZone: zoneName}
+			if zone != nil {
+				zone.ExternalElements = append(zone.ExternalElements, e)
+			} else {
+				d.ExternalElements = append(d.ExternalElements, e)
+			}
+		case "data_store":
+			ds := &DfdData{Name: c.Name, TrustZone: zoneName}
+			if c.Assets != nil {
+				for _, id := range append(c.Assets.Stored, c.Assets.Processed...) {
+					if id == nil {
+						continue
+					}
+					if name, ok := assetNames[*id]; ok {
+						ds.IaLink = name
+						break
+					}
+				}
+			}
+			if zone != nil {
+				zone.DataStores = append(zone.DataStores, ds)
+			} else {
+				d.DataStores = append(d.DataStores, ds)
+			}
+		default:
+			pr := &DfdProcess{Name: c.Name, TrustZone: zoneName}
+			if zone != nil {
+				zone.Processes = append(zone.Processes, pr)
+			} else {
+				d.Processes = append(d.Processes, pr)
+			}
+		}
+	}
+
+	for _, df := range o.Dataflows {
+		d := getDfd(df.Attributes)
+		flow := &DfdFlow{
+			Name: df.Name,
+			From: df.Source,
+			To:   df.Destination,
+		}
+		if name, ok := componentNames[df.Source]; ok {
+			flow.From = name
+		}
+		if name, ok := componentNames[df.Destination]; ok {
+			flow.To = name
+		}
+		flow.Protocol, _ = otmString(df.Attributes["protocol"])
+		d.Flows = append(d.Flows, flow)
+	}
+
+	return dfds
+}
+
+// otmComponentKind maps an OTM component type onto the DFD element it becomes.
+// OTM types are free-form, so anything that isn't recognisably an external
+// element or a data store is treated as a process.
+func otmComponentKind(componentType string) string {
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(componentType)), "-", "_") {
+	case "external_element", "external_entity", "external", "actor":
+		return "external_element"
+	case "data_store", "datastore", "database":
+		return "data_store"
+	}
+	return "process"
+}
+
+func (t *Threat) addControlIfNotExist(newC *Control) {
+
+	for _, c := range t.Controls {
+		if c.Name == newC.Name {
+			return
+		}
+	}
+
+	t.Controls = append(t.Controls, newC)
+}
+
+func (p *ThreatmodelParser) addComponentIfNotExist(newC *Component) {
+
+	for _, c := range p.wrapped.Components {
+		if c.ComponentType == newC.ComponentType && c.ComponentName == newC.ComponentName {
+			return
+		}
+	}
+
+	p.wrapped.Components = append(p.wrapped.Components, newC)
+}
+
+func controlToComponent(c *Control) *Component {
+	return &Component{
+		ComponentType:       "control",
+		ComponentName:       c.Name,
+		Description:         c.Description,
+		Implemented:         c.Implemented,
+		ImplementationNotes: c.ImplementationNotes,
+		RiskReduction:       c.RiskReduction,
+		Attributes:          c.Attributes,
+	}
+}
+
+func strFromP(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func otmString(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+// otmBool accepts both real booleans and the "true"/"false" strings some OTM
+// producers emit.
+func otmBool(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return strings.EqualFold(b, "true")
+	}
+	return false
+}
+
+// otmStrings accepts a []string (an in-memory document) or a []interface{}
+// (one decoded from JSON).
+func otmStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
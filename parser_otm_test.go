@@ -0,0 +1,390 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/threatcl/go-otm/pkg/otm"
+)
+
+func TestParseOtmRoundTrip(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	internalRating := 20
+	tm := &Threatmodel{
+		Name:        "test",
+		Author:      "x",
+		Description: "a model",
+		DiagramLink: "http://linkieboop",
+		Attributes: &Attribute{
+			InternetFacing: true,
+			InitiativeSize: "Small",
+		},
+		Repository: []string{
+			"https://github.com/threatcl/spec",
+		},
+		AdditionalAttributes: []*AdditionalAttribute{
+			{Name: "owner", Value: "team"},
+		},
+		InformationAssets: []*InformationAsset{
+			{
+				Name:                      "blep",
+				Description:               "an asset",
+				Source:                    "source",
+				InformationClassification: "Restricted",
+			},
+		},
+		Threats: []*Threat{
+			{
+				Name:        "threat one",
+				Description: "threat description",
+				Stride:      []string{"Spoofing"},
+				ImpactType:  []string{"Confidentiality"},
+				Risk: &Risk{
+					Likelihood:       RiskLevelHigh,
+					Impact:           RiskLevelVeryHigh,
+					SeverityOverride: SeverityLow,
+					Rationale:        "because",
+				},
+				Controls: []*Control{
+					{
+						Name:                "control name",
+						Description:         "control description",
+						Implemented:         true,
+						ImplementationNotes: "implementation notes",
+						RiskReduction:       40,
+						Attributes: []*ControlAttribute{
+							{Name: "nist", Value: "AC-1"},
+						},
+					},
+				},
+			},
+			{
+				Name:        "threat two",
+				Description: "another threat",
+			},
+		},
+		DataFlowDiagrams: []*DataFlowDiagram{
+			{
+				Name: "first",
+				ExternalElements: []*DfdExternal{
+					{Name: "user"},
+				},
+				TrustZones: []*DfdTrustZone{
+					{
+						Name:        "internal",
+						TrustRating: &internalRating,
+						Processes: []*DfdProcess{
+							{Name: "api"},
+						},
+						DataStores: []*DfdData{
+							{Name: "db", IaLink: "blep"},
+						},
+					},
+				},
+				Flows: []*DfdFlow{
+					{Name: "request", From: "user", To: "api", Protocol: "HTTPS"},
+					{Name: "query", From: "api", To: "db"},
+				},
+			},
+			{
+				Name: "second",
+				Processes: []*DfdProcess{
+					{Name: "api"},
+					{Name: "worker"},
+				},
+				Flows: []*DfdFlow{
+					{Name: "job", From: "api", To: "worker"},
+				},
+			},
+		},
+	}
+
+	o, err := tm.RenderOtm()
+	if err != nil {
+		t.Fatalf("Error rendering otm: %s", err)
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err = tmParser.ParseOtm(o)
+	if err != nil {
+		t.Fatalf("Error importing otm: %s", err)
+	}
+
+	if len(tmParser.GetWrapped().Threatmodels) != 1 {
+		t.Fatalf("Expected 1 threat model, got %d", len(tmParser.GetWrapped().Threatmodels))
+	}
+
+	got := tmParser.GetWrapped().Threatmodels[0]
+
+	if got.Name != "test" || got.Author != "x" || got.Description != "a model" {
+		t.Errorf("Project fields weren't restored: %+v", got)
+	}
+
+	if got.DiagramLink != "http://linkieboop" {
+		t.Errorf("Expected diagram link to be restored, got '%s'", got.DiagramLink)
+	}
+
+	if got.Attributes == nil || !got.Attributes.InternetFacing || got.Attributes.InitiativeSize != "Small" {
+		t.Errorf("Attributes weren't restored: %+v", got.Attributes)
+	}
+
+	if len(got.Repository) != 1 || got.Repository[0] != "https://github.com/threatcl/spec" {
+		t.Errorf("Repository wasn't restored: %v", got.Repository)
+	}
+
+	if len(got.AdditionalAttributes) != 1 || got.AdditionalAttributes[0].Value != "team" {
+		t.Errorf("Additional attributes weren't restored: %+v", got.AdditionalAttributes)
+	}
+
+	if len(got.InformationAssets) != 1 {
+		t.Fatalf("Expected 1 information asset, got %d", len(got.InformationAssets))
+	}
+
+	ia := got.InformationAssets[0]
+	if ia.Name != "blep" || ia.Source != "source" || ia.InformationClassification != "Restricted" {
+		t.Errorf("Information asset wasn't restored: %+v", ia)
+	}
+
+	if len(got.Threats) != 2 {
+		t.Fatalf("Expected 2 threats, got %d", len(got.Threats))
+	}
+
+	tr := got.Threats[0]
+	if tr.Description != "threat description" {
+		t.Errorf("Unexpected threat description '%s'", tr.Description)
+	}
+
+	if len(tr.Stride) != 1 || tr.Stride[0] != "Spoofing" {
+		t.Errorf("Stride wasn't restored: %v", tr.Stride)
+	}
+
+	if len(tr.ImpactType) != 1 || tr.ImpactType[0] != "Confidentiality" {
+		t.Errorf("Impacts weren't restored: %v", tr.ImpactType)
+	}
+
+	if tr.Risk == nil {
+		t.Fatal("Risk wasn't restored")
+	}
+
+	if tr.Risk.Likelihood != RiskLevelHigh || tr.Risk.Impact != RiskLevelVeryHigh {
+		t.Errorf("Risk levels weren't restored: %+v", tr.Risk)
+	}
+
+	if tr.Risk.SeverityOverride != SeverityLow || tr.Risk.Rationale != "because" {
+		t.Errorf("Risk override/rationale weren't restored: %+v", tr.Risk)
+	}
+
+	if len(tr.Controls) != 1 {
+		t.Fatalf("Expected 1 control, got %d", len(tr.Controls))
+	}
+
+	c := tr.Controls[0]
+	if c.Name != "control name" || !c.Implemented || c.ImplementationNotes != "implementation notes" || c.RiskReduction != 40 {
+		t.Errorf("Control wasn't restored: %+v", c)
+	}
+
+	if len(c.Attributes) != 1 || c.Attributes[0].Name != "nist" || c.Attributes[0].Value != "AC-1" {
+		t.Errorf("Control attributes weren't restored: %+v", c.Attributes)
+	}
+
+	if got.Threats[1].Risk != nil {
+		t.Errorf("Threat without a risk block shouldn't get one: %+v", got.Threats[1].Risk)
+	}
+
+	if len(tmParser.GetWrapped().Components) != 0 {
+		t.Errorf("Linked mitigations shouldn't become components")
+	}
+
+	if len(got.DataFlowDiagrams) != 2 {
+		t.Fatalf("Expected 2 dfds, got %d", len(got.DataFlowDiagrams))
+	}
+
+	first := got.DataFlowDiagrams[0]
+	if first.Name != "first" || len(first.ExternalElements) != 1 || len(first.TrustZones) != 1 {
+		t.Fatalf("First dfd wasn't restored: %+v", first)
+	}
+
+	zone := first.TrustZones[0]
+	if zone.Name != "internal" || len(zone.Processes) != 1 || len(zone.DataStores) != 1 || zone.DataStores[0].IaLink != "blep" {
+		t.Errorf("Trust zone wasn't restored: %+v", zone)
+	}
+
+	if zone.TrustRating == nil || *zone.TrustRating != 20 {
+		t.Errorf("Trust rating wasn't restored: %v", zone.TrustRating)
+	}
+
+	if len(first.Flows) != 2 || first.Flows[0].Protocol != "HTTPS" || first.Flows[1].From != "api" || first.Flows[1].To != "db" {
+		t.Errorf("Flows weren't restored: %+v", first.Flows)
+	}
+
+	second := got.DataFlowDiagrams[1]
+	if second.Name != "second" || len(second.Processes) != 2 || len(second.Flows) != 1 {
+		t.Errorf("Second dfd wasn't restored: %+v", second)
+	}
+}
+
+func TestParseOtmArchitecture(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	o := otm.OtmSchemaJson{
+		OtmVersion: OtmVersion,
+		Project: otm.OtmSchemaJsonProject{
+			Name: "arch",
+			Id:   "arch",
+		},
+		Assets: []otm.OtmSchemaJsonAssetsElem{
+			{Name: "customer data", Id: "customer-data"},
+		},
+		TrustZones: []otm.OtmSchemaJsonTrustZonesElem{
+			{Name: "Internal", Id: "internal"},
+		},
+		Components: []otm.OtmSchemaJsonComponentsElem{
+			{Name: "user", Id: "user", Type: "external-element"},
+			{Name: "api", Id: "api", Type: "web-service", Parent: otm.Parent{TrustZone: pToStr("internal")}},
+			{
+				Name:   "db",
+				Id:     "db",
+				Type:   "data-store",
+				Parent: otm.Parent{TrustZone: pToStr("internal")},
+				Assets: &otm.AssetInstance{Stored: []*string{pToStr("customer-data")}},
+				Threats: []otm.Threat{
+					{Threat: "sqli", Mitigations: []otm.ThreatMitigationsElem{{Mitigation: pToStr("params")}}},
+				},
+			},
+		},
+		Dataflows: []otm.OtmSchemaJsonDataflowsElem{
+			{
+				Name:        "request",
+				Id:          "request",
+				Source:      "user",
+				Destination: "api",
+				Attributes:  map[string]interface{}{"protocol": "HTTPS"},
+			},
+			{Name: "query", Id: "query", Source: "api", Destination: "db"},
+		},
+		Threats: []otm.OtmSchemaJsonThreatsElem{
+			{Name: "sqli", Id: "sqli", Description: pToStr("SQL injection")},
+		},
+		Mitigations: []otm.OtmSchemaJsonMitigationsElem{
+			{Name: "params", Id: "params", Description: pToStr("Parameterised queries")},
+			{Name: "waf", Id: "waf", Description: pToStr("A web application firewall")},
+		},
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.ParseOtm(o)
+	if err != nil {
+		t.Fatalf("Error importing otm: %s", err)
+	}
+
+	got := tmParser.GetWrapped().Threatmodels[0]
+
+	if len(got.DataFlowDiagrams) != 1 {
+		t.Fatalf("Expected 1 dfd, got %d", len(got.DataFlowDiagrams))
+	}
+
+	dfd := got.DataFlowDiagrams[0]
+	if dfd.Name != "arch" {
+		t.Errorf("Expected the dfd to be named after the project, got '%s'", dfd.Name)
+	}
+
+	if len(dfd.ExternalElements) != 1 || dfd.ExternalElements[0].Name != "user" {
+		t.Errorf("External element wasn't imported: %+v", dfd.ExternalElements)
+	}
+
+	if len(dfd.TrustZones) != 1 {
+		t.Fatalf("Expected 1 trust zone, got %d", len(dfd.TrustZones))
+	}
+
+	zone := dfd.TrustZones[0]
+	if len(zone.Processes) != 1 || zone.Processes[0].Name != "api" {
+		t.Errorf("Process wasn't placed in its trust zone: %+v", zone.Processes)
+	}
+
+	if len(zone.DataStores) != 1 || zone.DataStores[0].IaLink != "customer data" {
+		t.Errorf("Data store wasn't linked to its asset: %+v", zone.DataStores)
+	}
+
+	if len(dfd.Flows) != 2 || dfd.Flows[0].From != "user" || dfd.Flows[0].To != "api" || dfd.Flows[0].Protocol != "HTTPS" {
+		t.Errorf("Flows weren't imported: %+v", dfd.Flows)
+	}
+
+	if len(got.Threats) != 1 || len(got.Threats[0].Controls) != 1 || got.Threats[0].Controls[0].Name != "params" {
+		t.Errorf("Mitigation wasn't linked through the component threat instance: %+v", got.Threats)
+	}
+
+	comps := tmParser.GetWrapped().Components
+	if len(comps) != 1 || comps[0].ComponentType != "control" || comps[0].ComponentName != "waf" {
+		t.Errorf("Unlinked mitigation should have become a control component: %+v", comps)
+	}
+}
+
+func TestParseOtmWarnings(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	o := otm.OtmSchemaJson{
+		OtmVersion: OtmVersion,
+		Project: otm.OtmSchemaJsonProject{
+			Name: "warned",
+			Id:   "warned",
+		},
+		TrustZones: []otm.OtmSchemaJsonTrustZonesElem{
+			{Name: "Internal", Id: "internal"},
+		},
+		Components: []otm.OtmSchemaJsonComponentsElem{
+			{Name: "api", Id: "api", Type: "process", Parent: otm.Parent{TrustZone: pToStr("internal")}},
+			{Name: "worker", Id: "worker", Type: "process", Parent: otm.Parent{TrustZone: pToStr("missing")}},
+		},
+		Threats: []otm.OtmSchemaJsonThreatsElem{
+			{
+				Name:       "sqli",
+				Id:         "sqli",
+				Categories: []*string{pToStr("Tampering"), pToStr("Confidentiality"), pToStr("Lateral Movement")},
+			},
+		},
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.ParseOtm(o)
+	if err != nil {
+		t.Fatalf("Error importing otm: %s", err)
+	}
+
+	tr := tmParser.GetWrapped().Threatmodels[0].Threats[0]
+	if len(tr.Stride) != 1 || len(tr.ImpactType) != 1 {
+		t.Errorf("Expected the known categories to be kept: %+v %+v", tr.Stride, tr.ImpactType)
+	}
+
+	dfd := tmParser.GetWrapped().Threatmodels[0].DataFlowDiagrams[0]
+	if len(dfd.Processes) != 1 || dfd.Processes[0].TrustZone != "missing" {
+		t.Errorf("Expected the unknown trust zone to be kept: %+v", dfd.Processes)
+	}
+
+	expected := []string{
+		"TM 'warned': unknown category 'Lateral Movement' of threat 'sqli' isn't a stride or impact, and was dropped",
+		"TM 'warned': component 'worker' has parent trust zone 'missing', which isn't one of the trustZones, so its id was kept as the trust_zone",
+	}
+
+	got := []string{}
+	for _, w := range tmParser.Warnings() {
+		got = append(got, w.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Incorrect warnings:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestParseOtmNoName(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	err := tmParser.ParseOtm(otm.OtmSchemaJson{})
+	if err == nil {
+		t.Errorf("Expected an error importing an otm document without a project name")
+	}
+}
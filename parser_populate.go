@@ -1,53 +1,53 @@
 package spec
 
-func (p *ThreatmodelParser) populateInitiativeSizeOptions() {
+func (c *parserConfig) populateInitiativeSizeOptions() {
 
-	for _, cfgInitiativeSizeOption := range p.specCfg.InitiativeSizes {
-		p.initiativeSizeOptions[cfgInitiativeSizeOption] = true
+	for _, cfgInitiativeSizeOption := range c.specCfg.InitiativeSizes {
+		c.initiativeSizeOptions[cfgInitiativeSizeOption] = true
 	}
-	p.defaultInitiativeSize = p.specCfg.DefaultInitiativeSize
+	c.defaultInitiativeSize = c.specCfg.DefaultInitiativeSize
 }
 
-func (p *ThreatmodelParser) populateInfoClassifications() {
+func (c *parserConfig) populateInfoClassifications() {
 
-	for _, cfgInfoClassification := range p.specCfg.InfoClassifications {
-		p.infoClassifications[cfgInfoClassification] = true
+	for _, cfgInfoClassification := range c.specCfg.InfoClassifications {
+		c.infoClassifications[cfgInfoClassification] = true
 	}
-	p.defaultInfoClassification = p.specCfg.DefaultInfoClassification
+	c.defaultInfoClassification = c.specCfg.DefaultInfoClassification
 }
 
-func (p *ThreatmodelParser) populateImpactTypes() {
-	for _, cfgImpactType := range p.specCfg.ImpactTypes {
-		p.impactTypes[cfgImpactType] = true
+func (c *parserConfig) populateImpactTypes() {
+	for _, cfgImpactType := range c.specCfg.ImpactTypes {
+		c.impactTypes[cfgImpactType] = true
 	}
 }
 
-func (p *ThreatmodelParser) populateStrideElements() {
-	for _, cfgStride := range p.specCfg.STRIDE {
-		p.strideElements[cfgStride] = true
+func (c *parserConfig) populateStrideElements() {
+	for _, cfgStride := range c.specCfg.STRIDE {
+		c.strideElements[cfgStride] = true
 	}
 }
 
 // populateRiskLevels seeds the valid likelihood/impact enums. These come from
 // the built-in risk model today; this is the seam where a future hcltmrc/config
 // override would feed a custom set (mirroring populateStrideElements).
-func (p *ThreatmodelParser) populateRiskLevels() {
+func (c *parserConfig) populateRiskLevels() {
 	for _, level := range RiskLevels {
-		p.riskLevels[level] = true
+		c.riskLevels[level] = true
 	}
 }
 
 // populateSeverityLevels seeds the valid severity bands an author may use as a
 // `severity` override.
-func (p *ThreatmodelParser) populateSeverityLevels() {
+func (c *parserConfig) populateSeverityLevels() {
 	for _, band := range SeverityLevels {
-		p.severityLevels[band] = true
+		c.severityLevels[band] = true
 	}
 }
 
-func (p *ThreatmodelParser) populateUptimeDepClassifications() {
-	for _, cfgUptimeDep := range p.specCfg.UptimeDepClassifications {
-		p.uptimeDepClassification[cfgUptimeDep] = true
+func (c *parserConfig) populateUptimeDepClassifications() {
+	for _, cfgUptimeDep := range c.specCfg.UptimeDepClassifications {
+		c.uptimeDepClassification[cfgUptimeDep] = true
 	}
-	p.defaultUptimeDepClassification = UptimeDependencyClassification(p.specCfg.DefaultUptimeDepClassification)
+	c.defaultUptimeDepClassification = UptimeDependencyClassification(c.specCfg.DefaultUptimeDepClassification)
 }
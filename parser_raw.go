@@ -0,0 +1,109 @@
+package spec
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// RawParseOptions control how ParseHCLRawWithOptions and
+// ParseJSONRawWithOptions treat their input
+type RawParseOptions struct {
+	// Filename is the name the input is given in diagnostics and warnings,
+	// and whose extension other tooling may rely on. Defaults to "STDIN".
+	Filename string
+
+	// BaseDir is the directory the input is treated as living in, which
+	// relative imports, including sources and file functions are resolved
+	// against. Defaults to the current directory, or to the root of the
+	// source FS (see SetSourceFS).
+	BaseDir string
+}
+
+// ParseHCLRawWithOptions parses a byte slice into HCL Threatmodels, as if it
+// were the file opts.Filename in opts.BaseDir, so that imports and including
+// are resolved the same way as for ParseFile. This is used for input that
+// isn't read from a file, such as a pipe or an upload.
+func (p *ThreatmodelParser) ParseHCLRawWithOptions(input []byte, opts RawParseOptions) error {
+	return p.ParseHCLRawWithOptionsContext(context.Background(), input, opts)
+}
+
+// ParseHCLRawWithOptionsContext is ParseHCLRawWithOptions, where ctx cancels
+// fetching any imports and including sources
+func (p *ThreatmodelParser) ParseHCLRawWithOptionsContext(ctx context.Context, input []byte, opts RawParseOptions) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseHCLRaw(ctx, input, opts)
+	})
+}
+
+func (p *ThreatmodelParser) parseHCLRaw(ctx context.Context, input []byte, opts RawParseOptions) error {
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseHCL(input, rawDisplayName(opts))
+
+	return p.parseRawFile(ctx, f, diags, opts)
+}
+
+// ParseJSONRawWithOptions parses a byte slice into HCL Threatmodels from JSON,
+// the same way as ParseHCLRawWithOptions
+func (p *ThreatmodelParser) ParseJSONRawWithOptions(input []byte, opts RawParseOptions) error {
+	return p.ParseJSONRawWithOptionsContext(context.Background(), input, opts)
+}
+
+// ParseJSONRawWithOptionsContext is ParseJSONRawWithOptions, where ctx
+// cancels fetching any imports and including sources
+func (p *ThreatmodelParser) ParseJSONRawWithOptionsContext(ctx context.Context, input []byte, opts RawParseOptions) error {
+	return p.run(func(run *ThreatmodelParser) error {
+		return run.parseJSONRaw(ctx, input, opts)
+	})
+}
+
+func (p *ThreatmodelParser) parseJSONRaw(ctx context.Context, input []byte, opts RawParseOptions) error {
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseJSON(input, rawDisplayName(opts))
+
+	return p.parseRawFile(ctx, f, diags, opts)
+}
+
+func (p *ThreatmodelParser) parseRawFile(ctx context.Context, f *hcl.File, diags hcl.Diagnostics, opts RawParseOptions) error {
+	ctx, end := p.beginFetch(ctx)
+	defer end()
+
+	if diags.HasErrors() {
+		return diags
+	}
+
+	filename, err := p.rawFilename(opts)
+	if err != nil {
+		return err
+	}
+
+	err = p.parseHCL(ctx, f, newSourceFiles(f), filename, false)
+	if err != nil {
+		return err
+	}
+
+	return p.includeAll(ctx, filename)
+}
+
+func rawDisplayName(opts RawParseOptions) string {
+	if opts.Filename == "" {
+		return "STDIN"
+	}
+
+	return opts.Filename
+}
+
+// rawFilename is the absolute path raw input is parsed as. With a source FS,
+// it's rooted so that it resolves within the FS rather than the current
+// directory.
+func (p *ThreatmodelParser) rawFilename(opts RawParseOptions) (string, error) {
+	filename := filepath.Join(opts.BaseDir, rawDisplayName(opts))
+
+	if p.sourceFS != nil {
+		return filepath.Join(string(filepath.Separator), filename), nil
+	}
+
+	return filepath.Abs(filename)
+}
@@ -0,0 +1,257 @@
+package spec
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const rawFSModel = `spec_version = "0.4.0"
+
+threatmodel "uploaded" {
+  author    = "@me"
+  imports   = ["../library/controls.hcl"]
+  including = ["base.hcl"]
+
+  threat "phishing" {
+    description     = "An attacker phishes a user"
+    control_imports = ["import.control.mfa"]
+  }
+}
+`
+
+func rawTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"library/controls.hcl": &fstest.MapFile{Data: []byte(`spec_version = "0.4.0"
+
+component "control" "mfa" {
+  description = "Use MFA"
+}
+`)},
+		"models/base.hcl": &fstest.MapFile{Data: []byte(`spec_version = "0.4.0"
+
+threatmodel "base" {
+  author    = "@me"
+  including = ["shared/assets.hcl"]
+
+  threat "base_threat" {
+    description = "From the base model"
+  }
+}
+`)},
+		"models/shared/assets.hcl": &fstest.MapFile{Data: []byte(`spec_version = "0.4.0"
+
+threatmodel "shared" {
+  author = "@me"
+
+  information_asset "creds" {
+    information_classification = "Confidential"
+  }
+}
+`)},
+	}
+}
+
+func TestParseHCLRawWithOptionsFS(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceFS(rawTestFS())
+
+	err := tmParser.ParseHCLRawWithOptions([]byte(rawFSModel), RawParseOptions{
+		Filename: "upload.hcl",
+		BaseDir:  "models",
+	})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	threats := []string{}
+	for _, th := range tm.Threats {
+		threats = append(threats, th.Name)
+	}
+	if strings.Join(threats, ",") != "phishing,base_threat" {
+		t.Errorf("Expected the included threat, got %v", threats)
+	}
+
+	if len(tm.InformationAssets) != 1 || tm.InformationAssets[0].Name != "creds" {
+		t.Errorf("Expected the nested included information_asset, got %+v", tm.InformationAssets)
+	}
+
+	if len(tm.Threats[0].Controls) != 1 || tm.Threats[0].Controls[0].Description != "Use MFA" {
+		t.Errorf("Expected the imported control, got %+v", tm.Threats[0].Controls)
+	}
+
+	for _, w := range tmParser.Warnings() {
+		if w.Kind == WarningUnsupported {
+			t.Errorf("Unexpected warning: %s", w)
+		}
+	}
+}
+
+func TestParseHCLRawWithOptionsFSErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"missing",
+			`threatmodel "tm" {
+  author  = "@me"
+  imports = ["missing.hcl"]
+}`,
+			"can't read 'missing.hcl'",
+		},
+		{
+			"outside_fs",
+			`threatmodel "tm" {
+  author    = "@me"
+  including = ["../../../../etc/passwd"]
+}`,
+			"can't read '../../../../etc/passwd'",
+		},
+		{
+			"invalid",
+			`threatmodel "tm" {
+  author    = "@me"
+  including = ["broken.hcl"]
+}`,
+			"Unclosed configuration block",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			defaultCfg := &ThreatmodelSpecConfig{}
+			defaultCfg.setDefaults()
+			tmParser := NewThreatmodelParser(defaultCfg)
+
+			fsys := rawTestFS()
+			fsys["models/broken.hcl"] = &fstest.MapFile{Data: []byte(`threatmodel "broken" {`)}
+			tmParser.SetSourceFS(fsys)
+
+			err := tmParser.ParseHCLRawWithOptions([]byte(tc.in), RawParseOptions{BaseDir: "models"})
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawWithOptionsFSFunctions(t *testing.T) {
+	cases := []struct {
+		name    string
+		baseDir string
+		expr    string
+		exp     string
+		expErr  string
+	}{
+		{"file", "models", `file("notes.txt")`, "From the FS", ""},
+		{"file_root", "", `file("models/notes.txt")`, "From the FS", ""},
+		{"host_file", "", `file("etc/passwd")`, "", "can't read 'etc/passwd'"},
+		{"host_filebase64", "", `filebase64("etc/passwd")`, "", "can't read 'etc/passwd'"},
+		{"host_templatefile", "", `templatefile("etc/passwd", {})`, "", "can't read 'etc/passwd'"},
+		{"host_fileexists", "", `tostring(fileexists("etc/passwd"))`, "false", ""},
+		{"parent", "models", `file("../..")`, "", "outside the threat model's directory"},
+		{"parent_host", "models", `file("../../etc/passwd")`, "", "outside the threat model's directory"},
+		{"absolute", "models", `file("/etc/passwd")`, "", "must be relative"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			defaultCfg := &ThreatmodelSpecConfig{}
+			defaultCfg.setDefaults()
+			tmParser := NewThreatmodelParser(defaultCfg)
+
+			fsys := rawTestFS()
+			fsys["models/notes.txt"] = &fstest.MapFile{Data: []byte("From the FS")}
+			tmParser.SetSourceFS(fsys)
+
+			err := tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "tm" {
+  author      = "@me"
+  description = `+tc.expr+`
+}
+`), RawParseOptions{BaseDir: tc.baseDir})
+
+			if tc.expErr != "" {
+				if err == nil {
+					t.Fatalf("Expected an error, got '%s'", tmParser.GetWrapped().Threatmodels[0].Description)
+				}
+
+				if !strings.Contains(err.Error(), tc.expErr) {
+					t.Errorf("Error '%s' doesn't contain '%s'", err, tc.expErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			desc := tmParser.GetWrapped().Threatmodels[0].Description
+			if desc != tc.exp {
+				t.Errorf("Expected '%s', got '%s'", tc.exp, desc)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawWithOptionsBaseDir(t *testing.T) {
+	input, err := os.ReadFile("./testdata/threat-dedup-including.hcl")
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err = tmParser.ParseHCLRawWithOptions(input, RawParseOptions{BaseDir: "./testdata"})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if len(tm.Threats) != 3 {
+		t.Errorf("Expected 3 threats once the base is included, got %d", len(tm.Threats))
+	}
+}
+
+func TestParseJSONRawWithOptionsFS(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceFS(rawTestFS())
+
+	err := tmParser.ParseJSONRawWithOptions([]byte(`{
+  "spec_version": "0.4.0",
+  "threatmodel": {
+    "uploaded": {
+      "author": "@me",
+      "including": ["base.hcl"]
+    }
+  }
+}`), RawParseOptions{Filename: "upload.json", BaseDir: "models"})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if len(tm.Threats) != 1 || tm.Threats[0].Name != "base_threat" {
+		t.Errorf("Expected the included threat, got %+v", tm.Threats)
+	}
+}
@@ -0,0 +1,406 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceResolver fetches the threat models and component libraries referred
+// to by `imports` and `including`
+type SourceResolver interface {
+	// Resolve fetches source, as written in the threat model, resolving
+	// relative sources against baseDir (the directory of the file referring
+	// to it). It should give up once ctx is done.
+	Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error)
+}
+
+// ResolvedSource is a fetched threat model file
+type ResolvedSource struct {
+	// Path is where the file was fetched to. It names the file in
+	// diagnostics, and relative sources within it are resolved against its
+	// directory.
+	Path string
+	// Content is the file's content, or nil to read it from Path
+	Content []byte
+	// Cleanup, if set, is called once the parse that fetched the file is
+	// done, such as to remove the temp directory it was fetched to
+	Cleanup func()
+}
+
+func (r *ResolvedSource) cleanup() {
+	if r.Cleanup != nil {
+		r.Cleanup()
+	}
+}
+
+// SetSourceResolver sets how `imports` and `including` sources are fetched.
+// A nil r restores the default, a GetterResolver using the parser's cache
+// directory and offline mode.
+func (p *ThreatmodelParser) SetSourceResolver(r SourceResolver) {
+	p.resolver = r
+}
+
+// SetFetchTimeout limits how long fetching each `imports` or `including`
+// source may take. Zero, the default, means no limit beyond the context the
+// parse was given (see ParseFileContext).
+func (p *ThreatmodelParser) SetFetchTimeout(timeout time.Duration) {
+	p.fetchTimeout = timeout
+}
+
+// resolveSource fetches source with p's resolver, within the fetch timeout
+func (p *ThreatmodelParser) resolveSource(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	if p.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.fetchTimeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("can't fetch '%s': %w", source, err)
+	}
+
+	resolved, err := p.sourceResolver().Resolve(ctx, source, baseDir)
+	if err != nil {
+		// Make sure a timeout or cancellation can be told apart, as not every
+		// getter reports it as such
+		if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+			return nil, fmt.Errorf("can't fetch '%s': %w (%s)", source, ctxErr, err)
+		}
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// sourceResolver returns the resolver sources are fetched with. A source FS
+// goes behind an AllowlistResolver, so the allowlist still applies to what
+// the FS serves.
+func (p *ThreatmodelParser) sourceResolver() SourceResolver {
+	r := p.resolver
+	if r == nil {
+		r = &GetterResolver{CacheDir: p.cacheDir, Offline: p.offline}
+	}
+
+	if p.sourceFS == nil {
+		return r
+	}
+
+	if a, ok := r.(*AllowlistResolver); ok {
+		return a.withFS(p.sourceFS)
+	}
+
+	return &FSResolver{FS: p.sourceFS, Next: r}
+}
+
+// GetterResolver fetches sources with go-getter, so they can be local paths,
+// git repositories, URLs and so on. A source can name a file within what was
+// fetched after a "|", such as github.com/xntrik/hcltm|examples/aws.hcl
+type GetterResolver struct {
+	// CacheDir enables the source cache, see SetCacheDir
+	CacheDir string
+	// Offline only allows remote sources that are already cached, see
+	// SetOffline
+	Offline bool
+}
+
+func (r *GetterResolver) Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	// @TODO The below is a hack to remote URLs
+	// We allow an explicit "file" to be referenced after
+	// a whole directory (i.e. git repo) is cloned
+	// see: https://github.com/hashicorp/go-getter/issues/98
+
+	// for example, the below allows a remote URL to look like
+	// github.com/xntrik/hcltm|examples/aws-security-checklist.hcl
+	// OR, something more complex, like a private repo
+	// git::ssh://git@github.com/xntrik/test|aws-security-checklist.hcl
+	splitSource := strings.SplitN(source, "|", 2)
+
+	includeFile := ""
+
+	switch len(splitSource) {
+	case 1:
+		includeFile = filepath.Base(source)
+	case 2:
+		includeFile = splitSource[1]
+	}
+
+	subpath := len(splitSource) == 2
+
+	if subpath {
+		// A local source is checked where it is, as it's copied into the
+		// cache, which would hide where its links lead
+		normalized, err := normalizeSource(source, baseDir)
+		if err == nil && isLocalSource(normalized) {
+			err = checkSubpath(source, localSourcePath(strings.SplitN(normalized, "|", 2)[0]), includeFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if r.CacheDir != "" {
+		entry, content, err := r.cachedSource(ctx, source, splitSource[0], includeFile, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if subpath {
+			err = checkSubpath(source, entry, includeFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &ResolvedSource{Path: filepath.Join(entry, includeFile), Content: content}, nil
+	}
+
+	if r.Offline {
+		_, local, err := sourceCacheKey(source, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		if !local {
+			return nil, fmt.Errorf("can't fetch '%s': offline mode requires a cache directory", source)
+		}
+	}
+
+	tmpRoot, err := os.MkdirTemp("", "hcltm")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmpRoot) }
+
+	// @TODO The below refers to a non-existent folder
+	// to cater for https://github.com/hashicorp/go-getter/issues/114
+	tmpDir := fmt.Sprintf("%s/nest", tmpRoot)
+
+	err = getSource(ctx, splitSource[0], tmpDir, baseDir, false)
+	if err == nil && subpath {
+		err = checkSubpath(source, tmpDir, includeFile)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return &ResolvedSource{Path: filepath.Join(tmpDir, includeFile), Cleanup: cleanup}, nil
+}
+
+// checkSubpath makes sure the |subpath of source, once any symlinks are
+// followed, is within dir, where source was fetched to, so that a fetched
+// repository can't link to a file elsewhere on the machine
+func checkSubpath(source, dir, subpath string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, subpath))
+	if err != nil {
+		// It doesn't exist, so reading it will fail on its own
+		return nil
+	}
+
+	if !withinDir(root, resolved) {
+		return fmt.Errorf("can't fetch '%s': '%s' links outside of the fetched source", source, subpath)
+	}
+
+	return nil
+}
+
+// forcedGetterRegexp matches a source with an explicit getter, such as
+// git::https://github.com/org/repo, the same way go-getter does
+var forcedGetterRegexp = regexp.MustCompile(`^([A-Za-z0-9]+)::(.+)$`)
+
+// AllowlistResolver only passes sources on to Next that are within Root, or
+// from an allowed host using only allowed schemes. Everything else is an
+// error, so a threat model can't read arbitrary local files or reach
+// arbitrary hosts through `imports` or `including`.
+type AllowlistResolver struct {
+	// Next fetches the allowed sources. Defaults to a GetterResolver.
+	Next SourceResolver
+	// Root is the directory local sources, including file:: ones, must be
+	// within once symlinks are followed. Local sources aren't allowed if
+	// it's empty. With a source FS (see SetSourceFS), Root is a directory
+	// within the FS.
+	Root string
+	// Schemes are the allowed URL schemes and explicit getters, such as
+	// "https" or "git". A remote source needs both of its URL scheme and
+	// getter (if it has one) to be allowed.
+	Schemes []string
+	// Hosts are the allowed hosts of remote sources, such as "github.com"
+	Hosts []string
+
+	// inFS is set when local sources are read from a source FS, see withFS
+	inFS bool
+}
+
+// withFS returns a copy of r that checks sources before they're read from
+// fsys, with Root being a directory within fsys
+func (r *AllowlistResolver) withFS(fsys fs.FS) *AllowlistResolver {
+	next := r.Next
+	if next == nil {
+		next = &GetterResolver{}
+	}
+
+	return &AllowlistResolver{
+		Next:    &FSResolver{FS: fsys, Next: next},
+		Root:    r.Root,
+		Schemes: r.Schemes,
+		Hosts:   r.Hosts,
+		inFS:    true,
+	}
+}
+
+func (r *AllowlistResolver) Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	err := r.check(source, baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("source '%s' isn't allowed: %w", source, err)
+	}
+
+	next := r.Next
+	if next == nil {
+		next = &GetterResolver{}
+	}
+
+	return next.Resolve(ctx, source, baseDir)
+}
+
+func (r *AllowlistResolver) check(source, baseDir string) error {
+	splitSource := strings.SplitN(source, "|", 2)
+	if len(splitSource) == 2 && !filepath.IsLocal(splitSource[1]) {
+		return fmt.Errorf("'%s' is outside of the fetched source", splitSource[1])
+	}
+
+	normalized, err := normalizeSource(source, baseDir)
+	if err != nil {
+		return err
+	}
+
+	if isLocalSource(normalized) {
+		if r.Root == "" {
+			return fmt.Errorf("local sources aren't allowed")
+		}
+
+		if r.inFS {
+			// Nothing outside of the FS can be reached through it, so only
+			// the path itself has to be within the root
+			root := filepath.Join(string(filepath.Separator), r.Root)
+			if !withinDir(root, localSourcePath(normalized)) {
+				return fmt.Errorf("it's outside of '%s'", r.Root)
+			}
+
+			return nil
+		}
+
+		root, err := filepath.Abs(r.Root)
+		if err != nil {
+			return err
+		}
+
+		// Checked against the root once symlinks are followed, as well
+		rel, err := filepath.Rel(root, localSourcePath(normalized))
+		if err == nil {
+			_, err = resolveModelPath(root, rel)
+		}
+		if err != nil {
+			return fmt.Errorf("it's outside of '%s'", r.Root)
+		}
+
+		return nil
+	}
+
+	getterSrc := strings.SplitN(normalized, "|", 2)[0]
+	if m := forcedGetterRegexp.FindStringSubmatch(getterSrc); m != nil {
+		if !containsFold(r.Schemes, m[1]) {
+			return fmt.Errorf("the '%s' getter isn't allowed", m[1])
+		}
+		getterSrc = m[2]
+	}
+
+	u, err := url.Parse(getterSrc)
+	if err != nil {
+		return err
+	}
+
+	if !containsFold(r.Schemes, u.Scheme) {
+		return fmt.Errorf("the '%s' scheme isn't allowed", u.Scheme)
+	}
+
+	if !containsFold(r.Hosts, u.Hostname()) {
+		return fmt.Errorf("the host '%s' isn't allowed", u.Hostname())
+	}
+
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FakeResolver serves sources from memory, for tests. Sources are looked up
+// exactly as written in the threat model, and any other source is an error.
+type FakeResolver struct {
+	// Sources maps each source to the content of the file it resolves to
+	Sources map[string]string
+	// Delay is how long each Resolve takes, or until its context is done, to
+	// stand in for a slow fetch
+	Delay time.Duration
+
+	mu       sync.Mutex
+	resolved []string
+}
+
+func (r *FakeResolver) Resolve(ctx context.Context, source, baseDir string) (*ResolvedSource, error) {
+	r.mu.Lock()
+	r.resolved = append(r.resolved, source)
+	r.mu.Unlock()
+
+	if r.Delay > 0 {
+		timer := time.NewTimer(r.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("can't fetch '%s': %w", source, ctx.Err())
+		}
+	}
+
+	content, ok := r.Sources[source]
+	if !ok {
+		return nil, fmt.Errorf("can't fetch '%s': it isn't a source of the fake resolver", source)
+	}
+
+	splitSource := strings.SplitN(source, "|", 2)
+	name := filepath.Base(splitSource[len(splitSource)-1])
+
+	return &ResolvedSource{
+		Path:    filepath.Join(baseDir, name),
+		Content: []byte(content),
+	}, nil
+}
+
+// Resolved returns every source Resolve was called with, in order
+func (r *FakeResolver) Resolved() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.resolved...)
+}
@@ -0,0 +1,478 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const resolverTestModel = `spec_version = "0.4.0"
+
+threatmodel "tm" {
+  author    = "@me"
+  imports   = ["https://example.com/controls.hcl"]
+  including = ["base.hcl"]
+
+  threat "phishing" {
+    description     = "An attacker phishes a user"
+    control_imports = ["import.control.mfa"]
+  }
+}
+`
+
+func resolverTestFake() *FakeResolver {
+	return &FakeResolver{
+		Sources: map[string]string{
+			"https://example.com/controls.hcl": `component "control" "mfa" {
+  description = "Use MFA"
+}
+`,
+			"base.hcl": `threatmodel "base" {
+  author    = "@me"
+  including = ["github.com/org/shared|assets.hcl"]
+
+  threat "base_threat" {
+    description = "From the base model"
+  }
+}
+`,
+			"github.com/org/shared|assets.hcl": `threatmodel "shared" {
+  author = "@me"
+
+  information_asset "creds" {
+    information_classification = "Confidential"
+  }
+}
+`,
+		},
+	}
+}
+
+func TestFakeResolver(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	fake := resolverTestFake()
+	tmParser.SetSourceResolver(fake)
+
+	err := tmParser.ParseHCLRawWithOptions([]byte(resolverTestModel), RawParseOptions{Filename: "tm.hcl"})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if len(tm.Threats) != 2 || len(tm.InformationAssets) != 1 {
+		t.Errorf("Expected the included threat and information_asset, got %+v and %+v", tm.Threats, tm.InformationAssets)
+	}
+
+	if len(tm.Threats[0].Controls) != 1 || tm.Threats[0].Controls[0].Description != "Use MFA" {
+		t.Errorf("Expected the imported control, got %+v", tm.Threats[0].Controls)
+	}
+
+	expected := []string{"https://example.com/controls.hcl", "base.hcl", "github.com/org/shared|assets.hcl"}
+	if strings.Join(fake.Resolved(), ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to be resolved, got %v", expected, fake.Resolved())
+	}
+}
+
+func TestFakeResolverMissing(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetSourceResolver(&FakeResolver{})
+
+	err := tmParser.ParseHCLRawWithOptions([]byte(resolverTestModel), RawParseOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	exp := "can't fetch 'https://example.com/controls.hcl': it isn't a source of the fake resolver"
+	if !strings.Contains(err.Error(), exp) {
+		t.Errorf("Error '%s' doesn't contain '%s'", err, exp)
+	}
+}
+
+func TestAllowlistResolver(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, "models"), 0o755)
+	if err != nil {
+		t.Fatalf("Error creating dir: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(outside, "secret.hcl"), []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	err = os.Symlink(outside, filepath.Join(root, "models", "escape"))
+	if err != nil {
+		t.Fatalf("Error creating symlink: %s", err)
+	}
+
+	baseDir := filepath.Join(root, "models")
+
+	cases := []struct {
+		name   string
+		source string
+		exp    string
+	}{
+		{"local", "base.hcl", ""},
+		{"local_parent", "../shared/base.hcl", ""},
+		{"local_forced", "file::./base.hcl", ""},
+		{"local_escape", "../../../../etc/passwd", "it's outside of"},
+		{"local_absolute", "/etc/passwd", "it's outside of"},
+		{"local_forced_escape", "file::/etc/passwd", "it's outside of"},
+		{"local_symlink_escape", "escape/secret.hcl", "it's outside of"},
+		{"remote", "https://example.com/controls.hcl", ""},
+		{"remote_git", "git::https://github.com/org/repo|controls.hcl", ""},
+		{"remote_shorthand", "github.com/org/repo|controls.hcl", ""},
+		{"remote_scheme", "http://example.com/controls.hcl", "the 'http' scheme isn't allowed"},
+		{"remote_host", "https://evil.example.net/controls.hcl", "the host 'evil.example.net' isn't allowed"},
+		{"remote_getter", "s3::https://example.com/bucket/controls.hcl", "the 's3' getter isn't allowed"},
+		{"remote_subpath_escape", "github.com/org/repo|../../../etc/passwd", "'../../../etc/passwd' is outside of the fetched source"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := &FakeResolver{Sources: map[string]string{tc.source: ""}}
+			r := &AllowlistResolver{
+				Next:    fake,
+				Root:    root,
+				Schemes: []string{"https", "git"},
+				Hosts:   []string{"example.com", "github.com"},
+			}
+
+			_, err := r.Resolve(context.Background(), tc.source, baseDir)
+
+			if tc.exp == "" {
+				if err != nil {
+					t.Errorf("Expected '%s' to be allowed: %s", tc.source, err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected '%s' not to be allowed", tc.source)
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+
+			if len(fake.Resolved()) != 0 {
+				t.Errorf("Expected nothing to be fetched, got %v", fake.Resolved())
+			}
+		})
+	}
+}
+
+func TestAllowlistResolverNoRoot(t *testing.T) {
+	r := &AllowlistResolver{Next: &FakeResolver{Sources: map[string]string{"base.hcl": ""}}}
+
+	_, err := r.Resolve(context.Background(), "base.hcl", t.TempDir())
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	exp := "local sources aren't allowed"
+	if !strings.Contains(err.Error(), exp) {
+		t.Errorf("Error '%s' doesn't contain '%s'", err, exp)
+	}
+}
+
+func TestAllowlistResolverIncluding(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	tmParser.SetSourceResolver(&AllowlistResolver{Root: "./testdata"})
+
+	err := tmParser.ParseFile("./testdata/threat-dedup-including.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = tmParser.ParseHCLRawWithOptions([]byte(`threatmodel "malicious" {
+  author    = "@me"
+  including = ["../../../../../etc/passwd"]
+}
+`), RawParseOptions{BaseDir: "./testdata"})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	exp := "source '../../../../../etc/passwd' isn't allowed"
+	if !strings.Contains(err.Error(), exp) {
+		t.Errorf("Error '%s' doesn't contain '%s'", err, exp)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	fake := resolverTestFake()
+	fake.Delay = time.Minute
+	tmParser.SetSourceResolver(fake)
+	tmParser.SetFetchTimeout(10 * time.Millisecond)
+
+	start := time.Now()
+	err := tmParser.ParseHCLRawWithOptions([]byte(resolverTestModel), RawParseOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline exceeded error, got '%s'", err)
+	}
+
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Expected the fetch to time out, it took %s", time.Since(start))
+	}
+}
+
+func TestParseContextCanceled(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	fake := resolverTestFake()
+	fake.Delay = time.Minute
+	tmParser.SetSourceResolver(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := tmParser.ParseHCLRawWithOptionsContext(ctx, []byte(resolverTestModel), RawParseOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a canceled error, got '%v'", err)
+	}
+
+	// Nothing is fetched once the context is done
+	err = tmParser.ParseFileContext(ctx, "./testdata/tm-withimport.hcl", false)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a canceled error, got '%v'", err)
+	}
+	if len(fake.Resolved()) != 1 {
+		t.Errorf("Expected a single fetch, got %v", fake.Resolved())
+	}
+}
+
+func TestGetterResolverCleanup(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFileContext(context.Background(), "./testdata/threat-dedup-including.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	err = tmParser.ParseFile("./testdata/tm-withimport.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Error reading dir: %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("Expected the temp directories to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestAllowlistResolverSourceFS(t *testing.T) {
+	cases := []struct {
+		name string
+		root string
+		in   string
+		exp  string
+	}{
+		{"within_root", "models", `threatmodel "tm" {
+  author    = "@me"
+  including = ["base.hcl"]
+}`, ""},
+		{"outside_root", "models", rawFSModel, "source '../library/controls.hcl' isn't allowed: it's outside of 'models'"},
+		{"no_root", "", rawFSModel, "local sources aren't allowed"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			defaultCfg := &ThreatmodelSpecConfig{}
+			defaultCfg.setDefaults()
+			tmParser := NewThreatmodelParser(defaultCfg)
+			tmParser.SetSourceFS(rawTestFS())
+			tmParser.SetSourceResolver(&AllowlistResolver{Root: tc.root})
+
+			err := tmParser.ParseHCLRawWithOptions([]byte(tc.in), RawParseOptions{BaseDir: "models"})
+
+			if tc.exp == "" {
+				if err != nil {
+					t.Fatalf("Error parsing legit TM file: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestGetterResolverSymlinkSubpath(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.hcl")
+	err := os.WriteFile(secret, []byte("secret"), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	baseDir := t.TempDir()
+	repo := filepath.Join(baseDir, "repo")
+	err = os.MkdirAll(repo, 0o755)
+	if err != nil {
+		t.Fatalf("Error creating dir: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(repo, "ok.hcl"), []byte(`threatmodel "ok" {
+  author = "@me"
+}
+`), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	err = os.Symlink(secret, filepath.Join(repo, "x.hcl"))
+	if err != nil {
+		t.Fatalf("Error creating symlink: %s", err)
+	}
+
+	sources := map[string]string{"local": "./repo"}
+
+	// A repository that's cloned keeps its links, as a remote one would
+	if _, err := exec.LookPath("git"); err == nil {
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "."},
+			{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = repo
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("Error running git %v: %s: %s", args, err, out)
+			}
+		}
+		sources["git"] = "git::file://" + filepath.ToSlash(repo)
+	}
+
+	for name, source := range sources {
+		for _, cached := range []bool{false, true} {
+			r := &GetterResolver{}
+			if cached {
+				r.CacheDir = t.TempDir()
+			}
+
+			resolved, err := r.Resolve(context.Background(), source+"|ok.hcl", baseDir)
+			if err != nil {
+				t.Errorf("%s (cached: %t): Expected the source to be fetched: %s", name, cached, err)
+			} else {
+				resolved.cleanup()
+			}
+
+			_, err = r.Resolve(context.Background(), source+"|x.hcl", baseDir)
+			if err == nil {
+				t.Errorf("%s (cached: %t): Expected an error", name, cached)
+				continue
+			}
+
+			exp := "'x.hcl' links outside of the fetched source"
+			if !strings.Contains(err.Error(), exp) {
+				t.Errorf("%s (cached: %t): Error '%s' doesn't contain '%s'", name, cached, err, exp)
+			}
+		}
+	}
+}
+
+func TestAllowlistResolverXTerraformGet(t *testing.T) {
+	secretDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(secretDir, "secret.hcl"), []byte(`threatmodel "secret" {
+  author = "@me"
+}
+`), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing file: %s", err)
+	}
+
+	cases := []struct {
+		name   string
+		target string
+		path   string
+	}{
+		{"passwd", "file:///etc/passwd", "/models/|passwd"},
+		{"etc", "file:///etc", "/models/|passwd"},
+		{"local_dir", "file://" + filepath.ToSlash(secretDir), "/models/|secret.hcl"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Terraform-Get", tc.target)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			// A path ending in a slash is fetched as a directory, which is
+			// when go-getter would follow X-Terraform-Get
+			r := &AllowlistResolver{
+				Schemes: []string{"http"},
+				Hosts:   []string{"127.0.0.1"},
+			}
+
+			resolved, err := r.Resolve(context.Background(), srv.URL+tc.path, t.TempDir())
+			if err == nil {
+				defer resolved.cleanup()
+
+				_, err = os.ReadFile(resolved.Path)
+			}
+			if err == nil {
+				t.Fatalf("Expected '%s' not to be fetched", tc.target)
+			}
+
+			exp := "no such file or directory"
+			if !strings.Contains(err.Error(), exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, exp)
+			}
+		})
+	}
+}
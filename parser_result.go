@@ -0,0 +1,104 @@
+package spec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// ParseResult is what a single call to Parse or ParseRaw produced. It belongs
+// to the caller: nothing else holds on to it, and later parses with the same
+// parser don't change it.
+type ParseResult struct {
+	// Wrapped holds the parsed threat models, or is nil if the parse failed
+	Wrapped *ThreatmodelWrapped
+	// Warnings are as returned by ThreatmodelParser.Warnings, for this parse
+	// only. They're kept when the parse fails.
+	Warnings []Warning
+	// DroppedBlocks are as returned by ThreatmodelParser.DroppedBlocks
+	DroppedBlocks []DroppedBlock
+	// IncludeConflicts are as returned by
+	// ThreatmodelParser.IncludeConflicts
+	IncludeConflicts []IncludeConflict
+}
+
+// Parse parses the threat model at path, which is either a single HCL or JSON
+// file (see ParseFile) or a directory (see ParseDir), including all of its
+// imports and including sources.
+//
+// Unlike ParseFile, the parse's results are returned rather than replacing
+// the parser's. The returned result is non-nil even if err isn't, so that any
+// warnings found before the failure can be reported.
+func (p *ThreatmodelParser) Parse(ctx context.Context, path string) (*ParseResult, error) {
+	run := p.newRun()
+
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		err = run.parseDir(ctx, path)
+	} else {
+		err = run.parseFile(ctx, path, false)
+	}
+
+	return run.result(err), err
+}
+
+// ParseRaw is Parse for input that isn't read from a file, in the same way as
+// ParseHCLRawWithOptions. The input is JSON if opts.Filename ends in ".json",
+// and HCL otherwise.
+func (p *ThreatmodelParser) ParseRaw(ctx context.Context, input []byte, opts RawParseOptions) (*ParseResult, error) {
+	run := p.newRun()
+
+	var err error
+	if filepath.Ext(opts.Filename) == ".json" {
+		err = run.parseJSONRaw(ctx, input, opts)
+	} else {
+		err = run.parseHCLRaw(ctx, input, opts)
+	}
+
+	return run.result(err), err
+}
+
+// run calls parse with a parser of its own (see newRun), then replaces p's
+// results with the run's, even if parse failed
+func (p *ThreatmodelParser) run(parse func(run *ThreatmodelParser) error) error {
+	run := p.newRun()
+	err := parse(run)
+
+	p.resultsMu.Lock()
+	defer p.resultsMu.Unlock()
+
+	p.wrapped = run.wrapped
+	p.warnings = run.warnings
+	p.droppedBlocks = run.droppedBlocks
+	p.includeConflicts = run.includeConflicts
+	p.forEachSources = run.forEachSources
+	p.forEachInstances = run.forEachInstances
+
+	return err
+}
+
+// newRun returns a parser for a single Parse* call: it shares p's
+// configuration, and has its own results
+func (p *ThreatmodelParser) newRun() *ThreatmodelParser {
+	run := p.newSubParser()
+	run.fetches = nil
+	run.varOverrides = p.varOverrides
+	run.varEnv = p.varEnv
+	run.varFile = p.varFile
+	run.varFilename = p.varFilename
+	return run
+}
+
+func (p *ThreatmodelParser) result(err error) *ParseResult {
+	r := &ParseResult{
+		Warnings:         p.warnings,
+		DroppedBlocks:    p.droppedBlocks,
+		IncludeConflicts: p.includeConflicts,
+	}
+
+	if err == nil {
+		r.Wrapped = p.wrapped
+	}
+
+	return r
+}
@@ -0,0 +1,300 @@
+package spec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// resultSummary describes a parse in enough detail to tell parses apart
+func resultSummary(wrapped *ThreatmodelWrapped, warnings []Warning, dropped []DroppedBlock) string {
+	parts := []string{}
+	for _, tm := range wrapped.Threatmodels {
+		parts = append(parts, fmt.Sprintf("%s:%d/%d", tm.Name, len(tm.Threats), len(tm.InformationAssets)))
+	}
+
+	return fmt.Sprintf("%s warnings=%d dropped=%d", strings.Join(parts, ","), len(warnings), len(dropped))
+}
+
+func TestParseReuse(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	first, err := tmParser.Parse(context.Background(), "./testdata/tm1.hcl")
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	second, err := tmParser.Parse(context.Background(), "./testdata/tm-enabled.hcl")
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	legacy := NewThreatmodelParser(defaultCfg)
+	err = legacy.ParseFile("./testdata/tm1.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	exp := resultSummary(legacy.GetWrapped(), legacy.Warnings(), legacy.DroppedBlocks())
+	got := resultSummary(first.Wrapped, first.Warnings, first.DroppedBlocks)
+	if got != exp {
+		t.Errorf("Expected the first result to be '%s', got '%s'", exp, got)
+	}
+
+	if len(second.DroppedBlocks) == 0 {
+		t.Errorf("Expected the second result to have dropped blocks")
+	}
+
+	if first.Wrapped == second.Wrapped {
+		t.Errorf("Expected each parse to have its own wrapped model")
+	}
+
+	if len(tmParser.GetWrapped().Threatmodels) != 0 || len(tmParser.Warnings()) != 0 {
+		t.Errorf("Expected the parser's own results to be untouched, got %+v", tmParser.GetWrapped())
+	}
+}
+
+func TestParseDirectory(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	r, err := tmParser.Parse(context.Background(), "./testdata/split")
+	if err != nil {
+		t.Fatalf("Error parsing legit TM dir: %s", err)
+	}
+
+	if len(r.Wrapped.Threatmodels) == 0 {
+		t.Errorf("Expected the directory's threat models")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	r, err := tmParser.Parse(context.Background(), "./testdata/tm-invalid.hcl")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	if r == nil || r.Wrapped != nil {
+		t.Errorf("Expected a result without a wrapped model, got %+v", r)
+	}
+
+	r, err = tmParser.Parse(context.Background(), "./testdata/missing.hcl")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	if r == nil || r.Wrapped != nil {
+		t.Errorf("Expected a result without a wrapped model, got %+v", r)
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	hclInput, err := os.ReadFile("./testdata/tm1.hcl")
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	jsonInput, err := os.ReadFile("./testdata/tm1.json")
+	if err != nil {
+		t.Fatalf("Error reading file: %s", err)
+	}
+
+	hclResult, err := tmParser.ParseRaw(context.Background(), hclInput, RawParseOptions{Filename: "tm1.hcl", BaseDir: "./testdata"})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	jsonResult, err := tmParser.ParseRaw(context.Background(), jsonInput, RawParseOptions{Filename: "tm1.json", BaseDir: "./testdata"})
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	if len(hclResult.Wrapped.Threatmodels) == 0 || len(jsonResult.Wrapped.Threatmodels) == 0 {
+		t.Errorf("Expected threat models from both inputs, got %+v and %+v", hclResult.Wrapped, jsonResult.Wrapped)
+	}
+
+	_, err = tmParser.ParseRaw(context.Background(), jsonInput, RawParseOptions{Filename: "tm1.hcl"})
+	if err == nil {
+		t.Errorf("Expected an error parsing JSON as HCL")
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetVariables(map[string]string{"test_var": "overridden"})
+
+	r, err := tmParser.Parse(context.Background(), "./testdata/tm-withvar.hcl")
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	desc := r.Wrapped.Threatmodels[0].Threats[0].Description
+	if desc != "overridden" {
+		t.Errorf("Expected the variable to be overridden, got '%s'", desc)
+	}
+}
+
+func TestParseConcurrent(t *testing.T) {
+	paths := []string{
+		"./testdata/tm1.hcl",
+		"./testdata/tm1.json",
+		"./testdata/tm-enabled.hcl",
+		"./testdata/tm-foreach.hcl",
+		"./testdata/tm-withimport.hcl",
+		"./testdata/threat-dedup-including.hcl",
+		"./testdata/tm-constraint-proposed.hcl",
+		"./testdata/split",
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	expected := map[string]string{}
+	for _, path := range paths {
+		legacy := NewThreatmodelParser(defaultCfg)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Error reading '%s': %s", path, err)
+		}
+
+		if info.IsDir() {
+			err = legacy.ParseDir(path)
+		} else {
+			err = legacy.ParseFile(path, false)
+		}
+		if err != nil {
+			t.Fatalf("Error parsing legit TM file '%s': %s", path, err)
+		}
+
+		expected[path] = resultSummary(legacy.GetWrapped(), legacy.Warnings(), legacy.DroppedBlocks())
+	}
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetCacheDir(t.TempDir())
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(paths)*4)
+
+	for i := 0; i < 4; i++ {
+		for _, path := range paths {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+
+				r, err := tmParser.Parse(context.Background(), path)
+				if err != nil {
+					errs <- fmt.Errorf("error parsing '%s': %w", path, err)
+					return
+				}
+
+				got := resultSummary(r.Wrapped, r.Warnings, r.DroppedBlocks)
+				if got != expected[path] {
+					errs <- fmt.Errorf("expected '%s' to be '%s', got '%s'", path, expected[path], got)
+				}
+			}(path)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestParseFileConcurrent(t *testing.T) {
+	paths := []string{
+		"./testdata/tm1.hcl",
+		"./testdata/tm-enabled.hcl",
+		"./testdata/tm-foreach.hcl",
+		"./testdata/split",
+	}
+
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(paths)*4)
+
+	for i := 0; i < 4; i++ {
+		for _, path := range paths {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+
+				var err error
+				if strings.HasSuffix(path, ".hcl") {
+					err = tmParser.ParseFile(path, false)
+				} else {
+					err = tmParser.ParseDir(path)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("error parsing '%s': %w", path, err)
+					return
+				}
+
+				_ = resultSummary(tmParser.GetWrapped(), tmParser.Warnings(), tmParser.DroppedBlocks())
+				_ = tmParser.IncludeConflicts()
+				_ = tmParser.HclString()
+			}(path)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestParseFileReplacesResults(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFile("./testdata/tm-enabled.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	if len(tmParser.DroppedBlocks()) == 0 {
+		t.Fatalf("Expected dropped blocks")
+	}
+
+	err = tmParser.ParseFile("./testdata/tm1.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	legacy := NewThreatmodelParser(defaultCfg)
+	err = legacy.ParseFile("./testdata/tm1.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	exp := resultSummary(legacy.GetWrapped(), legacy.Warnings(), legacy.DroppedBlocks())
+	got := resultSummary(tmParser.GetWrapped(), tmParser.Warnings(), tmParser.DroppedBlocks())
+	if got != exp {
+		t.Errorf("Expected the second parse's results '%s', got '%s'", exp, got)
+	}
+}
@@ -0,0 +1,96 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// SetStrict sets whether values that aren't in the config's STRIDE,
+// ImpactTypes, InfoClassifications, InitiativeSizes or
+// UptimeDepClassifications are validation errors. Otherwise they're dropped,
+// or replaced with the default, with a warning. It defaults to the config's
+// Strict setting.
+func (p *ThreatmodelParser) SetStrict(strict bool) {
+	p.strict = strict
+}
+
+// checkNormalized compares the attr value in with its normalized form out,
+// where an empty out means in was dropped. In strict mode a value that wasn't
+// just normalized is an error for element (such as "threat 'sqli'") at the
+// attribute's valueRng naming the allowed values, otherwise a warning is
+// recorded for the element at rng.
+func (p *ThreatmodelParser) checkNormalized(tm *Threatmodel, element, path string, rng, valueRng hcl.Range, attr, in, out string, allowed []string) error {
+	replaced := out == "" || !strings.EqualFold(strings.TrimSpace(in), out)
+	if !p.strict || !replaced {
+		p.warnNormalized(tm, rng, attr, in, out)
+		return nil
+	}
+
+	msg := fmt.Sprintf("TM '%s': %s has an unknown %s '%s' (expected one of: %s)",
+		tm.Name, element, attr, in, strings.Join(allowed, ", "))
+	if suggestion := suggestValue(in, allowed); suggestion != "" {
+		msg = fmt.Sprintf("%s, did you mean '%s'?", msg, suggestion)
+	}
+
+	return tm.validationError(CodeInvalidEnumValue, path, valueRng, "%s", msg)
+}
+
+// suggestValue returns the allowed value closest to in, ignoring case, if
+// it's close enough to be a likely typo
+func suggestValue(in string, allowed []string) string {
+	in = strings.ToLower(strings.TrimSpace(in))
+
+	best := ""
+	bestDist := 0
+	for _, a := range allowed {
+		dist := editDistance(in, strings.ToLower(a))
+		if best == "" || dist < bestDist {
+			best = a
+			bestDist = dist
+		}
+	}
+
+	// Allow roughly one edit per three characters, and at least one
+	maxDist := len(in) / 3
+	if maxDist < 1 {
+		maxDist = 1
+	}
+	if best == "" || bestDist > maxDist {
+		return ""
+	}
+
+	return best
+}
+
+// editDistance is the optimal string alignment distance between a and b: the
+// Levenshtein distance, where swapping two adjacent characters is one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,169 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHCLRawStrict(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"stride_typo",
+			`threat "t" {
+    description = "words"
+    stride      = ["Spoofng"]
+  }`,
+			"threat 't' has an unknown stride 'Spoofng' (expected one of: Spoofing, Tampering, Repudiation, Info Disclosure, Denial Of Service, Elevation Of Privilege), did you mean 'Spoofing'?",
+		},
+		{
+			"impact_typo",
+			`threat "t" {
+    description = "words"
+    impacts     = ["integrty"]
+  }`,
+			"unknown impact 'integrty' (expected one of: Confidentiality, Integrity, Availability), did you mean 'Integrity'?",
+		},
+		{
+			"classification_without_suggestion",
+			`information_asset "a" {
+    information_classification = "Secret"
+  }`,
+			"information_asset 'a' has an unknown information_classification 'Secret' (expected one of: Restricted, Confidential, Public)",
+		},
+		{
+			"initiative_size",
+			`attributes {
+    new_initiative  = true
+    internet_facing = true
+    initiative_size = "Huge"
+  }`,
+			"attributes has an unknown initiative_size 'Huge'",
+		},
+		{
+			"uptime_dependency",
+			`third_party_dependency "d" {
+    description       = "words"
+    uptime_dependency = "hrad"
+  }`,
+			"did you mean 'hard'?",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			in := []byte(`threatmodel "tm" {
+  author = "@me"
+
+  ` + tc.in + `
+}
+`)
+
+			// Without strict mode the value is dropped or replaced
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw(in)
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			tmParser = NewThreatmodelParser(defaultCfg)
+			tmParser.SetStrict(true)
+			err = tmParser.ParseHCLRaw(in)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+
+			verrs := ValidationErrors(err)
+			if len(verrs) != 1 || verrs[0].Code != CodeInvalidEnumValue {
+				t.Errorf("Expected one invalid enum value error, got %v", verrs)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawStrictAllowsNormalized(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetStrict(true)
+
+	// Values that only differ in case are still normalized
+	err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  threat "t" {
+    description = "words"
+    stride      = ["spoofing", "denial of service"]
+    impacts     = ["INTEGRITY"]
+  }
+}
+`))
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	stride := tmParser.GetWrapped().Threatmodels[0].Threats[0].Stride
+	if strings.Join(stride, ",") != "Spoofing,Denial Of Service" {
+		t.Errorf("Incorrect stride: %v", stride)
+	}
+}
+
+func TestParseHCLRawStrictFromConfig(t *testing.T) {
+	cfg, err := LoadSpecConfig()
+	if err != nil {
+		t.Fatalf("Error loading default spec cfg; %s", err)
+	}
+
+	err = cfg.LoadSpecConfigFile("./testdata/strict-config.hcl")
+	if err != nil {
+		t.Fatalf("Error loading valid cfg file: %s", err)
+	}
+
+	if !cfg.Strict {
+		t.Fatalf("Cfg file wasn't loaded correctly - Strict isn't set")
+	}
+
+	tmParser := NewThreatmodelParser(cfg)
+	err = tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  information_asset "a" {
+    information_classification = "Secret"
+  }
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "unknown information_classification 'Secret'") {
+		t.Errorf("Expected an unknown information_classification error, got '%v'", err)
+	}
+}
+
+func TestSuggestValue(t *testing.T) {
+	allowed := []string{"Spoofing", "Tampering", "Info Disclosure"}
+
+	cases := map[string]string{
+		"spofing":        "Spoofing",
+		"Tamperng":       "Tampering",
+		"info disclosur": "Info Disclosure",
+		"x":              "",
+		"Repudiation":    "",
+	}
+
+	for in, exp := range cases {
+		if got := suggestValue(in, allowed); got != exp {
+			t.Errorf("suggestValue('%s') = '%s', expected '%s'", in, got, exp)
+		}
+	}
+}
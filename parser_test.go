@@ -36,9 +36,13 @@ func TestNewTMParser(t *testing.T) {
 		tmParser.validateSpec("blop")
 	})
 
-	if !strings.Contains(out, "No provided version.") {
-		t.Error("Missing stdout from a blank spec version")
-		t.Log(out)
+	if out != "" {
+		t.Errorf("Expected nothing on stdout, got '%s'", out)
+	}
+
+	warnings := tmParser.Warnings()
+	if len(warnings) != 2 || !strings.Contains(warnings[1].Message, "blop: No provided version.") {
+		t.Errorf("Missing warning from a blank spec version: %v", warnings)
 	}
 
 	tmw := &ThreatmodelWrapped{
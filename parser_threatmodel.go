@@ -1,251 +1,328 @@
 package spec
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
 	gg "github.com/hashicorp/go-getter"
 	"github.com/hashicorp/go-multierror"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/gocty"
 )
 
+// DefaultMaxIncludeDepth is how many levels of `including` a parser follows
+// before giving up, unless changed with SetMaxIncludeDepth.
+const DefaultMaxIncludeDepth = 10
+
+// SetMaxIncludeDepth sets how many levels of `including` are followed, as a
+// backstop against include chains that can't be detected as cycles (such as
+// remote files including each other through relative paths).
+func (p *ThreatmodelParser) SetMaxIncludeDepth(depth int) {
+	p.maxIncludeDepth = depth
+}
+
 func (tm *Threatmodel) Include(cfg *ThreatmodelSpecConfig, myfilename string) error {
-	if tm.Including == "" {
+	p := NewThreatmodelParser(cfg)
+
+	ctx, end := p.beginFetch(context.Background())
+	defer end()
+
+	return tm.include(ctx, p, myfilename)
+}
+
+// include merges the including source into tm, fetching it with p's settings
+// (such as its cache directory and offline mode)
+func (tm *Threatmodel) include(ctx context.Context, p *ThreatmodelParser, myfilename string) error {
+	return tm.includeFrom(ctx, p, myfilename, nil)
+}
+
+// includeFrom merges each including source into tm, in order, after first
+// following the included model's own `including`. chain holds the normalized
+// sources of the files currently being included, outermost first, to detect
+// cycles.
+//
+// Sources are merged one at a time using p's IncludeMergeStrategy, so with the
+// default keep_parent strategy tm's own content takes precedence, followed by
+// each source in the order listed. Merged threats, information assets and DFDs
+// are marked with the source they were originally defined in (see
+// IncludedFrom).
+func (tm *Threatmodel) includeFrom(ctx context.Context, p *ThreatmodelParser, myfilename string, chain []string) error {
+	sources := tm.includingSources()
+	if len(sources) == 0 {
 		return fmt.Errorf("empty including")
 	}
 
-	subParser, err := fetchRemoteTm(cfg, tm.Including, myfilename)
+	absFilename, err := filepath.Abs(myfilename)
 	if err != nil {
 		return err
 	}
 
-	if len(subParser.wrapped.Threatmodels) != 1 {
-		return fmt.Errorf("the included threat model file includes an incorrect number of threat models. Expected 1 but got %d", len(subParser.wrapped.Threatmodels))
+	if len(chain) == 0 {
+		self, err := normalizeSource(absFilename, "")
+		if err != nil {
+			return err
+		}
+		chain = []string{self}
 	}
 
-	subTm := &subParser.wrapped.Threatmodels[0]
+	p.prefetch(sources, filepath.Dir(absFilename))
 
-	if tm.Description == "" {
-		tm.Description = subTm.Description
+	for _, source := range sources {
+		err = tm.includeSource(ctx, p, source, absFilename, chain)
+		if err != nil {
+			return err
+		}
 	}
 
-	if tm.Link == "" {
-		tm.Link = subTm.Link
-	}
+	return nil
+}
 
-	if tm.DiagramLink == "" {
-		tm.DiagramLink = subTm.DiagramLink
+// includeSource fetches a single including source and merges it into tm
+func (tm *Threatmodel) includeSource(ctx context.Context, p *ThreatmodelParser, source, myfilename string, chain []string) error {
+	if source == "" {
+		return fmt.Errorf("empty including")
 	}
 
-	if len(tm.Repository) == 0 {
-		tm.Repository = subTm.Repository
+	normalized, err := normalizeSource(source, filepath.Dir(myfilename))
+	if err != nil {
+		return err
 	}
 
-	if tm.Attributes == nil {
-		tm.Attributes = subTm.Attributes
+	for _, c := range chain {
+		if c == normalized {
+			return fmt.Errorf("include cycle detected: %s -> %s", strings.Join(chain, " -> "), normalized)
+		}
 	}
 
-	for _, ia := range subTm.InformationAssets {
-		tm.addInfoIfNotExist(*ia)
+	if len(chain) > p.maxIncludeDepth {
+		return fmt.Errorf("including '%s' exceeds the maximum include depth of %d", source, p.maxIncludeDepth)
 	}
 
-	for _, uc := range subTm.UseCases {
-		tm.addUcIfNotExist(*uc)
+	subParser, includePath, err := p.fetchRemoteTm(ctx, source, myfilename)
+	if err != nil {
+		return err
 	}
 
-	for _, ex := range subTm.Exclusions {
-		tm.addExclIfNotExist(*ex)
+	if len(subParser.wrapped.Threatmodels) != 1 {
+		return fmt.Errorf("the included threat model file includes an incorrect number of threat models. Expected 1 but got %d", len(subParser.wrapped.Threatmodels))
 	}
 
-	for _, tpd := range subTm.ThirdPartyDependencies {
-		tm.addTpdIfNotExist(*tpd)
-	}
+	subTm := &subParser.wrapped.Threatmodels[0]
 
-	for _, dfd := range subTm.DataFlowDiagrams {
-		tm.addDfdIfNotExist(*dfd)
-	}
+	if len(subTm.includingSources()) > 0 {
+		// Relative sources in a local file are relative to where it lives, not
+		// to the copy fetched into the temp or cache directory
+		if isLocalSource(normalized) {
+			includePath = localSourcePath(normalized)
+		}
 
-	for _, mermaid := range subTm.MermaidDiagrams {
-		tm.addMermaidIfNotExist(*mermaid)
-	}
+		subChain := append(append([]string{}, chain...), normalized)
+		err = subTm.includeFrom(ctx, subParser, includePath, subChain)
+		if err != nil {
+			return fmt.Errorf("error including '%s': %w", source, err)
+		}
 
-	for _, t := range subTm.Threats {
-		tm.addTIfNotExist(*t)
+		p.includeConflicts = append(p.includeConflicts, subParser.includeConflicts...)
 	}
 
+	p.droppedBlocks = append(p.droppedBlocks, subParser.droppedBlocks...)
+	p.warnings = append(p.warnings, subParser.warnings...)
+
+	subTm.markIncludedFrom(source)
+
+	p.mergeIncluded(tm, subTm, source)
+
 	return nil
 }
 
-func (tm *Threatmodel) addInfoIfNotExist(newIa InformationAsset) {
-
-	assetFound := false
+// markIncludedFrom records source as the origin of each threat, information
+// asset and DFD in tm that doesn't already have one from a deeper include
+func (tm *Threatmodel) markIncludedFrom(source string) {
 	for _, ia := range tm.InformationAssets {
-		if ia.Name == newIa.Name {
-			assetFound = true
+		if ia.IncludedFrom == "" {
+			ia.IncludedFrom = source
 		}
 	}
 
-	if !assetFound {
-		tm.InformationAssets = append(tm.InformationAssets, &newIa)
+	for _, t := range tm.Threats {
+		if t.IncludedFrom == "" {
+			t.IncludedFrom = source
+		}
 	}
 
+	for _, dfd := range tm.DataFlowDiagrams {
+		if dfd.IncludedFrom == "" {
+			dfd.IncludedFrom = source
+		}
+	}
 }
 
-func (tm *Threatmodel) addTpdIfNotExist(newTpd ThirdPartyDependency) {
+// The add*IfNotExist helpers append the new element unless tm already has one
+// with the same name (or description, for use cases and exclusions), in which
+// case that existing element is returned so the caller can resolve the
+// conflict.
 
-	tpdFound := false
-	for _, tpd := range tm.ThirdPartyDependencies {
-		if tpd.Name == newTpd.Name {
-			tpdFound = true
+func (tm *Threatmodel) addInfoIfNotExist(newIa InformationAsset) *InformationAsset {
+	for _, ia := range tm.InformationAssets {
+		if ia.Name == newIa.Name {
+			return ia
 		}
 	}
 
-	if !tpdFound {
-		tm.ThirdPartyDependencies = append(tm.ThirdPartyDependencies, &newTpd)
+	tm.InformationAssets = append(tm.InformationAssets, &newIa)
+	return nil
+}
+
+func (tm *Threatmodel) addTpdIfNotExist(newTpd ThirdPartyDependency) *ThirdPartyDependency {
+	for _, tpd := range tm.ThirdPartyDependencies {
+		if tpd.Name == newTpd.Name {
+			return tpd
+		}
 	}
 
+	tm.ThirdPartyDependencies = append(tm.ThirdPartyDependencies, &newTpd)
+	return nil
 }
 
-func (tm *Threatmodel) addUcIfNotExist(newUc UseCase) {
-
-	ucFound := false
+func (tm *Threatmodel) addUcIfNotExist(newUc UseCase) *UseCase {
 	for _, uc := range tm.UseCases {
 		if newUc.Description == uc.Description {
-			ucFound = true
+			return uc
 		}
 	}
 
-	if !ucFound {
-		tm.UseCases = append(tm.UseCases, &newUc)
-	}
+	tm.UseCases = append(tm.UseCases, &newUc)
+	return nil
 }
 
-func (tm *Threatmodel) addExclIfNotExist(newExcl Exclusion) {
-
-	exFound := false
+func (tm *Threatmodel) addExclIfNotExist(newExcl Exclusion) *Exclusion {
 	for _, ex := range tm.Exclusions {
 		if newExcl.Description == ex.Description {
-			exFound = true
+			return ex
 		}
 	}
 
-	if !exFound {
-		tm.Exclusions = append(tm.Exclusions, &newExcl)
-	}
+	tm.Exclusions = append(tm.Exclusions, &newExcl)
+	return nil
 }
 
-func (tm *Threatmodel) addTIfNotExist(newT Threat) {
-
-	tFound := false
+func (tm *Threatmodel) addTIfNotExist(newT Threat) *Threat {
 	for _, t := range tm.Threats {
 		if newT.Name == t.Name {
-			tFound = true
+			return t
 		}
 	}
 
-	if !tFound {
-		tm.Threats = append(tm.Threats, &newT)
-	}
+	tm.Threats = append(tm.Threats, &newT)
+	return nil
 }
 
-func (tm *Threatmodel) addDfdIfNotExist(newDfd DataFlowDiagram) {
-
-	dfdFound := false
+func (tm *Threatmodel) addDfdIfNotExist(newDfd DataFlowDiagram) *DataFlowDiagram {
 	for _, dfd := range tm.DataFlowDiagrams {
 		if newDfd.Name == dfd.Name {
-			dfdFound = true
+			return dfd
 		}
 	}
 
-	if !dfdFound {
-		tm.DataFlowDiagrams = append(tm.DataFlowDiagrams, &newDfd)
-	}
+	tm.DataFlowDiagrams = append(tm.DataFlowDiagrams, &newDfd)
+	return nil
 }
 
-func (tm *Threatmodel) addMermaidIfNotExist(newMermaid MermaidDiagram) {
-
-	mermaidFound := false
+func (tm *Threatmodel) addMermaidIfNotExist(newMermaid MermaidDiagram) *MermaidDiagram {
 	for _, mermaid := range tm.MermaidDiagrams {
 		if newMermaid.Name == mermaid.Name {
-			mermaidFound = true
+			return mermaid
 		}
 	}
 
-	if !mermaidFound {
-		tm.MermaidDiagrams = append(tm.MermaidDiagrams, &newMermaid)
-	}
+	tm.MermaidDiagrams = append(tm.MermaidDiagrams, &newMermaid)
+	return nil
 }
 
-func fetchRemoteTm(cfg *ThreatmodelSpecConfig, source, currentFilename string) (*ThreatmodelParser, error) {
-	returnParser := NewThreatmodelParser(cfg)
-
-	tmpDir, err := os.MkdirTemp("", "hcltm")
+// fetchRemoteTm fetches and parses source with p's SourceResolver, returning
+// the parser along with the path the source was fetched to
+func (p *ThreatmodelParser) fetchRemoteTm(ctx context.Context, source, currentFilename string) (*ThreatmodelParser, string, error) {
+	baseDir, err := modelBaseDir(currentFilename)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// @TODO The below refers to a non-existent folder
-	// to cater for https://github.com/hashicorp/go-getter/issues/114
-	tmpDir = fmt.Sprintf("%s/nest", tmpDir)
-
-	absPath, err := filepath.Abs(currentFilename)
+	resolved, err := p.fetch(ctx, source, baseDir)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	absPath = filepath.Dir(absPath)
+	lockSource, err := p.checkLock(source, currentFilename, resolved)
+	if err != nil {
+		return nil, "", err
+	}
 
-	// @TODO The below is a hack to remote URLs
-	// We allow an explicit "file" to be referenced after
-	// a whole directory (i.e. git repo) is cloned
-	// see: https://github.com/hashicorp/go-getter/issues/98
+	returnParser := p.newSubParser()
+	returnParser.lockSource = lockSource
 
-	// for example, the below allows a remote URL to look like
-	// github.com/xntrik/hcltm|examples/aws-security-checklist.hcl
-	// OR, something more complex, like a private repo
-	// git::ssh://git@github.com/xntrik/test|aws-security-checklist.hcl
-	splitSource := strings.SplitN(source, "|", 2)
+	var importDiag error
+	switch {
+	case resolved.Content == nil:
+		importDiag = returnParser.parseHCLFile(ctx, resolved.Path, false)
+	case filepath.Ext(resolved.Path) == ".json":
+		importDiag = returnParser.parseJSONBytes(ctx, resolved.Content, resolved.Path)
+	default:
+		importDiag = returnParser.parseHCLBytes(ctx, resolved.Content, resolved.Path)
+	}
 
-	client := gg.Client{
-		Src:  splitSource[0],
-		Dst:  tmpDir,
-		Pwd:  absPath,
-		Mode: gg.ClientModeAny,
+	if importDiag != nil {
+		return nil, "", importDiag
 	}
 
-	err = client.Get()
+	return returnParser, resolved.Path, nil
+}
+
+// getSource downloads src (resolved against pwd) into dst, which must not
+// already exist. Local files are symlinked into dst unless copyLocal is set.
+func getSource(ctx context.Context, src, dst, pwd string, copyLocal bool) error {
+	normalized, err := normalizeSource(src, pwd)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// err = filepath.Walk(tmpDir,
-	// 	func(path string, info os.FileInfo, err error) error {
-	// 		if err != nil {
-	// 			return err
-	// 		}
-	// 		fmt.Println(path, info.Size())
-	// 		return nil
-	// 	})
-	// if err != nil {
-	// 	fmt.Println("Error: ", err)
-	// }
+	client := gg.Client{
+		Ctx:     ctx,
+		Src:     src,
+		Dst:     dst,
+		Pwd:     pwd,
+		Mode:    gg.ClientModeAny,
+		Getters: newGetters(isLocalSource(normalized), copyLocal),
+	}
+
+	return client.Get()
+}
 
-	includePath := ""
+// newGetters returns the same getters as go-getter's defaults, but as new
+// instances: a getter keeps a reference to the client using it, so the shared
+// defaults can't be used by concurrent fetches. The file getter is only
+// included for local sources, so nothing remote can lead to a local file.
+func newGetters(local, copyLocal bool) map[string]gg.Getter {
+	// X-Terraform-Get would let a server send the fetch on to any source,
+	// past the checks made on the one written in the threat model
+	httpGetter := &gg.HttpGetter{Netrc: true, XTerraformGetDisabled: true}
 
-	switch len(splitSource) {
-	case 1:
-		includePath = fmt.Sprintf("%s/%s", tmpDir, filepath.Base(source))
-	case 2:
-		includePath = fmt.Sprintf("%s/%s", tmpDir, splitSource[1])
+	getters := map[string]gg.Getter{
+		"git":   new(gg.GitGetter),
+		"gcs":   new(gg.GCSGetter),
+		"hg":    new(gg.HgGetter),
+		"s3":    new(gg.S3Getter),
+		"http":  httpGetter,
+		"https": httpGetter,
 	}
-	importDiag := returnParser.ParseHCLFile(includePath, false)
 
-	if importDiag != nil {
-		return nil, importDiag
+	if local {
+		getters["file"] = &gg.FileGetter{Copy: copyLocal}
 	}
 
-	return returnParser, nil
+	return getters
 }
 
 // Validate that the supplied informatin_asset name is found in the tm
@@ -275,6 +352,50 @@ func (tm *Threatmodel) validateInformationAssetRef(asset string) error {
 	return nil
 }
 
+// shiftIncluding sets Including or IncludingSources from the decoded
+// `including` attribute, which may be a single source or a list of them
+func (tm *Threatmodel) shiftIncluding() error {
+	if tm.IncludingRaw.IsNull() {
+		return nil
+	}
+
+	raw := tm.IncludingRaw
+	tm.IncludingRaw = cty.NilVal
+
+	if raw.Type() == cty.String {
+		tm.Including = raw.AsString()
+		return nil
+	}
+
+	listVal, err := convert.Convert(raw, cty.List(cty.String))
+	if err != nil || !listVal.IsWhollyKnown() {
+		return fmt.Errorf("including must be a string or a list of strings")
+	}
+
+	sources := []string{}
+	err = gocty.FromCtyValue(listVal, &sources)
+	if err != nil {
+		return fmt.Errorf("including must be a string or a list of strings")
+	}
+
+	tm.IncludingSources = sources
+	return nil
+}
+
+// includingSources returns the sources merged into tm, from IncludingSources
+// or else Including
+func (tm *Threatmodel) includingSources() []string {
+	if len(tm.IncludingSources) > 0 {
+		return tm.IncludingSources
+	}
+
+	if tm.Including != "" {
+		return []string{tm.Including}
+	}
+
+	return nil
+}
+
 func (tm *Threatmodel) shiftLegacyDfd() (int, error) {
 	if tm.LegacyDfd != nil {
 		newDfd := &DataFlowDiagram{
@@ -286,6 +407,7 @@ func (tm *Threatmodel) shiftLegacyDfd() (int, error) {
 			Flows:             tm.LegacyDfd.Flows,
 			TrustZones:        tm.LegacyDfd.TrustZones,
 			ImportFile:        tm.LegacyDfd.ImportFile,
+			DefRange:          tm.LegacyDfd.DefRange,
 		}
 		tm.LegacyDfd = nil
 		tm.DataFlowDiagrams = append(tm.DataFlowDiagrams, newDfd)
@@ -303,7 +425,13 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 
 		// Normalize threatmodel attributes initiative_size
 		if tm.Attributes.InitiativeSize != "" {
-			tm.Attributes.InitiativeSize = p.normalizeInitiativeSize(tm.Attributes.InitiativeSize)
+			normalized := p.normalizeInitiativeSize(tm.Attributes.InitiativeSize)
+			err := p.checkNormalized(tm, "attributes", blockPath("", "attributes", nil), tm.DefRange, tm.DefRange,
+				"initiative_size", tm.Attributes.InitiativeSize, normalized, p.specCfg.InitiativeSizes)
+			if err != nil {
+				errMap = multierror.Append(errMap, err)
+			}
+			tm.Attributes.InitiativeSize = normalized
 		}
 	}
 
@@ -313,7 +441,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 		infoAssets := make(map[string]interface{})
 		for _, ia := range tm.InformationAssets {
 			if _, ok := infoAssets[ia.Name]; ok {
-				errMap = multierror.Append(errMap, fmt.Errorf(
+				errMap = multierror.Append(errMap, tm.validationError(
+					CodeDuplicateInformationAsset,
+					blockPath("", "information_asset", []string{ia.Name}),
+					ia.DefRange,
 					"TM '%s': duplicate information_asset '%s'",
 					tm.Name,
 					ia.Name,
@@ -322,7 +453,14 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 
 			// Normalize InformationClassification
 			if ia.InformationClassification != "" {
-				ia.InformationClassification = p.normalizeInfoClassification(ia.InformationClassification)
+				normalized := p.normalizeInfoClassification(ia.InformationClassification)
+				err := p.checkNormalized(tm, fmt.Sprintf("information_asset '%s'", ia.Name), blockPath("", "information_asset", []string{ia.Name}),
+					ia.DefRange, attrRange(ia.Body, "information_classification", ia.DefRange),
+					"information_classification", ia.InformationClassification, normalized, p.specCfg.InfoClassifications)
+				if err != nil {
+					errMap = multierror.Append(errMap, err)
+				}
+				ia.InformationClassification = normalized
 			}
 
 			infoAssets[ia.Name] = nil
@@ -332,19 +470,36 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 	// Validating any DFD data within a threat model
 	// if tm.DataFlowDiagram != nil {
 	for _, adfd := range tm.DataFlowDiagrams {
+		dfd := dfdPath(adfd)
 
 		// Checking for unique TrustZones
 		zones := make(map[string]interface{})
 		if adfd.TrustZones != nil {
 			for _, zone := range adfd.TrustZones {
 				if _, ok := zones[zone.Name]; ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeDuplicateTrustZone,
+						blockPath(dfd, "trust_zone", []string{zone.Name}),
+						zone.DefRange,
 						"TM '%s': duplicate trust_zone block found '%s'",
 						tm.Name,
 						zone.Name,
 					))
 				}
 
+				// OTM trust ratings run from 0 to 100
+				if zone.TrustRating != nil && (*zone.TrustRating < 0 || *zone.TrustRating > 100) {
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidTrustRating,
+						blockPath(dfd, "trust_zone", []string{zone.Name}),
+						attrRange(zone.Body, "trust_rating", zone.DefRange),
+						"TM '%s': trust_zone '%s' has a trust_rating of %d, which isn't between 0 and 100",
+						tm.Name,
+						zone.Name,
+						*zone.TrustRating,
+					))
+				}
+
 				zones[zone.Name] = nil
 			}
 		}
@@ -354,7 +509,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 		if adfd.Processes != nil {
 			for _, process := range adfd.Processes {
 				if _, ok := elements[process.Name]; ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeDuplicateProcess,
+						blockPath(dfd, "process", []string{process.Name}),
+						process.DefRange,
 						"TM '%s': duplicate process found in dfd '%s'",
 						tm.Name,
 						process.Name,
@@ -371,7 +529,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.Processes != nil {
 					for _, process := range zone.Processes {
 						if _, ok := elements[process.Name]; ok {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeDuplicateProcess,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "process", []string{process.Name}),
+								process.DefRange,
 								"TM '%s': duplicate process found in dfd '%s'",
 								tm.Name,
 								process.Name,
@@ -387,7 +548,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 		if adfd.ExternalElements != nil {
 			for _, external_element := range adfd.ExternalElements {
 				if _, ok := elements[external_element.Name]; ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeDuplicateExternalElement,
+						blockPath(dfd, "external_element", []string{external_element.Name}),
+						external_element.DefRange,
 						"TM '%s': duplicate external_element found in dfd '%s'",
 						tm.Name,
 						external_element.Name,
@@ -404,7 +568,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.ExternalElements != nil {
 					for _, external_element := range zone.ExternalElements {
 						if _, ok := elements[external_element.Name]; ok {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeDuplicateExternalElement,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "external_element", []string{external_element.Name}),
+								external_element.DefRange,
 								"TM '%s': duplicate external_element found in dfd '%s'",
 								tm.Name,
 								external_element.Name,
@@ -421,7 +588,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 		if adfd.DataStores != nil {
 			for _, data_store := range adfd.DataStores {
 				if _, ok := elements[data_store.Name]; ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeDuplicateDataStore,
+						blockPath(dfd, "data_store", []string{data_store.Name}),
+						data_store.DefRange,
 						"TM '%s': duplicate data_store found in dfd '%s'",
 						tm.Name,
 						data_store.Name,
@@ -435,7 +605,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if data_store.IaLink != "" {
 					err := tm.validateInformationAssetRef(data_store.IaLink)
 					if err != nil {
-						errMap = multierror.Append(errMap, fmt.Errorf(
+						errMap = multierror.Append(errMap, tm.validationError(
+							CodeInvalidInformationAssetRef,
+							blockPath(dfd, "data_store", []string{data_store.Name}),
+							attrRange(data_store.Body, "information_asset", data_store.DefRange),
 							"TM '%s' DFD Data Store '%s' %s",
 							tm.Name,
 							data_store.Name,
@@ -452,7 +625,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.DataStores != nil {
 					for _, data_store := range zone.DataStores {
 						if _, ok := elements[data_store.Name]; ok {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeDuplicateDataStore,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "data_store", []string{data_store.Name}),
+								data_store.DefRange,
 								"TM '%s': duplicate data_store found in dfd '%s'",
 								tm.Name,
 								data_store.Name,
@@ -466,7 +642,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 						if data_store.IaLink != "" {
 							err := tm.validateInformationAssetRef(data_store.IaLink)
 							if err != nil {
-								errMap = multierror.Append(errMap, fmt.Errorf(
+								errMap = multierror.Append(errMap, tm.validationError(
+									CodeInvalidInformationAssetRef,
+									blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "data_store", []string{data_store.Name}),
+									attrRange(data_store.Body, "information_asset", data_store.DefRange),
 									"TM '%s' DFD Data Store '%s' %s",
 									tm.Name,
 									data_store.Name,
@@ -485,7 +664,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.Processes != nil {
 					for _, process := range zone.Processes {
 						if process.TrustZone != "" && process.TrustZone != zone.Name {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeTrustZoneMismatch,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "process", []string{process.Name}),
+								attrRange(process.Body, "trust_zone", process.DefRange),
 								"TM '%s': process trust_zone mis-match found in '%s'",
 								tm.Name,
 								process.Name,
@@ -497,7 +679,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.ExternalElements != nil {
 					for _, external_element := range zone.ExternalElements {
 						if external_element.TrustZone != "" && external_element.TrustZone != zone.Name {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeTrustZoneMismatch,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "external_element", []string{external_element.Name}),
+								attrRange(external_element.Body, "trust_zone", external_element.DefRange),
 								"TM '%s': external_element trust_zone mis-match found in '%s'",
 								tm.Name,
 								external_element.Name,
@@ -509,7 +694,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if zone.DataStores != nil {
 					for _, data_store := range zone.DataStores {
 						if data_store.TrustZone != "" && data_store.TrustZone != zone.Name {
-							errMap = multierror.Append(errMap, fmt.Errorf(
+							errMap = multierror.Append(errMap, tm.validationError(
+								CodeTrustZoneMismatch,
+								blockPath(blockPath(dfd, "trust_zone", []string{zone.Name}), "data_store", []string{data_store.Name}),
+								attrRange(data_store.Body, "trust_zone", data_store.DefRange),
 								"TM '%s': data_store trust_zone mis-match found in '%s'",
 								tm.Name,
 								data_store.Name,
@@ -529,10 +717,14 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 			for _, rawflow := range adfd.Flows {
 				flow := fmt.Sprintf("%s:%s", rawflow.From, rawflow.To)
 				flowKey := fmt.Sprintf("%s:%s:%s", rawflow.From, rawflow.To, rawflow.Name)
+				flowPath := blockPath(dfd, "flow", []string{rawflow.Name})
 
 				// check for unique flows (same from, to, AND name)
 				if _, ok := flows[flowKey]; ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeDuplicateFlow,
+						flowPath,
+						rawflow.DefRange,
 						"TM '%s': duplicate flow found in dfd '%s' with name '%s'",
 						tm.Name,
 						flow,
@@ -542,7 +734,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 
 				// now check that flows connect to legit processes
 				if _, ok := elements[rawflow.From]; !ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidFlowFrom,
+						flowPath,
+						attrRange(rawflow.Body, "from", rawflow.DefRange),
 						"TM '%s': invalid from connection for flow '%s'",
 						tm.Name,
 						flow,
@@ -550,7 +745,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				}
 
 				if _, ok := elements[rawflow.To]; !ok {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidFlowTo,
+						flowPath,
+						attrRange(rawflow.Body, "to", rawflow.DefRange),
 						"TM '%s': invalid to connection for flow '%s'",
 						tm.Name,
 						flow,
@@ -559,7 +757,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 
 				// now check that the flow doesn't connect to itself
 				if rawflow.From == rawflow.To {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeFlowToItself,
+						flowPath,
+						rawflow.DefRange,
 						"TM '%s': flow can't connect to itself '%s'",
 						tm.Name,
 						flow,
@@ -575,15 +776,31 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 	// Normalize threat impacts and stride
 	if tm.Threats != nil {
 		for _, tr := range tm.Threats {
+			threatPath := blockPath("", "threat", []string{tr.Name})
+
 			normalized := []string{}
 			for _, impact := range tr.ImpactType {
-				normalized = append(normalized, p.normalizeImpactType(impact))
+				norm := p.normalizeImpactType(impact)
+				err := p.checkNormalized(tm, fmt.Sprintf("threat '%s'", tr.Name), threatPath,
+					tr.DefRange, attrRange(tr.Body, "impacts", tr.DefRange),
+					"impact", impact, norm, p.specCfg.ImpactTypes)
+				if err != nil {
+					errMap = multierror.Append(errMap, err)
+				}
+				normalized = append(normalized, norm)
 			}
 			tr.ImpactType = normalized
 
 			normalizedStride := []string{}
 			for _, stride := range tr.Stride {
-				normalizedStride = append(normalizedStride, p.normalizeStride(stride))
+				norm := p.normalizeStride(stride)
+				err := p.checkNormalized(tm, fmt.Sprintf("threat '%s'", tr.Name), threatPath,
+					tr.DefRange, attrRange(tr.Body, "stride", tr.DefRange),
+					"stride", stride, norm, p.specCfg.STRIDE)
+				if err != nil {
+					errMap = multierror.Append(errMap, err)
+				}
+				normalizedStride = append(normalizedStride, norm)
 			}
 			tr.Stride = normalizedStride
 
@@ -591,9 +808,12 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 			for _, iaRef := range tr.InformationAssetRefs {
 				err := tm.validateInformationAssetRef(iaRef)
 				if err != nil {
-					errMap = multierror.Append(errMap,
-						fmt.Errorf("TM '%s' / Threat '%s': %s", tm.Name, tr.Description, err),
-					)
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidInformationAssetRef,
+						threatPath,
+						attrRange(tr.Body, "information_asset_refs", tr.DefRange),
+						"TM '%s' / Threat '%s': %s", tm.Name, tr.Description, err,
+					))
 				}
 			}
 
@@ -605,7 +825,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if norm := p.normalizeRiskLevel(tr.Risk.Likelihood); norm != "" {
 					tr.Risk.Likelihood = norm
 				} else {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidRiskLikelihood,
+						blockPath(threatPath, "risk", nil),
+						attrRange(tr.Risk.Body, "likelihood", tr.Risk.DefRange),
 						"TM '%s' / Threat '%s': invalid risk likelihood '%s' (expected one of: %s)",
 						tm.Name, tr.Description, tr.Risk.Likelihood, strings.Join(RiskLevels, ", "),
 					))
@@ -614,7 +837,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 				if norm := p.normalizeRiskLevel(tr.Risk.Impact); norm != "" {
 					tr.Risk.Impact = norm
 				} else {
-					errMap = multierror.Append(errMap, fmt.Errorf(
+					errMap = multierror.Append(errMap, tm.validationError(
+						CodeInvalidRiskImpact,
+						blockPath(threatPath, "risk", nil),
+						attrRange(tr.Risk.Body, "impact", tr.Risk.DefRange),
 						"TM '%s' / Threat '%s': invalid risk impact '%s' (expected one of: %s)",
 						tm.Name, tr.Description, tr.Risk.Impact, strings.Join(RiskLevels, ", "),
 					))
@@ -624,7 +850,10 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 					if norm := p.normalizeSeverity(tr.Risk.SeverityOverride); norm != "" {
 						tr.Risk.SeverityOverride = norm
 					} else {
-						errMap = multierror.Append(errMap, fmt.Errorf(
+						errMap = multierror.Append(errMap, tm.validationError(
+							CodeInvalidRiskSeverity,
+							blockPath(threatPath, "risk", nil),
+							attrRange(tr.Risk.Body, "severity", tr.Risk.DefRange),
 							"TM '%s' / Threat '%s': invalid risk severity '%s' (expected one of: %s)",
 							tm.Name, tr.Description, tr.Risk.SeverityOverride, strings.Join(SeverityLevels, ", "),
 						))
@@ -637,7 +866,14 @@ func (tm *Threatmodel) ValidateTm(p *ThreatmodelParser) error {
 	// Normalize third party deps - uptime dep classification
 	if tm.ThirdPartyDependencies != nil {
 		for _, tpd := range tm.ThirdPartyDependencies {
-			tpd.UptimeDependency = p.normalizeUptimeDepClassification(string(tpd.UptimeDependency))
+			normalized := p.normalizeUptimeDepClassification(string(tpd.UptimeDependency))
+			err := p.checkNormalized(tm, fmt.Sprintf("third_party_dependency '%s'", tpd.Name), blockPath("", "third_party_dependency", []string{tpd.Name}),
+				tpd.DefRange, attrRange(tpd.Body, "uptime_dependency", tpd.DefRange),
+				"uptime_dependency", string(tpd.UptimeDependency), string(normalized), p.specCfg.UptimeDepClassifications)
+			if err != nil {
+				errMap = multierror.Append(errMap, err)
+			}
+			tpd.UptimeDependency = normalized
 		}
 	}
 
@@ -132,3 +132,291 @@ func TestParseHCLFileWithIncludingTooMany(t *testing.T) {
 		t.Errorf("We should have an error about too many models")
 	}
 }
+
+func TestParseHCLFileWithIncludingChain(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFile("./testdata/including/chain/app.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if tm.Description != "The corporate baseline" {
+		t.Errorf("Expected the description from two levels up, got '%s'", tm.Description)
+	}
+
+	expThreats := map[string]string{
+		"app_threat":      "",
+		"middle_threat":   "middle.hcl",
+		"baseline_threat": "baseline/corp-baseline.hcl",
+	}
+
+	if len(tm.Threats) != len(expThreats) {
+		t.Fatalf("Expected %d threats, got %d", len(expThreats), len(tm.Threats))
+	}
+
+	for _, threat := range tm.Threats {
+		exp, ok := expThreats[threat.Name]
+		if !ok {
+			t.Errorf("Unexpected threat '%s'", threat.Name)
+			continue
+		}
+		if threat.IncludedFrom != exp {
+			t.Errorf("Expected threat '%s' to be included from '%s', got '%s'", threat.Name, exp, threat.IncludedFrom)
+		}
+	}
+
+	for _, ia := range tm.InformationAssets {
+		if ia.Name == "employee data" && ia.IncludedFrom != "baseline/corp-baseline.hcl" {
+			t.Errorf("Unexpected provenance for '%s': '%s'", ia.Name, ia.IncludedFrom)
+		}
+		if ia.Name == "payment data" && ia.IncludedFrom != "middle.hcl" {
+			t.Errorf("Unexpected provenance for '%s': '%s'", ia.Name, ia.IncludedFrom)
+		}
+	}
+
+	if len(tm.DataFlowDiagrams) != 1 || tm.DataFlowDiagrams[0].IncludedFrom != "baseline/corp-baseline.hcl" {
+		t.Errorf("Expected the baseline dfd with its provenance, got %+v", tm.DataFlowDiagrams)
+	}
+}
+
+func TestParseHCLFileWithIncludingLimits(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name     string
+		filename string
+		depth    int
+		exp      string
+	}{
+		{
+			"cycle",
+			"./testdata/including/cycle/a.hcl",
+			DefaultMaxIncludeDepth,
+			"include cycle detected",
+		},
+		{
+			"depth",
+			"./testdata/including/chain/app.hcl",
+			1,
+			"exceeds the maximum include depth of 1",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			tmParser.SetMaxIncludeDepth(tc.depth)
+
+			err := tmParser.ParseFile(tc.filename, false)
+			if err == nil || !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Expected error containing '%s', got '%v'", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestParseHCLFileWithIncludingList(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFile("./testdata/including/layered.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	if tm.Including != "" || len(tm.IncludingSources) != 2 {
+		t.Errorf("Expected 2 including sources, got '%s' and %v", tm.Including, tm.IncludingSources)
+	}
+
+	if tm.Description != "Baseline for internet-facing web apps" {
+		t.Errorf("Expected the first source's description to take precedence, got '%s'", tm.Description)
+	}
+
+	if tm.Link != "https://example.com/baselines/web" || tm.DiagramLink != "https://example.com/baselines/pci.png" {
+		t.Errorf("Expected fields from both sources, got link '%s' and diagram link '%s'", tm.Link, tm.DiagramLink)
+	}
+
+	expThreats := map[string]string{
+		"xss":                 "Cross site scripting in the checkout form",
+		"credential_stuffing": "Credential stuffing, as described by the web baseline",
+	}
+
+	if len(tm.Threats) != len(expThreats) {
+		t.Fatalf("Expected %d threats, got %d", len(expThreats), len(tm.Threats))
+	}
+
+	for _, threat := range tm.Threats {
+		if threat.Description != expThreats[threat.Name] {
+			t.Errorf("Unexpected description for '%s': '%s'", threat.Name, threat.Description)
+		}
+	}
+
+	if len(tm.InformationAssets) != 1 || tm.InformationAssets[0].IncludedFrom != "baselines/pci.hcl" {
+		t.Errorf("Expected the PCI information asset, got %+v", tm.InformationAssets)
+	}
+}
+
+func TestParseHCLRawWithIncludingInvalid(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLRaw([]byte(`spec_version = "0.4.0"
+
+threatmodel "test" {
+  author = "@xntrik"
+  including = { source = "baselines/web.hcl" }
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "including must be a string or a list of strings") {
+		t.Errorf("Expected an error about the including type, got '%v'", err)
+	}
+}
+
+func TestParseHCLFileWithIncludingMergeStrategies(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name        string
+		strategy    IncludeMergeStrategy
+		description string
+		threatDesc  string
+		iaDesc      string
+		controls    []string
+		stride      []string
+		risk        bool
+		conflicts   []string
+	}{
+		{
+			"keep_parent",
+			MergeKeepParent,
+			"The checkout service",
+			"Service description of session hijacking",
+			"Service description of session tokens",
+			[]string{"Service short session lifetimes"},
+			[]string{"Spoofing", "Elevation Of Privilege"},
+			false,
+			[]string{
+				"TM 'Checkout': description shadows the one from 'baseline.hcl'",
+				"TM 'Checkout': information_asset 'session tokens' shadows the one from 'baseline.hcl'",
+				"TM 'Checkout': threat 'session_hijacking' shadows the one from 'baseline.hcl'",
+			},
+		},
+		{
+			"keep_included",
+			MergeKeepIncluded,
+			"The corporate baseline",
+			"Baseline description of session hijacking",
+			"Baseline description of session tokens",
+			[]string{"Baseline short session lifetimes", "Rotate the session id on login"},
+			[]string{"Spoofing"},
+			true,
+			[]string{
+				"TM 'Checkout': description was overridden by 'baseline.hcl'",
+				"TM 'Checkout': information_asset 'session tokens' was overridden by 'baseline.hcl'",
+				"TM 'Checkout': threat 'session_hijacking' was overridden by 'baseline.hcl'",
+			},
+		},
+		{
+			"deep_merge",
+			MergeDeepMerge,
+			"The checkout service",
+			"Service description of session hijacking",
+			"Service description of session tokens",
+			[]string{"Service short session lifetimes", "Rotate the session id on login"},
+			[]string{"Spoofing", "Elevation Of Privilege"},
+			true,
+			[]string{
+				"TM 'Checkout': description shadows the one from 'baseline.hcl'",
+				"TM 'Checkout': information_asset 'session tokens' shadows the one from 'baseline.hcl'",
+				"TM 'Checkout': control 'session_hijacking/Short session lifetimes' shadows the one from 'baseline.hcl'",
+				"TM 'Checkout': threat 'session_hijacking' was merged with 'baseline.hcl'",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.SetIncludeMergeStrategy(tc.strategy)
+			if err != nil {
+				t.Fatalf("Error setting merge strategy: %s", err)
+			}
+
+			err = tmParser.ParseFile("./testdata/including/merge/service.hcl", false)
+			if err != nil {
+				t.Fatalf("Error parsing legit TM file: %s", err)
+			}
+
+			tm := tmParser.GetWrapped().Threatmodels[0]
+
+			if tm.Description != tc.description {
+				t.Errorf("Expected description '%s', got '%s'", tc.description, tm.Description)
+			}
+
+			if len(tm.InformationAssets) != 1 || tm.InformationAssets[0].Description != tc.iaDesc {
+				t.Errorf("Expected information asset '%s', got %+v", tc.iaDesc, tm.InformationAssets)
+			}
+
+			if len(tm.Threats) != 1 {
+				t.Fatalf("Expected 1 threat, got %d", len(tm.Threats))
+			}
+
+			threat := tm.Threats[0]
+			if threat.Description != tc.threatDesc {
+				t.Errorf("Expected threat description '%s', got '%s'", tc.threatDesc, threat.Description)
+			}
+
+			controls := []string{}
+			for _, c := range threat.Controls {
+				controls = append(controls, c.Description)
+			}
+			if strings.Join(controls, ",") != strings.Join(tc.controls, ",") {
+				t.Errorf("Expected controls %v, got %v", tc.controls, controls)
+			}
+
+			if strings.Join(threat.Stride, ",") != strings.Join(tc.stride, ",") {
+				t.Errorf("Expected stride %v, got %v", tc.stride, threat.Stride)
+			}
+
+			if (threat.Risk != nil) != tc.risk {
+				t.Errorf("Expected risk present to be %t, got %+v", tc.risk, threat.Risk)
+			}
+
+			conflicts := []string{}
+			for _, c := range tmParser.IncludeConflicts() {
+				conflicts = append(conflicts, c.String())
+			}
+			if strings.Join(conflicts, "\n") != strings.Join(tc.conflicts, "\n") {
+				t.Errorf("Expected conflicts:\n%s\ngot:\n%s", strings.Join(tc.conflicts, "\n"), strings.Join(conflicts, "\n"))
+			}
+		})
+	}
+}
+
+func TestSetIncludeMergeStrategyInvalid(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.SetIncludeMergeStrategy("parent_wins")
+	if err == nil || !strings.Contains(err.Error(), "unknown include merge strategy") {
+		t.Errorf("Expected an unknown strategy error, got '%v'", err)
+	}
+}
@@ -0,0 +1,143 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ValidationErrorCode identifies the rule a ValidationError is about
+type ValidationErrorCode string
+
+// Values of ValidationError.Code
+const (
+	CodeDuplicateThreatmodel       ValidationErrorCode = "duplicate_threatmodel"
+	CodeDuplicateInformationAsset  ValidationErrorCode = "duplicate_information_asset"
+	CodeDuplicateTrustZone         ValidationErrorCode = "duplicate_trust_zone"
+	CodeDuplicateProcess           ValidationErrorCode = "duplicate_process"
+	CodeDuplicateExternalElement   ValidationErrorCode = "duplicate_external_element"
+	CodeDuplicateDataStore         ValidationErrorCode = "duplicate_data_store"
+	CodeDuplicateFlow              ValidationErrorCode = "duplicate_flow"
+	CodeInvalidInformationAssetRef ValidationErrorCode = "invalid_information_asset_ref"
+	CodeTrustZoneMismatch          ValidationErrorCode = "trust_zone_mismatch"
+	CodeInvalidFlowFrom            ValidationErrorCode = "invalid_flow_from"
+	CodeInvalidFlowTo              ValidationErrorCode = "invalid_flow_to"
+	CodeFlowToItself               ValidationErrorCode = "flow_to_itself"
+	CodeInvalidRiskLikelihood      ValidationErrorCode = "invalid_risk_likelihood"
+	CodeInvalidRiskImpact          ValidationErrorCode = "invalid_risk_impact"
+	CodeInvalidRiskSeverity        ValidationErrorCode = "invalid_risk_severity"
+	CodeInvalidEnumValue           ValidationErrorCode = "invalid_enum_value"
+	CodeInvalidLegacyDfd           ValidationErrorCode = "invalid_legacy_dfd"
+	CodeInvalidIncluding           ValidationErrorCode = "invalid_including"
+	CodeInvalidTrustRating         ValidationErrorCode = "invalid_trust_rating"
+)
+
+// ValidationError is a problem found while validating a parsed threat model.
+// Parsing returns them (inside a multierror, see ValidationErrors) with the
+// same messages as before, so existing callers see no change, while tooling
+// can use the code and range instead of matching on the message.
+type ValidationError struct {
+	// Code identifies the rule, such as CodeDuplicateProcess
+	Code ValidationErrorCode
+	// Severity is hcl.DiagError or hcl.DiagWarning
+	Severity hcl.DiagnosticSeverity
+	// Threatmodel is the name of the threat model the problem is in
+	Threatmodel string
+	// Path identifies the offending element within the threat model by the
+	// type and labels of the blocks leading to it, such as
+	// "/data_flow_diagram_v2/main/process/web"
+	Path string
+	// Message describes the problem, as returned by Error
+	Message string
+	// Range is the value of the offending attribute, or where the offending
+	// element is defined when the problem isn't with one attribute. It's nil
+	// when that isn't known (such as for a threat model read from OTM).
+	Range *hcl.Range
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Diagnostic returns e as an hcl.Diagnostic, for editors and other tooling
+// that already report those
+func (e *ValidationError) Diagnostic() *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: e.Severity,
+		Summary:  e.Message,
+		Subject:  e.Range,
+	}
+}
+
+// ValidationErrors returns every ValidationError in err, which is usually the
+// error returned from parsing, in the order they were found
+func ValidationErrors(err error) []*ValidationError {
+	var found []*ValidationError
+
+	var merr *multierror.Error
+	if errors.As(err, &merr) {
+		for _, e := range merr.Errors {
+			found = append(found, ValidationErrors(e)...)
+		}
+		return found
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		found = append(found, verr)
+	}
+
+	return found
+}
+
+// validationError returns a ValidationError for tm. A zero rng is treated as
+// unknown.
+func (tm *Threatmodel) validationError(code ValidationErrorCode, path string, rng hcl.Range, format string, a ...interface{}) *ValidationError {
+	verr := &ValidationError{
+		Code:        code,
+		Severity:    hcl.DiagError,
+		Threatmodel: tm.Name,
+		Path:        path,
+		Message:     fmt.Sprintf(format, a...),
+	}
+
+	if rng != (hcl.Range{}) {
+		verr.Range = rng.Ptr()
+	}
+
+	return verr
+}
+
+// attrRange returns the range of the value of the attribute name in body, or
+// def if there's no such attribute (or no body, such as for an element read
+// from OTM)
+func attrRange(body hcl.Body, name string, def hcl.Range) hcl.Range {
+	if body == nil {
+		return def
+	}
+
+	content, _, _ := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: name}},
+	})
+	if content == nil {
+		return def
+	}
+
+	attr, ok := content.Attributes[name]
+	if !ok {
+		return def
+	}
+
+	return attr.Expr.Range()
+}
+
+// dfdPath is the path of the data flow diagram adfd within its threat model
+func dfdPath(adfd *DataFlowDiagram) string {
+	if adfd.ShiftedFromLegacy {
+		return blockPath("", "data_flow_diagram", nil)
+	}
+
+	return blockPath("", "data_flow_diagram_v2", []string{adfd.Name})
+}
@@ -0,0 +1,147 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestValidationErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  threat "t" {
+    description            = "words"
+    information_asset_refs = ["nope"]
+  }
+
+  data_flow_diagram_v2 "dfd" {
+    process "a" {}
+
+    trust_zone "z" {
+      process "a" {
+        trust_zone = "other"
+      }
+    }
+
+    flow "http" {
+      from = "a"
+      to   = "b"
+    }
+  }
+}
+`))
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	got := []string{}
+	for _, verr := range ValidationErrors(err) {
+		if verr.Threatmodel != "tm" || verr.Severity != hcl.DiagError || verr.Range == nil {
+			t.Errorf("Incorrect validation error: %+v", verr)
+			continue
+		}
+		got = append(got, string(verr.Code)+" "+verr.Path+" "+verr.Range.String())
+	}
+
+	expected := []string{
+		"duplicate_process /data_flow_diagram_v2/dfd/trust_zone/z/process/a STDIN:13,7-18",
+		"trust_zone_mismatch /data_flow_diagram_v2/dfd/trust_zone/z/process/a STDIN:14,22-29",
+		"invalid_flow_to /data_flow_diagram_v2/dfd/flow/http STDIN:20,14-17",
+		"invalid_information_asset_ref /threat/t STDIN:6,30-38",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Incorrect validation errors:\n%s", strings.Join(got, "\n"))
+	}
+
+	// The messages are unchanged
+	if !strings.Contains(err.Error(), "TM 'tm': duplicate process found in dfd 'a'") {
+		t.Errorf("Error '%s' doesn't contain the duplicate process message", err)
+	}
+}
+
+func TestValidationErrorTrustRating(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name   string
+		rating string
+		exp    string
+		rng    string
+	}{
+		{"lowest", "0", "", ""},
+		{"highest", "100", "", ""},
+		{"too_high", "500", "trust_zone 'z' has a trust_rating of 500, which isn't between 0 and 100", "STDIN:6,22-25"},
+		{"negative", "-3", "trust_zone 'z' has a trust_rating of -3, which isn't between 0 and 100", "STDIN:6,22-24"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  data_flow_diagram_v2 "dfd" {
+    trust_zone "z" {
+      trust_rating = ` + tc.rating + `
+    }
+  }
+}
+`))
+
+			if tc.exp == "" {
+				if err != nil {
+					t.Fatalf("Error parsing legit TM file: %s", err)
+				}
+				return
+			}
+
+			verrs := ValidationErrors(err)
+			if len(verrs) != 1 {
+				t.Fatalf("Expected 1 validation error, got '%v'", err)
+			}
+
+			if !strings.Contains(verrs[0].Message, tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", verrs[0].Message, tc.exp)
+			}
+
+			exp := "invalid_trust_rating /data_flow_diagram_v2/dfd/trust_zone/z " + tc.rng
+			got := string(verrs[0].Code) + " " + verrs[0].Path + " " + verrs[0].Range.String()
+			if got != exp {
+				t.Errorf("Incorrect validation error: %s, expected %s", got, exp)
+			}
+		})
+	}
+}
+
+func TestValidationErrorDiagnostic(t *testing.T) {
+	rng := hcl.Range{Filename: "tm.hcl", Start: hcl.Pos{Line: 3, Column: 5}, End: hcl.Pos{Line: 3, Column: 10}}
+	tm := &Threatmodel{Name: "tm"}
+	verr := tm.validationError(CodeDuplicateFlow, "/flow/x", rng, "TM '%s': duplicate", tm.Name)
+
+	diag := verr.Diagnostic()
+	if diag.Severity != hcl.DiagError || diag.Summary != "TM 'tm': duplicate" || diag.Subject == nil || *diag.Subject != rng {
+		t.Errorf("Incorrect diagnostic: %+v", diag)
+	}
+
+	// A zero range is unknown
+	if tm.validationError(CodeDuplicateFlow, "", hcl.Range{}, "x").Range != nil {
+		t.Errorf("Expected no range")
+	}
+
+	// ValidationErrors finds them however they're wrapped
+	wrapped := errors.Join(errors.New("other"), verr)
+	if found := ValidationErrors(wrapped); len(found) != 1 || found[0] != verr {
+		t.Errorf("Expected to find the validation error, got %v", found)
+	}
+}
@@ -0,0 +1,411 @@
+package spec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// VarEnvPrefix is the prefix of environment variables read by
+// SetVariablesFromEnv. THREATCL_VAR_env sets the variable "env".
+const VarEnvPrefix = "THREATCL_VAR_"
+
+// variableTypes are the quoted values accepted by a variable's `type`
+// attribute. A bare type expression, such as `list(string)`, is read as a
+// type constraint instead (see variableType).
+var variableTypes = map[string]cty.Type{
+	"string":       cty.String,
+	"number":       cty.Number,
+	"bool":         cty.Bool,
+	"list":         cty.List(cty.String),
+	"list(string)": cty.List(cty.String),
+	"list(number)": cty.List(cty.Number),
+	"list(bool)":   cty.List(cty.Bool),
+}
+
+// SetVariables overrides the value of declared variables. Values are given as
+// they would be on a command line: a string variable takes the value as is,
+// and any other type parses it as an HCL expression, such as `42`, `true` or
+// `["a", "b"]`. These take precedence over a var file, environment variables
+// and the values in the threat model.
+func (p *ThreatmodelParser) SetVariables(vars map[string]string) {
+	p.varOverrides = make(map[string]string, len(vars))
+	for k, v := range vars {
+		p.varOverrides[k] = v
+	}
+}
+
+// SetVariablesFromEnv overrides the value of declared variables from the
+// environment variables starting with VarEnvPrefix. Values are read in the same
+// way as SetVariables. These have the lowest precedence of the overrides, and
+// unlike the others, environment variables that don't match a declared
+// variable are ignored.
+func (p *ThreatmodelParser) SetVariablesFromEnv() {
+	p.varEnv = make(map[string]string)
+	for _, env := range os.Environ() {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, VarEnvPrefix) || name == VarEnvPrefix {
+			continue
+		}
+		p.varEnv[strings.TrimPrefix(name, VarEnvPrefix)] = value
+	}
+}
+
+// SetVarFile overrides the value of declared variables from an HCL (or, with a
+// .json extension, JSON) file of `name = value` attributes. These take
+// precedence over environment variables and the values in the threat model.
+func (p *ThreatmodelParser) SetVarFile(filename string) error {
+	parser := hclparse.NewParser()
+
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if filepath.Ext(filename) == ".json" {
+		f, diags = parser.ParseJSONFile(filename)
+	} else {
+		f, diags = parser.ParseHCLFile(filename)
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	attrs, diags := f.Body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	vars := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return diags
+		}
+		vars[name] = val
+	}
+
+	p.varFile = vars
+	p.varFilename = filename
+	return nil
+}
+
+// extractVars does a shallow parsing of an HCL file looking for
+// 'variable' blocks, and resolves the value of each from the parser's
+// overrides, its value or its default, converted to its type and checked
+// against its validation conditions
+func (p *ThreatmodelParser) extractVars(f *hcl.File, funcs map[string]function.Function) (map[string]cty.Value, error) {
+	output := make(map[string]cty.Value)
+	var errMap error
+
+	extract, _, diags := f.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{
+				Type:       "variable",
+				LabelNames: []string{"name"},
+			},
+		},
+	})
+
+	if diags.HasErrors() {
+		return output, diags
+	}
+
+	declared := make(map[string]bool)
+	validations := make(map[string][]*hcl.Block)
+	for _, b := range extract.Blocks {
+		if len(b.Labels) == 0 {
+			continue
+		}
+		name := b.Labels[0]
+		declared[name] = true
+
+		content, _, _ := b.Body.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "value"},
+				{Name: "default"},
+				{Name: "type"},
+			},
+			Blocks: []hcl.BlockHeaderSchema{
+				{Type: "validation"},
+			},
+		})
+
+		val, err := p.variableValue(name, content, funcs)
+		if err != nil {
+			errMap = multierror.Append(errMap, err)
+			continue
+		}
+
+		output[name] = val
+		validations[name] = content.Blocks
+	}
+
+	for name := range p.varOverrides {
+		if !declared[name] {
+			errMap = multierror.Append(errMap, fmt.Errorf("a value was given for variable '%s', but it isn't declared", name))
+		}
+	}
+
+	for name := range p.varFile {
+		if !declared[name] {
+			errMap = multierror.Append(errMap, fmt.Errorf("'%s' sets variable '%s', but it isn't declared", p.varFilename, name))
+		}
+	}
+
+	if errMap != nil {
+		return output, errMap
+	}
+
+	// Conditions are checked once every variable is known, so they may refer
+	// to each other
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(output)},
+		Functions: funcs,
+	}
+
+	names := make([]string, 0, len(validations))
+	for name := range validations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, b := range validations[name] {
+			err := checkVarValidation(name, b, ctx)
+			if err != nil {
+				errMap = multierror.Append(errMap, err)
+			}
+		}
+	}
+
+	return output, errMap
+}
+
+// variableValue resolves a single variable declared with content
+func (p *ThreatmodelParser) variableValue(name string, content *hcl.BodyContent, funcs map[string]function.Function) (cty.Value, error) {
+	ty := cty.DynamicPseudoType
+	if attr, ok := content.Attributes["type"]; ok {
+		var err error
+		ty, err = variableType(name, attr.Expr)
+		if err != nil {
+			return cty.NilVal, err
+		}
+	}
+
+	valueAttr, hasValue := content.Attributes["value"]
+	defaultAttr, hasDefault := content.Attributes["default"]
+	if hasValue && hasDefault {
+		return cty.NilVal, fmt.Errorf("variable '%s': only one of value and default may be set", name)
+	}
+
+	override, hasOverride := p.varOverrides[name]
+	fileVal, hasFileVal := p.varFile[name]
+	envVal, hasEnvVal := p.varEnv[name]
+
+	var val cty.Value
+	var err error
+	switch {
+	case hasOverride:
+		val, err = parseVarString(override, ty)
+	case hasFileVal:
+		val = fileVal
+	case hasEnvVal:
+		val, err = parseVarString(envVal, ty)
+	case hasValue:
+		// value is a string attribute, so lists need to use default
+		valueExtract := ""
+		diags := gohcl.DecodeExpression(valueAttr.Expr, nil, &valueExtract)
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+		val = cty.StringVal(valueExtract)
+	case hasDefault:
+		var diags hcl.Diagnostics
+		val, diags = defaultAttr.Expr.Value(&hcl.EvalContext{Functions: funcs})
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+	default:
+		return cty.NilVal, fmt.Errorf("variable '%s' has no value: set a default, or supply one", name)
+	}
+
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("variable '%s': %s", name, err)
+	}
+
+	if ty != cty.DynamicPseudoType {
+		val, err = convert.Convert(val, ty)
+		if err != nil {
+			return cty.NilVal, fmt.Errorf("variable '%s': invalid value: %s", name, err)
+		}
+	}
+
+	if val.IsNull() {
+		return cty.NilVal, fmt.Errorf("variable '%s' has no value: set a default, or supply one", name)
+	}
+
+	return val, nil
+}
+
+// checkVarValidation evaluates a variable's validation block b
+func checkVarValidation(name string, b *hcl.Block, ctx *hcl.EvalContext) error {
+	content, diags := b.Body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "condition", Required: true},
+			{Name: "error_message", Required: true},
+		},
+	})
+	if diags.HasErrors() {
+		return diags
+	}
+
+	result, diags := content.Attributes["condition"].Expr.Value(ctx)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	result, err := convert.Convert(result, cty.Bool)
+	if err != nil || result.IsNull() || !result.IsKnown() {
+		return fmt.Errorf("variable '%s': validation condition must be a bool", name)
+	}
+
+	if result.True() {
+		return nil
+	}
+
+	errorMessage := ""
+	diags = gohcl.DecodeExpression(content.Attributes["error_message"].Expr, ctx, &errorMessage)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	return fmt.Errorf("variable '%s': %s", name, errorMessage)
+}
+
+// variableType returns the type named by a variable's `type` attribute, which
+// is either one of the quoted variableTypes or, as in Terraform, a bare type
+// expression such as `string` or `map(number)`
+func variableType(name string, expr hcl.Expression) (cty.Type, error) {
+	typeName, diags := expr.Value(nil)
+	if diags.HasErrors() || typeName.Type() != cty.String || typeName.IsNull() {
+		ty, diags := typeexpr.TypeConstraint(expr)
+		if diags.HasErrors() {
+			return cty.NilType, diags
+		}
+		return ty, nil
+	}
+
+	ty, known := variableTypes[typeName.AsString()]
+	if !known {
+		return cty.NilType, fmt.Errorf("variable '%s': unknown type '%s', expected one of string, number, bool, list, list(string), list(number) or list(bool)", name, typeName.AsString())
+	}
+
+	return ty, nil
+}
+
+// variableTypeName returns the name of the type in a variable's `type`
+// attribute: the string itself when quoted, otherwise the expression's source
+func variableTypeName(expr hcl.Expression, src []byte) string {
+	typeName, diags := expr.Value(nil)
+	if !diags.HasErrors() && typeName.Type() == cty.String && !typeName.IsNull() {
+		return typeName.AsString()
+	}
+	return string(src)
+}
+
+// parseVarString reads an override given as a string. Anything but a string
+// (or untyped) variable is parsed as an HCL expression.
+func parseVarString(raw string, ty cty.Type) (cty.Value, error) {
+	if ty == cty.DynamicPseudoType || ty == cty.String {
+		return cty.StringVal(raw), nil
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(raw), "<value>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	return val, nil
+}
+
+func (p *ThreatmodelParser) buildVarCtx(ctx *hcl.EvalContext, varMap map[string]cty.Value) error {
+	ctx.Variables["var"] = cty.ObjectVal(varMap)
+
+	return nil
+}
+
+// recordSources keeps the source text of each variable type, validation
+// condition and local value, so HclString can write them back out
+func (p *ThreatmodelParser) recordSources(sources sourceFiles) {
+	for _, v := range p.wrapped.Variables {
+		if v.typeSrc == nil && v.TypeExpr != nil {
+			v.typeSrc = sources.rangeSource(v.TypeExpr.Range())
+			v.Type = variableTypeName(v.TypeExpr, v.typeSrc)
+		}
+
+		for _, validation := range v.Validations {
+			if validation.conditionSrc != nil || validation.Condition == nil {
+				continue
+			}
+
+			validation.conditionSrc = sources.rangeSource(validation.Condition.Range())
+		}
+	}
+
+	for _, l := range p.wrapped.Locals {
+		if l.src != nil {
+			continue
+		}
+
+		attrs := make([]*hcl.Attribute, 0, len(l.Values))
+		for _, attr := range l.Values {
+			attrs = append(attrs, attr)
+		}
+		sort.Slice(attrs, func(i, j int) bool {
+			return attrs[i].Range.Start.Byte < attrs[j].Range.Start.Byte
+		})
+
+		l.src = [][]byte{}
+		for _, attr := range attrs {
+			if src := sources.rangeSource(attr.Range); src != nil {
+				l.src = append(l.src, src)
+			}
+		}
+	}
+}
+
+func (v *Variable) exprSource(attr string) []byte {
+	if attr != "type" || v.Type == "" {
+		return nil
+	}
+	if v.typeSrc != nil {
+		return v.typeSrc
+	}
+	if _, known := variableTypes[v.Type]; known {
+		return []byte(strconv.Quote(v.Type))
+	}
+	return []byte(v.Type)
+}
+
+func (v *VariableValidation) exprSource(attr string) []byte {
+	if attr == "condition" {
+		return v.conditionSrc
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseHCLFileWithTypedVars(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-withtypedvars.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if tm.Description != "staging with 2 replicas" {
+		t.Errorf("Incorrect description: %s", tm.Description)
+	}
+
+	if tm.Attributes.InternetFacing {
+		t.Errorf("internet_facing should be false")
+	}
+
+	if len(tm.Threats[0].Stride) != 1 || !strings.EqualFold(tm.Threats[0].Stride[0], "spoofing") {
+		t.Errorf("Incorrect stride: %v", tm.Threats[0].Stride)
+	}
+
+	if tmParser.GetWrapped().Variables[0].Description != "The environment being modelled" {
+		t.Errorf("Variable description wasn't decoded: %+v", tmParser.GetWrapped().Variables[0])
+	}
+}
+
+func TestParseHCLFileWithVarOverrides(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	varFile := filepath.Join(t.TempDir(), "prod.tfvars.hcl")
+	err := os.WriteFile(varFile, []byte("env = \"prod\"\nreplicas = 3\nstride = [\"tampering\", \"spoofing\"]\n"), 0o644)
+	if err != nil {
+		t.Fatalf("Error writing var file: %s", err)
+	}
+
+	t.Setenv(VarEnvPrefix+"env", "staging")
+	t.Setenv(VarEnvPrefix+"internet_facing", "true")
+	t.Setenv(VarEnvPrefix+"undeclared", "ignored")
+
+	tmParser := NewThreatmodelParser(defaultCfg)
+	tmParser.SetVariablesFromEnv()
+	err = tmParser.SetVarFile(varFile)
+	if err != nil {
+		t.Fatalf("Error setting var file: %s", err)
+	}
+	tmParser.SetVariables(map[string]string{"replicas": "5"})
+
+	err = tmParser.ParseHCLFile("./testdata/tm-withtypedvars.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+
+	// env from the var file beats the environment, replicas from the map
+	// beats the var file
+	if tm.Description != "prod with 5 replicas" {
+		t.Errorf("Incorrect description: %s", tm.Description)
+	}
+
+	if !tm.Attributes.InternetFacing {
+		t.Errorf("internet_facing should be set from the environment")
+	}
+
+	if len(tm.Threats[0].Stride) != 2 {
+		t.Errorf("Incorrect stride: %v", tm.Threats[0].Stride)
+	}
+}
+
+func TestParseHCLFileWithVarErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		vars map[string]string
+		exp  string
+	}{
+		{
+			"failed_validation",
+			map[string]string{"env": "dev"},
+			"variable 'env': env must be staging or prod",
+		},
+		{
+			"failed_numeric_validation",
+			map[string]string{"replicas": "0"},
+			"variable 'replicas': replicas must be positive",
+		},
+		{
+			"wrong_type",
+			map[string]string{"replicas": "lots"},
+			"variable 'replicas'",
+		},
+		{
+			"wrong_list_type",
+			map[string]string{"stride": "{}"},
+			"variable 'stride': invalid value",
+		},
+		{
+			"undeclared",
+			map[string]string{"nope": "x"},
+			"a value was given for variable 'nope', but it isn't declared",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			tmParser.SetVariables(tc.vars)
+
+			err := tmParser.ParseHCLFile("./testdata/tm-withtypedvars.hcl", false)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawVarDeclarationErrors(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  string
+	}{
+		{
+			"no_value",
+			`variable "v" { type = "string" }`,
+			"variable 'v' has no value",
+		},
+		{
+			"value_and_default",
+			`variable "v" {
+  value   = "a"
+  default = "b"
+}`,
+			"only one of value and default may be set",
+		},
+		{
+			"unknown_type",
+			`variable "v" {
+  type    = "map"
+  default = "a"
+}`,
+			"unknown type 'map'",
+		},
+		{
+			"invalid_bare_type",
+			`variable "v" {
+  type    = map
+  default = "a"
+}`,
+			"The map type constructor requires one argument",
+		},
+		{
+			"bare_type_mismatch",
+			`variable "v" {
+  type    = number
+  default = "a"
+}`,
+			"variable 'v': invalid value",
+		},
+		{
+			"non_bool_condition",
+			`variable "v" {
+  default = "a"
+  validation {
+    condition     = "yes"
+    error_message = "nope"
+  }
+}`,
+			"validation condition must be a bool",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tmParser := NewThreatmodelParser(defaultCfg)
+			err := tmParser.ParseHCLRaw([]byte(tc.in + "\nthreatmodel \"tm\" {\n  author = \"@me\"\n}\n"))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tc.exp) {
+				t.Errorf("Error '%s' doesn't contain '%s'", err, tc.exp)
+			}
+		})
+	}
+}
+
+func TestParseHCLRawEmptyStringVar(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLRaw([]byte(`variable "empty" {
+  value = ""
+}
+
+threatmodel "tm" {
+  author      = "@me"
+  description = "x${var.empty}x"
+}
+`))
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	if tmParser.GetWrapped().Threatmodels[0].Description != "xx" {
+		t.Errorf("Incorrect description: %s", tmParser.GetWrapped().Threatmodels[0].Description)
+	}
+}
+
+func TestParseHCLRawBareVarTypes(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLRaw([]byte(`variable "replicas" {
+  type    = number
+  default = "3"
+}
+
+variable "owners" {
+  type = map(string)
+  default = {
+    web = "@web"
+  }
+}
+
+variable "env" {
+  type    = "string"
+  default = "prod"
+}
+
+threatmodel "tm" {
+  author      = var.owners["web"]
+  description = "${var.replicas + 1} in ${var.env}"
+}
+`))
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	tm := tmParser.GetWrapped().Threatmodels[0]
+	if tm.Author != "@web" || tm.Description != "4 in prod" {
+		t.Errorf("Incorrect threatmodel: %s, %s", tm.Author, tm.Description)
+	}
+
+	vars := tmParser.GetWrapped().Variables
+	if vars[0].Type != "number" || vars[1].Type != "map(string)" || vars[2].Type != "string" {
+		t.Errorf("Incorrect variable types: %s, %s, %s", vars[0].Type, vars[1].Type, vars[2].Type)
+	}
+
+	out := tmParser.HclString()
+	for _, exp := range []string{`type    = number`, `type = map(string)`, `type    = "string"`} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("Output doesn't contain '%s':\n%s", exp, out)
+		}
+	}
+
+	reparse(t, tmParser)
+}
+
+func TestRoundTripTypedVars(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseHCLFile("./testdata/tm-withtypedvars.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	out := tmParser.HclString()
+	if !strings.Contains(out, `var.replicas > 0`) {
+		t.Errorf("Validation condition wasn't written out:\n%s", out)
+	}
+
+	p2 := reparse(t, tmParser)
+	vars := p2.GetWrapped().Variables
+	if len(vars) != 4 || vars[1].Type != "number" || len(vars[1].Validations) != 1 {
+		t.Errorf("Variables lost in round trip: %+v", vars)
+	}
+}
@@ -0,0 +1,121 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// WarningKind is the sort of thing a Warning is about
+type WarningKind string
+
+// Values of Warning.Kind
+const (
+	// WarningDeprecated is a deprecated block or attribute, or a missing
+	// spec_version
+	WarningDeprecated WarningKind = "deprecated"
+	// WarningNormalized is a value that was rewritten to its canonical form,
+	// such as "spoofing" to "Spoofing"
+	WarningNormalized WarningKind = "normalized"
+	// WarningReplaced is an unknown value that was dropped, or replaced with
+	// the configured default
+	WarningReplaced WarningKind = "replaced"
+	// WarningUnsupported is something the parser can't do for this input,
+	// such as imports when reading from STDIN
+	WarningUnsupported WarningKind = "unsupported"
+)
+
+// Warning is a problem found while parsing that doesn't stop the threat model
+// from being used. The parser never prints these; see Warnings.
+type Warning struct {
+	Kind WarningKind
+	// Threatmodel is the name of the threat model the warning is about, if
+	// any
+	Threatmodel string
+	Message     string
+	// Range is where the warning applies, or nil when that isn't known
+	Range *hcl.Range
+}
+
+func (w Warning) String() string {
+	msg := w.Message
+	if w.Threatmodel != "" {
+		msg = fmt.Sprintf("TM '%s': %s", w.Threatmodel, msg)
+	}
+
+	if w.Range != nil {
+		msg = fmt.Sprintf("%s: %s", w.Range, msg)
+	}
+
+	return msg
+}
+
+// Warnings returns every warning recorded while parsing (including from the
+// threat models that were included), in the order they were found.
+func (p *ThreatmodelParser) Warnings() []Warning {
+	p.resultsMu.RLock()
+	defer p.resultsMu.RUnlock()
+
+	return p.warnings
+}
+
+// warn records a warning. A zero rng is treated as unknown.
+func (p *ThreatmodelParser) warn(kind WarningKind, tm string, rng hcl.Range, format string, a ...interface{}) {
+	w := Warning{
+		Kind:        kind,
+		Threatmodel: tm,
+		Message:     fmt.Sprintf(format, a...),
+	}
+
+	if rng != (hcl.Range{}) {
+		w.Range = rng.Ptr()
+	}
+
+	p.warnings = append(p.warnings, w)
+}
+
+// warnNormalized records a warning if normalizing the attr value in changed
+// it to out. An empty out means in was dropped.
+func (p *ThreatmodelParser) warnNormalized(tm *Threatmodel, rng hcl.Range, attr, in, out string) {
+	switch {
+	case in == out:
+	case out == "":
+		p.warn(WarningReplaced, tm.Name, rng, "unknown %s '%s' was dropped", attr, in)
+	case strings.EqualFold(strings.TrimSpace(in), out):
+		p.warn(WarningNormalized, tm.Name, rng, "%s '%s' was normalized to '%s'", attr, in, out)
+	default:
+		p.warn(WarningReplaced, tm.Name, rng, "unknown %s '%s' was replaced with the default '%s'", attr, in, out)
+	}
+}
+
+// warnDeprecations records a warning for each deprecated block or attribute
+// the parsed threat models use, at the first place each is used. It runs
+// before they're merged or shifted into their replacements.
+func (p *ThreatmodelParser) warnDeprecations() {
+	deprecated := []struct {
+		c    Constraint
+		used func(t *Threat) bool
+	}{
+		{&controlStringToBlock{}, func(t *Threat) bool { return t.Control != "" }},
+		{&proposedControlToBlock{}, func(t *Threat) bool { return len(t.ProposedControls) > 0 }},
+		{&expandedControlToControl{}, func(t *Threat) bool { return len(t.ExpandedControls) > 0 }},
+	}
+
+	for i := range p.wrapped.Threatmodels {
+		tm := &p.wrapped.Threatmodels[i]
+
+		for _, d := range deprecated {
+			for _, t := range tm.Threats {
+				if d.used(t) {
+					p.warn(WarningDeprecated, tm.Name, t.DefRange, "%s", d.c.Message())
+					break
+				}
+			}
+		}
+
+		if tm.LegacyDfd != nil {
+			p.warn(WarningDeprecated, tm.Name, tm.LegacyDfd.DefRange, "%s", (&multiDfd{}).Message())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zenizh/go-capturer"
+)
+
+func TestParseHCLRawWarnings(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	out := capturer.CaptureStdout(func() {
+		err := tmParser.ParseHCLRaw([]byte(`threatmodel "tm" {
+  author = "@me"
+
+  information_asset "creds" {
+    information_classification = "bogus"
+  }
+
+  threat "t" {
+    description = "words"
+    control     = "a control string"
+    stride      = ["spoofing", "Nonsense"]
+    impacts     = ["Confidentiality"]
+  }
+
+  data_flow_diagram {
+    process "a" {}
+  }
+}
+`))
+		if err != nil {
+			t.Fatalf("Error parsing legit TM file: %s", err)
+		}
+	})
+
+	if out != "" {
+		t.Errorf("Expected nothing on stdout, got '%s'", out)
+	}
+
+	got := []string{}
+	for _, w := range tmParser.Warnings() {
+		line := string(w.Kind) + ": " + w.Message
+		if w.Range != nil {
+			line = w.Range.String() + " " + line
+		}
+		got = append(got, line)
+	}
+
+	expected := []string{
+		"deprecated: STDIN: No provided version. The current hcltm version is '" + defaultCfg.Version + "'",
+		"STDIN:8,3-13 deprecated: Deprecation warning: This threat model has defined `control` strings",
+		"STDIN:15,3-20 deprecated: Deprecation warning: This threat model has a defined `data_flow_diagram`",
+		"STDIN:4,3-28 replaced: unknown information_classification 'bogus' was replaced with the default 'Confidential'",
+		"STDIN:8,3-13 normalized: stride 'spoofing' was normalized to 'Spoofing'",
+		"STDIN:8,3-13 replaced: unknown stride 'Nonsense' was dropped",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Incorrect warnings:\n%s", strings.Join(got, "\n"))
+	}
+	for i := range expected {
+		if !strings.HasPrefix(got[i], expected[i]) {
+			t.Errorf("Warning '%s' doesn't start with '%s'", got[i], expected[i])
+		}
+	}
+
+	w := tmParser.Warnings()[5]
+	if w.Threatmodel != "tm" || !strings.HasSuffix(w.String(), "TM 'tm': unknown stride 'Nonsense' was dropped") {
+		t.Errorf("Incorrect warning: %s", w)
+	}
+}
+
+func TestVersionConstraintsNoStdout(t *testing.T) {
+	defaultCfg := &ThreatmodelSpecConfig{}
+	defaultCfg.setDefaults()
+	tmParser := NewThreatmodelParser(defaultCfg)
+
+	err := tmParser.ParseFile("./testdata/tm-withimport.hcl", false)
+	if err != nil {
+		t.Fatalf("Error parsing legit TM file: %s", err)
+	}
+
+	var msg string
+	out := capturer.CaptureStdout(func() {
+		msg, err = VersionConstraints(tmParser.GetWrapped(), true)
+	})
+	if err != nil {
+		t.Fatalf("Error parsing constraints: %s", err)
+	}
+
+	if out != "" || msg == "" {
+		t.Errorf("Expected a message and nothing on stdout, got '%s' and '%s'", msg, out)
+	}
+}
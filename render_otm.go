@@ -8,6 +8,12 @@ import (
 	"github.com/threatcl/go-otm/pkg/otm"
 )
 
+// DefaultTrustRating is the OTM trustRating of a trust zone without a
+// trust_rating, including a zone that's only named by an element's trust_zone.
+// OTM requires every trust zone to have a rating, from 0 (untrusted) to 100
+// (fully trusted), so a zone with no rating of its own is rated in the middle.
+const DefaultTrustRating = 50
+
 func (tm *Threatmodel) RenderOtm() (otm.OtmSchemaJson, error) {
 	o := otm.OtmSchemaJson{}
 	o.OtmVersion = OtmVersion
@@ -34,6 +40,14 @@ func (tm *Threatmodel) RenderOtm() (otm.OtmSchemaJson, error) {
 			attr["source"] = ia.Source
 		}
 
+		if ia.Ref != "" {
+			attr["ref"] = ia.Ref
+		}
+
+		if len(attr) > 0 {
+			asset.Attributes = attr
+		}
+
 		o.Assets = append(o.Assets, asset)
 	}
 
@@ -102,6 +116,11 @@ func (tm *Threatmodel) RenderOtm() (otm.OtmSchemaJson, error) {
 				attr["implementation_notes"] = control.ImplementationNotes
 			}
 
+			// OTM only links mitigations to threats through component threat
+			// instances, so record the owning threat to keep the association
+			// through an import.
+			attr["threat"] = threat.Id
+
 			mitigation.Attributes = attr
 
 			o.Mitigations = append(o.Mitigations, mitigation)
@@ -120,9 +139,117 @@ func (tm *Threatmodel) RenderOtm() (otm.OtmSchemaJson, error) {
 		o.Representations = append(o.Representations, repr)
 	}
 
+	for _, dfd := range tm.DataFlowDiagrams {
+		dfd.renderOtm(&o)
+	}
+
 	return o, nil
 }
 
+// renderOtm adds the DFD's architecture to an OTM document: trust zones become
+// trustZones, processes/external elements/data stores become components
+// parented by their trust zone, and flows become dataflows. OTM has one flat
+// architecture per project, so every element is tagged with the DFD it came
+// from (see otmDfdAttr) and ids are prefixed with the DFD name to stay unique.
+func (d *DataFlowDiagram) renderOtm(o *otm.OtmSchemaJson) {
+	dfdAttr := func() map[string]interface{} {
+		return map[string]interface{}{otmDfdAttr: d.Name}
+	}
+	dfdID := func(name string) string {
+		return toKebabCase(fmt.Sprintf("%s %s", d.Name, name))
+	}
+
+	zoneIDs := make(map[string]string)
+	addZone := func(name string, rating *int) *string {
+		if name == "" {
+			return nil
+		}
+		if id, ok := zoneIDs[name]; ok {
+			return pToStr(id)
+		}
+		zone := otm.OtmSchemaJsonTrustZonesElem{
+			Name:       name,
+			Id:         dfdID(name),
+			Attributes: dfdAttr(),
+			Risk:       otm.OtmSchemaJsonTrustZonesElemRisk{TrustRating: DefaultTrustRating},
+		}
+		if rating != nil {
+			zone.Risk.TrustRating = float64(*rating)
+		}
+		zoneIDs[name] = zone.Id
+		o.TrustZones = append(o.TrustZones, zone)
+		return pToStr(zone.Id)
+	}
+
+	addComponent := func(name, componentType, zone string) *otm.OtmSchemaJsonComponentsElem {
+		o.Components = append(o.Components, otm.OtmSchemaJsonComponentsElem{
+			Name:       name,
+			Id:         dfdID(name),
+			Type:       componentType,
+			Parent:     otm.Parent{TrustZone: addZone(zone, nil)},
+			Attributes: dfdAttr(),
+		})
+		return &o.Components[len(o.Components)-1]
+	}
+
+	addDataStore := func(ds *DfdData, zone string) {
+		c := addComponent(ds.Name, "data-store", zone)
+		if ds.IaLink != "" {
+			c.Assets = &otm.AssetInstance{
+				Stored: []*string{pToStr(toKebabCase(ds.IaLink))},
+			}
+		}
+	}
+
+	// Declared zones first so they keep their authored order, then any zone
+	// only referenced through an element's trust_zone attribute
+	for _, tz := range d.TrustZones {
+		addZone(tz.Name, tz.TrustRating)
+	}
+
+	for _, p := range d.Processes {
+		addComponent(p.Name, "process", p.TrustZone)
+	}
+
+	for _, e := range d.ExternalElements {
+		addComponent(e.Name, "external-element", e.TrustZone)
+	}
+
+	for _, ds := range d.DataStores {
+		addDataStore(ds, ds.TrustZone)
+	}
+
+	for _, tz := range d.TrustZones {
+		for _, p := range tz.Processes {
+			addComponent(p.Name, "process", tz.Name)
+		}
+
+		for _, e := range tz.ExternalElements {
+			addComponent(e.Name, "external-element", tz.Name)
+		}
+
+		for _, ds := range tz.DataStores {
+			addDataStore(ds, tz.Name)
+		}
+	}
+
+	for _, f := range d.Flows {
+		flow := otm.OtmSchemaJsonDataflowsElem{
+			Name:        f.Name,
+			Id:          dfdID(fmt.Sprintf("%s %s %s", f.From, f.To, f.Name)),
+			Source:      dfdID(f.From),
+			Destination: dfdID(f.To),
+			Attributes:  dfdAttr(),
+		}
+
+		if f.Protocol != "" {
+			flow.Attributes["protocol"] = f.Protocol
+		}
+
+		o.Dataflows = append(o.Dataflows, flow)
+	}
+}
+
 func (tm *Threatmodel) getAttributes() map[string]interface{} {
 	attr := make(map[string]interface{})
 
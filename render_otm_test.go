@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"github.com/threatcl/go-otm/pkg/otm"
 )
 
 func TestKebab(t *testing.T) {
@@ -151,3 +153,113 @@ func TestRenderOtm(t *testing.T) {
 	}
 
 }
+
+func TestRenderOtmDfd(t *testing.T) {
+	storageRating := 80
+	tm := &Threatmodel{
+		Name:   "test",
+		Author: "x",
+		InformationAssets: []*InformationAsset{
+			{
+				Name: "Customer Data",
+			},
+		},
+		DataFlowDiagrams: []*DataFlowDiagram{
+			{
+				Name: "main",
+				Processes: []*DfdProcess{
+					{
+						Name:      "api",
+						TrustZone: "internal",
+					},
+				},
+				ExternalElements: []*DfdExternal{
+					{
+						Name: "user",
+					},
+				},
+				TrustZones: []*DfdTrustZone{
+					{
+						Name:        "storage",
+						TrustRating: &storageRating,
+						DataStores: []*DfdData{
+							{
+								Name:   "db",
+								IaLink: "Customer Data",
+							},
+						},
+					},
+				},
+				Flows: []*DfdFlow{
+					{
+						Name:     "request",
+						From:     "user",
+						To:       "api",
+						Protocol: "HTTPS",
+					},
+					{
+						Name: "query",
+						From: "api",
+						To:   "db",
+					},
+				},
+			},
+		},
+	}
+
+	o, err := tm.RenderOtm()
+	if err != nil {
+		t.Fatalf("Error rendering otm: %s", err)
+	}
+
+	if len(o.TrustZones) != 2 {
+		t.Fatalf("Expected 2 trust zones (one declared, one referenced), got %d", len(o.TrustZones))
+	}
+
+	if o.TrustZones[0].Name != "storage" || o.TrustZones[1].Name != "internal" {
+		t.Errorf("Unexpected trust zone order: %s, %s", o.TrustZones[0].Name, o.TrustZones[1].Name)
+	}
+
+	if o.TrustZones[0].Risk.TrustRating != 80 || o.TrustZones[1].Risk.TrustRating != DefaultTrustRating {
+		t.Errorf("Unexpected trust ratings: %v, %v", o.TrustZones[0].Risk.TrustRating, o.TrustZones[1].Risk.TrustRating)
+	}
+
+	components := make(map[string]otm.OtmSchemaJsonComponentsElem)
+	for _, c := range o.Components {
+		components[c.Name] = c
+	}
+
+	if len(components) != 3 {
+		t.Fatalf("Expected 3 components, got %d", len(components))
+	}
+
+	if c := components["api"]; c.Type != "process" || c.Parent.TrustZone == nil || *c.Parent.TrustZone != "main-internal" {
+		t.Errorf("Process wasn't mapped with its trust zone: %+v", c)
+	}
+
+	if c := components["user"]; c.Type != "external-element" || c.Parent.TrustZone != nil {
+		t.Errorf("External element wasn't mapped: %+v", c)
+	}
+
+	db := components["db"]
+	if db.Type != "data-store" || db.Parent.TrustZone == nil || *db.Parent.TrustZone != "main-storage" {
+		t.Errorf("Data store wasn't mapped with its trust zone: %+v", db)
+	}
+
+	if db.Assets == nil || len(db.Assets.Stored) != 1 || *db.Assets.Stored[0] != o.Assets[0].Id {
+		t.Errorf("Data store wasn't linked to its asset: %+v", db.Assets)
+	}
+
+	if len(o.Dataflows) != 2 {
+		t.Fatalf("Expected 2 dataflows, got %d", len(o.Dataflows))
+	}
+
+	flow := o.Dataflows[0]
+	if flow.Source != components["user"].Id || flow.Destination != components["api"].Id {
+		t.Errorf("Dataflow endpoints don't reference components: %+v", flow)
+	}
+
+	if flow.Attributes["protocol"] != "HTTPS" || flow.Attributes[otmDfdAttr] != "main" {
+		t.Errorf("Dataflow attributes weren't set: %+v", flow.Attributes)
+	}
+}
@@ -149,6 +149,25 @@ func (m *RiskModel) score(likelihood, impact string) float64 {
 	return round1((float64(l) / 100) * (float64(i) / 100) * 100)
 }
 
+// levelForOtm maps an OTM 0–100 likelihood/impact value back onto the nearest
+// risk level. Ties resolve towards the lower level so an import never inflates
+// a rating.
+func (m *RiskModel) levelForOtm(v float64) string {
+	best := ""
+	bestDist := math.Inf(1)
+	for _, level := range RiskLevels {
+		otmVal, ok := m.OtmValues[level]
+		if !ok {
+			continue
+		}
+		if dist := math.Abs(float64(otmVal) - v); dist < bestDist {
+			best = level
+			bestDist = dist
+		}
+	}
+	return best
+}
+
 // severity returns the matrix severity band for a likelihood/impact pair, or
 // "" if either level is unknown.
 func (m *RiskModel) severity(likelihood, impact string) string {
@@ -1,5 +1,10 @@
 package spec
 
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
 type Attribute struct {
 	NewInitiative  bool   `json:"newInitiative" hcl:"new_initiative,attr"`
 	InternetFacing bool   `json:"internetFacing" hcl:"internet_facing,attr"`
@@ -17,6 +22,11 @@ type InformationAsset struct {
 	InformationClassification string `json:"informationClassification,omitempty" hcl:"information_classification,optional"`
 	Source                    string `json:"source,omitempty" hcl:"source,optional"`
 	Ref                       string `json:"ref,omitempty" hcl:"ref,optional"`
+	// IncludedFrom is the `including` source this asset was inherited from,
+	// or empty if it's defined in the threat model itself
+	IncludedFrom string    `json:"includedFrom,omitempty"`
+	DefRange     hcl.Range `json:"-" hcl:",def_range"`
+	Body         hcl.Body  `json:"-" hcl:",body"`
 }
 
 type Threat struct {
@@ -32,6 +42,11 @@ type Threat struct {
 	ControlImports       []string           `json:"-" hcl:"control_imports,optional"`
 	Ref                  string             `json:"ref,omitempty" hcl:"ref,optional"`
 	Risk                 *Risk              `json:"risk,omitempty" hcl:"risk,block"`
+	// IncludedFrom is the `including` source this threat was inherited from,
+	// or empty if it's defined in the threat model itself
+	IncludedFrom string    `json:"includedFrom,omitempty"`
+	DefRange     hcl.Range `json:"-" hcl:",def_range"`
+	Body         hcl.Body  `json:"-" hcl:",body"`
 }
 
 // Risk is an optional, methodology-neutral risk rating attached to a threat.
@@ -47,8 +62,10 @@ type Risk struct {
 	// SeverityOverride is the optional author-supplied `severity` value. When
 	// empty, severity is computed from the likelihood×impact matrix. Use the
 	// Severity() method to get the resolved (override-or-computed) band.
-	SeverityOverride string `json:"severity,omitempty" hcl:"severity,optional"`
-	Rationale        string `json:"rationale,omitempty" hcl:"rationale,optional"`
+	SeverityOverride string    `json:"severity,omitempty" hcl:"severity,optional"`
+	Rationale        string    `json:"rationale,omitempty" hcl:"rationale,optional"`
+	DefRange         hcl.Range `json:"-" hcl:",def_range"`
+	Body             hcl.Body  `json:"-" hcl:",body"`
 }
 
 type ProposedControl struct {
@@ -97,29 +114,39 @@ type ThirdPartyDependency struct {
 	UptimeNotes      string                         `json:"uptimeNotes,omitempty" hcl:"uptime_notes,optional"`
 	Infrastructure   bool                           `json:"infrastructure,omitempty" hcl:"infrastructure,optional"`
 	Description      string                         `json:"description" hcl:"description,attr"`
+	DefRange         hcl.Range                      `json:"-" hcl:",def_range"`
+	Body             hcl.Body                       `json:"-" hcl:",body"`
 }
 
 type DfdProcess struct {
-	Name      string `json:"name" hcl:"name,label"`
-	TrustZone string `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
+	Name      string    `json:"name" hcl:"name,label"`
+	TrustZone string    `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
+	DefRange  hcl.Range `json:"-" hcl:",def_range"`
+	Body      hcl.Body  `json:"-" hcl:",body"`
 }
 
 type DfdExternal struct {
-	Name      string `json:"name" hcl:"name,label"`
-	TrustZone string `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
+	Name      string    `json:"name" hcl:"name,label"`
+	TrustZone string    `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
+	DefRange  hcl.Range `json:"-" hcl:",def_range"`
+	Body      hcl.Body  `json:"-" hcl:",body"`
 }
 
 type DfdData struct {
-	Name      string `json:"name" hcl:"name,label"`
-	TrustZone string `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
-	IaLink    string `json:"informationAsset,omitempty" hcl:"information_asset,optional"`
+	Name      string    `json:"name" hcl:"name,label"`
+	TrustZone string    `json:"trustZone,omitempty" hcl:"trust_zone,optional"`
+	IaLink    string    `json:"informationAsset,omitempty" hcl:"information_asset,optional"`
+	DefRange  hcl.Range `json:"-" hcl:",def_range"`
+	Body      hcl.Body  `json:"-" hcl:",body"`
 }
 
 type DfdFlow struct {
-	Name     string `json:"name" hcl:"name,label"`
-	From     string `json:"from" hcl:"from,attr"`
-	To       string `json:"to" hcl:"to,attr"`
-	Protocol string `json:"protocol,omitempty" hcl:"protocol,optional"`
+	Name     string    `json:"name" hcl:"name,label"`
+	From     string    `json:"from" hcl:"from,attr"`
+	To       string    `json:"to" hcl:"to,attr"`
+	Protocol string    `json:"protocol,omitempty" hcl:"protocol,optional"`
+	DefRange hcl.Range `json:"-" hcl:",def_range"`
+	Body     hcl.Body  `json:"-" hcl:",body"`
 }
 
 type DfdTrustZone struct {
@@ -127,6 +154,9 @@ type DfdTrustZone struct {
 	Processes        []*DfdProcess  `json:"process,omitempty" hcl:"process,block"`
 	ExternalElements []*DfdExternal `json:"externalElement,omitempty" hcl:"external_element,block"`
 	DataStores       []*DfdData     `json:"dataStore,omitempty" hcl:"data_store,block"`
+	TrustRating      *int           `json:"trustRating,omitempty" hcl:"trust_rating,optional"`
+	DefRange         hcl.Range      `json:"-" hcl:",def_range"`
+	Body             hcl.Body       `json:"-" hcl:",body"`
 }
 
 type LegacyDataFlowDiagram struct {
@@ -136,6 +166,7 @@ type LegacyDataFlowDiagram struct {
 	Flows            []*DfdFlow      `json:"flow,omitempty" hcl:"flow,block"`
 	TrustZones       []*DfdTrustZone `json:"trustZone,omitempty" hcl:"trust_zone,block"`
 	ImportFile       string          `json:"import,omitempty" hcl:"import,optional"`
+	DefRange         hcl.Range       `json:"-" hcl:",def_range"`
 }
 
 // MermaidDiagram is a free-form mermaid diagram embedded in a threat model.
@@ -158,13 +189,29 @@ type DataFlowDiagram struct {
 	Flows             []*DfdFlow      `json:"flow,omitempty" hcl:"flow,block"`
 	TrustZones        []*DfdTrustZone `json:"trustZone,omitempty" hcl:"trust_zone,block"`
 	ImportFile        string          `json:"-" hcl:"import,optional"`
+	// IncludedFrom is the `including` source this DFD was inherited from, or
+	// empty if it's defined in the threat model itself
+	IncludedFrom string    `json:"includedFrom,omitempty"`
+	DefRange     hcl.Range `json:"-" hcl:",def_range"`
 }
 
 type Threatmodel struct {
-	Name                   string                  `json:"name" hcl:"name,label"`
-	Description            string                  `json:"description,omitempty" hcl:"description,optional"`
-	Imports                []string                `json:"-" hcl:"imports,optional"`
-	Including              string                  `json:"including,omitempty" hcl:"including,optional"`
+	Name        string   `json:"name" hcl:"name,label"`
+	Description string   `json:"description,omitempty" hcl:"description,optional"`
+	Imports     []string `json:"-" hcl:"imports,optional"`
+	// ThreatImports, InformationAssetImports and ThirdPartyDependencyImports
+	// reference imported components (such as import.threat.NAME) to add to
+	// the threat model's blocks of that type
+	ThreatImports               []string `json:"-" hcl:"threat_imports,optional"`
+	InformationAssetImports     []string `json:"-" hcl:"information_asset_imports,optional"`
+	ThirdPartyDependencyImports []string `json:"-" hcl:"third_party_dependency_imports,optional"`
+	// Including is the threat model merged into this one, when `including`
+	// is a single source. IncludingSources is set instead when it's a list of
+	// sources, merged in order, and takes the place of Including when both
+	// are set. Both are decoded through IncludingRaw.
+	Including              string                  `json:"including,omitempty"`
+	IncludingSources       []string                `json:"includingSources,omitempty"`
+	IncludingRaw           cty.Value               `json:"-" hcl:"including,optional"`
 	Link                   string                  `json:"link,omitempty" hcl:"link,optional"`
 	DiagramLink            string                  `json:"diagramLink,omitempty" hcl:"diagram_link,optional"`
 	Repository             []string                `json:"repository,omitempty" hcl:"repository,optional"`
@@ -182,8 +229,14 @@ type Threatmodel struct {
 	DataFlowDiagrams       []*DataFlowDiagram      `json:"dataFlowDiagram,omitempty" hcl:"data_flow_diagram_v2,block"`
 	MermaidDiagrams        []*MermaidDiagram       `json:"mermaidDiagram,omitempty" hcl:"mermaid,block"`
 	LegacyDfd              *LegacyDataFlowDiagram  `json:"legacyDataFlowDiagram,omitempty" hcl:"data_flow_diagram,block"`
+	DefRange               hcl.Range               `json:"-" hcl:",def_range"`
 }
 
+// Component is a reusable element of a component library, imported into
+// other threat models with `imports`. The fields used depend on the
+// component type: "control" (and the deprecated "expanded_control") use the
+// control fields, while "threat", "information_asset" and
+// "third_party_dependency" use the same fields as their threatmodel blocks.
 type Component struct {
 	ComponentType       string              `json:"componentType" hcl:"component_type,label"`
 	ComponentName       string              `json:"componentName" hcl:"component_name,label"`
@@ -192,11 +245,50 @@ type Component struct {
 	ImplementationNotes string              `json:"implementationNotes,omitempty" hcl:"implementation_notes,optional"`
 	RiskReduction       int                 `json:"riskReduction,omitempty" hcl:"risk_reduction,optional"`
 	Attributes          []*ControlAttribute `json:"attribute,omitempty" hcl:"attribute,block"`
+	Ref                 string              `json:"ref,omitempty" hcl:"ref,optional"`
+
+	// threat components
+	ImpactType           []string   `json:"impacts,omitempty" hcl:"impacts,optional"`
+	Stride               []string   `json:"stride,omitempty" hcl:"stride,optional"`
+	InformationAssetRefs []string   `json:"informationAssetRefs,omitempty" hcl:"information_asset_refs,optional"`
+	Risk                 *Risk      `json:"risk,omitempty" hcl:"risk,block"`
+	Controls             []*Control `json:"control,omitempty" hcl:"control,block"`
+
+	// information_asset components
+	InformationClassification string `json:"informationClassification,omitempty" hcl:"information_classification,optional"`
+	Source                    string `json:"source,omitempty" hcl:"source,optional"`
+
+	// third_party_dependency components
+	Saas             bool                           `json:"saas,omitempty" hcl:"saas,optional"`
+	PayingCustomer   bool                           `json:"payingCustomer,omitempty" hcl:"paying_customer,optional"`
+	OpenSource       bool                           `json:"openSource,omitempty" hcl:"open_source,optional"`
+	UptimeDependency UptimeDependencyClassification `json:"uptimeDependency,omitempty" hcl:"uptime_dependency,optional"`
+	UptimeNotes      string                         `json:"uptimeNotes,omitempty" hcl:"uptime_notes,optional"`
+	Infrastructure   bool                           `json:"infrastructure,omitempty" hcl:"infrastructure,optional"`
 }
 
 type Variable struct {
-	VariableName  string `json:"variableName" hcl:"variable_name,label"`
-	VariableValue string `json:"variableValue" hcl:"value,attr"`
+	VariableName  string         `json:"variableName" hcl:"variable_name,label"`
+	VariableValue string         `json:"variableValue" hcl:"value,optional"`
+	TypeExpr      hcl.Expression `json:"-" hcl:"type,optional"`
+	// Type is the variable's type as written, either quoted ("number") or as
+	// a bare type expression (map(string))
+	Type        string                `json:"type,omitempty"`
+	Default     cty.Value             `json:"-" hcl:"default,optional"`
+	Description string                `json:"description,omitempty" hcl:"description,optional"`
+	Validations []*VariableValidation `json:"validations,omitempty" hcl:"validation,block"`
+	typeSrc     []byte
+}
+
+type VariableValidation struct {
+	Condition    hcl.Expression `json:"-" hcl:"condition,attr"`
+	ErrorMessage string         `json:"errorMessage" hcl:"error_message,attr"`
+	conditionSrc []byte
+}
+
+type Locals struct {
+	Values hcl.Attributes `hcl:",remain"`
+	src    [][]byte
 }
 
 type Backend struct {
@@ -212,5 +304,6 @@ type ThreatmodelWrapped struct {
 	SpecVersion  string        `json:"specVersion,omitempty" hcl:"spec_version,optional"`
 	Components   []*Component  `json:"components,omitempty" hcl:"component,block"`
 	Variables    []*Variable   `json:"variables,omitempty" hcl:"variable,block"`
+	Locals       []*Locals     `json:"-" hcl:"locals,block"`
 	Backends     []*Backend    `json:"backend,omitempty" hcl:"backend,block"`
 }
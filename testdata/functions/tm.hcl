@@ -0,0 +1,29 @@
+spec_version = "0.1.17"
+
+variable "service" {
+  default = "payments"
+}
+
+variable "env" {
+  default = "prod"
+
+  validation {
+    condition     = contains(["staging", "prod"], var.env)
+    error_message = "env must be staging or prod"
+  }
+}
+
+threatmodel "functions" {
+  author      = "@xntrik"
+  description = templatefile("summary.tmpl", { service = var.service, assets = ["cards", "tokens"] })
+  link        = format("https://%s-%s.example.com", var.service, lower(var.env))
+
+  information_asset "database" {
+    description = format("%s-db", var.service)
+  }
+
+  threat "session hijacking" {
+    description = upper(var.env)
+    control     = trimspace(file("threat-notes.md"))
+  }
+}
@@ -0,0 +1,16 @@
+spec_version = "0.4.0"
+
+threatmodel "PCI scope" {
+  description = "Baseline for services in PCI scope"
+  author = "@platform"
+  diagram_link = "https://example.com/baselines/pci.png"
+
+  information_asset "cardholder data" {
+    description = "Primary account numbers"
+    information_classification = "Restricted"
+  }
+
+  threat "credential_stuffing" {
+    description = "Credential stuffing, as described by the PCI baseline"
+  }
+}
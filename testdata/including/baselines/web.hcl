@@ -0,0 +1,15 @@
+spec_version = "0.4.0"
+
+threatmodel "Internet-facing web app" {
+  description = "Baseline for internet-facing web apps"
+  author = "@platform"
+  link = "https://example.com/baselines/web"
+
+  threat "xss" {
+    description = "Cross site scripting"
+  }
+
+  threat "credential_stuffing" {
+    description = "Credential stuffing, as described by the web baseline"
+  }
+}
@@ -0,0 +1,11 @@
+spec_version = "0.1.17"
+
+threatmodel "Payments" {
+  author = "@xntrik"
+
+  including = "middle.hcl"
+
+  threat "app_threat" {
+    description = "Defined in the application model"
+  }
+}
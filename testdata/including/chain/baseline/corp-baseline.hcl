@@ -0,0 +1,18 @@
+spec_version = "0.1.17"
+
+threatmodel "Corp Baseline" {
+  description = "The corporate baseline"
+  author = "@xntrik"
+
+  information_asset "employee data" {
+    description = "HR records"
+  }
+
+  threat "baseline_threat" {
+    description = "Defined in the corporate baseline"
+  }
+
+  data_flow_diagram_v2 "baseline" {
+    process "sso" {}
+  }
+}
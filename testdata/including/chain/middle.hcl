@@ -0,0 +1,15 @@
+spec_version = "0.1.17"
+
+threatmodel "Payments" {
+  author = "@xntrik"
+
+  including = "baseline/corp-baseline.hcl"
+
+  information_asset "payment data" {
+    description = "Card numbers and tokens"
+  }
+
+  threat "middle_threat" {
+    description = "Defined in the business unit model"
+  }
+}
@@ -0,0 +1,7 @@
+spec_version = "0.1.17"
+
+threatmodel "A" {
+  author = "@xntrik"
+
+  including = "b.hcl"
+}
@@ -0,0 +1,7 @@
+spec_version = "0.1.17"
+
+threatmodel "B" {
+  author = "@xntrik"
+
+  including = "a.hcl"
+}
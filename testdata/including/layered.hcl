@@ -0,0 +1,14 @@
+spec_version = "0.4.0"
+
+threatmodel "Checkout" {
+  author = "@xntrik"
+
+  including = [
+    "baselines/web.hcl",
+    "baselines/pci.hcl",
+  ]
+
+  threat "xss" {
+    description = "Cross site scripting in the checkout form"
+  }
+}
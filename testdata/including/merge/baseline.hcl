@@ -0,0 +1,30 @@
+spec_version = "0.4.0"
+
+threatmodel "Corp Baseline" {
+  description = "The corporate baseline"
+  author = "@platform"
+
+  information_asset "session tokens" {
+    description = "Baseline description of session tokens"
+    information_classification = "Restricted"
+  }
+
+  threat "session_hijacking" {
+    description = "Baseline description of session hijacking"
+    stride = ["Spoofing"]
+    impacts = ["Confidentiality"]
+
+    risk {
+      likelihood = "high"
+      impact = "high"
+    }
+
+    control "Short session lifetimes" {
+      description = "Baseline short session lifetimes"
+    }
+
+    control "Rotate session ids" {
+      description = "Rotate the session id on login"
+    }
+  }
+}
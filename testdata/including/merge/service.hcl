@@ -0,0 +1,22 @@
+spec_version = "0.4.0"
+
+threatmodel "Checkout" {
+  description = "The checkout service"
+  author = "@xntrik"
+
+  including = "baseline.hcl"
+
+  information_asset "session tokens" {
+    description = "Service description of session tokens"
+    information_classification = "Confidential"
+  }
+
+  threat "session_hijacking" {
+    description = "Service description of session hijacking"
+    stride = ["Spoofing", "Elevation of privilege"]
+
+    control "Short session lifetimes" {
+      description = "Service short session lifetimes"
+    }
+  }
+}
@@ -0,0 +1,38 @@
+spec_version = "0.4.0"
+
+component "information_asset" "session_tokens" {
+  description = "Session tokens issued at login"
+  information_classification = "restricted"
+  source = "Identity service"
+}
+
+component "third_party_dependency" "payments_vendor" {
+  description = "Card payment processing"
+  saas = true
+  paying_customer = true
+  uptime_dependency = "hard"
+  uptime_notes = "Checkout is unavailable without it"
+}
+
+component "threat" "session_hijacking" {
+  description = "An attacker takes over a user's session"
+  impacts = ["confidentiality"]
+  stride = ["spoofing"]
+  information_asset_refs = ["session_tokens"]
+  ref = "THREAT-001"
+
+  risk {
+    likelihood = "medium"
+    impact = "high"
+  }
+
+  control "Short session lifetimes" {
+    description = "Sessions expire after 15 minutes of inactivity"
+    implemented = true
+    risk_reduction = 40
+  }
+}
+
+component "control" "mfa" {
+  description = "Multi-factor authentication"
+}
@@ -0,0 +1,7 @@
+threatmodel "Split App" {
+  author = "@xntrik"
+
+  information_asset "customer data" {
+    description = "Names and addresses of customers"
+  }
+}
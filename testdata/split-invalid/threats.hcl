@@ -0,0 +1,19 @@
+threatmodel "Split App" {
+  information_asset "customer data" {
+    description = "A duplicate asset in another file"
+  }
+
+  threat "data_leak" {
+    description            = "Customer data is leaked"
+    information_asset_refs = ["payment data"]
+  }
+
+  data_flow_diagram_v2 "Main" {
+    process "api" {}
+
+    flow "sql" {
+      from = "api"
+      to   = "db"
+    }
+  }
+}
@@ -0,0 +1,10 @@
+spec_version = "0.4.0"
+
+threatmodel "Split App" {
+  author = "@xntrik"
+
+  information_asset "customer data" {
+    description                = "Names and addresses of customers"
+    information_classification = "Confidential"
+  }
+}
@@ -0,0 +1,21 @@
+threatmodel "Split App" {
+  data_flow_diagram_v2 "Main" {
+    external_element "customer" {}
+
+    process "api" {}
+
+    data_store "db" {
+      information_asset = "customer data"
+    }
+
+    flow "https" {
+      from = "customer"
+      to   = "api"
+    }
+
+    flow "sql" {
+      from = "api"
+      to   = "db"
+    }
+  }
+}
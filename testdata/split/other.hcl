@@ -0,0 +1,3 @@
+threatmodel "Other App" {
+  author = "@xntrik"
+}
@@ -0,0 +1,15 @@
+spec_version = "0.4.0"
+
+variable "service" {
+  value = "billing"
+}
+
+threatmodel "Split App" {
+  description = "A ${var.service} service split across files"
+
+  threat "data_leak" {
+    description            = "Customer data is leaked from the ${var.service} database"
+    impacts                = ["Confidentiality"]
+    information_asset_refs = ["customer data"]
+  }
+}
@@ -0,0 +1 @@
+strict = true
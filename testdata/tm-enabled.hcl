@@ -0,0 +1,72 @@
+spec_version = "0.1.17"
+
+variable "handles_card_data" {
+  type    = "bool"
+  default = false
+}
+
+variable "services" {
+  type    = "list"
+  default = ["api", "admin"]
+}
+
+locals {
+  internet_facing = true
+}
+
+threatmodel "enabled" {
+  author = "@xntrik"
+
+  threat "card skimming" {
+    enabled     = var.handles_card_data
+    description = "Card data is skimmed in transit"
+  }
+
+  threat "credential stuffing" {
+    enabled     = local.internet_facing
+    description = "Credentials are stuffed into the login page"
+
+    control "rate limiting" {
+      description = "Logins are rate limited"
+    }
+
+    control "pci scope reduction" {
+      enabled     = var.handles_card_data
+      description = "Card data is tokenized"
+    }
+  }
+
+  threat "admin takeover" {
+    for_each = var.services
+    enabled  = each.key == "admin"
+
+    description = "Takeover of the ${each.key} service"
+  }
+
+  third_party_dependency "payment gateway" {
+    enabled           = var.handles_card_data
+    description       = "Processes payments"
+    uptime_dependency = "hard"
+  }
+
+  data_flow_diagram_v2 "services" {
+    external_element "user" {}
+
+    process "web" {}
+
+    data_store "cards" {
+      enabled = var.handles_card_data
+    }
+
+    flow "https" {
+      from = "user"
+      to   = "web"
+    }
+
+    flow "store" {
+      enabled = var.handles_card_data
+      from    = "web"
+      to      = "cards"
+    }
+  }
+}
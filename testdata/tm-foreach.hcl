@@ -0,0 +1,55 @@
+spec_version = "0.1.17"
+
+variable "services" {
+  type    = "list"
+  default = ["api", "billing"]
+}
+
+locals {
+  owners = {
+    api     = "platform"
+    billing = "payments"
+  }
+}
+
+threatmodel "foreach" {
+  author = "@xntrik"
+
+  information_asset "store" {
+    for_each = local.owners
+
+    description = "Data owned by ${each.value} for ${each.key}"
+  }
+
+  threat "sql injection" {
+    for_each = var.services
+
+    description            = "SQL injection against ${each.key}"
+    information_asset_refs = ["store[${each.key}]"]
+
+    control "parameterized queries" {
+      description = "Queries in ${each.value} are parameterized"
+    }
+
+    control "waf" {
+      for_each = toset(["edge", "internal"])
+
+      description = "WAF at the ${each.key}"
+    }
+  }
+
+  data_flow_diagram_v2 "services" {
+    external_element "user" {}
+
+    process "svc" {
+      for_each = var.services
+    }
+
+    flow "https" {
+      for_each = var.services
+
+      from = "user"
+      to   = "svc[${each.key}]"
+    }
+  }
+}
@@ -0,0 +1,34 @@
+// A threat model using every deprecated construct
+spec_version = "0.1.4"
+
+threatmodel "migrate" {
+  author = "@xntrik" # the author
+
+  threat "phishing" {
+    description = "An attacker phishes a user"
+    control     = "Use MFA"   # note
+
+    // proposed controls predate control blocks
+    proposed_control {
+      implemented = true
+      description = "Train users" # yearly
+    }
+
+    proposed_control {
+      description = "Hardware keys"
+    }
+
+    expanded_control "control" {
+      description = "Block lookalike domains"
+    }
+  }
+
+  threat "untouched" {
+    description = "Nothing to migrate here"       # comments are kept
+  }
+
+  # the legacy diagram
+  data_flow_diagram {
+    process "web" {}
+  }
+}
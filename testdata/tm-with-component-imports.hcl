@@ -0,0 +1,23 @@
+spec_version = "0.4.0"
+
+threatmodel "checkout" {
+  author = "@xntrik"
+  imports = ["library.hcl"]
+
+  information_asset_imports = ["import.information_asset.session_tokens"]
+  third_party_dependency_imports = ["import.third_party_dependency.payments_vendor"]
+
+  threat_imports = [
+    "import.threat.session_hijacking",
+  ]
+
+  threat "card_skimming" {
+    description = "Card data is skimmed in the browser"
+    impacts = ["Confidentiality"]
+    control_imports = ["import.control.mfa"]
+  }
+
+  threat "reused_description" {
+    description = import.threat.session_hijacking.description
+  }
+}
@@ -0,0 +1,29 @@
+spec_version = "0.1.17"
+
+variable "env" {
+  default = "prod"
+}
+
+locals {
+  service = "payments"
+  base_url = "https://${local.service}.${var.env}.example.com"
+}
+
+locals {
+  db_name      = format("%s-db", local.service)
+  shared_notes = "Reviewed for ${upper(var.env)}"
+}
+
+threatmodel "locals" {
+  author = "@xntrik"
+  link   = local.base_url
+
+  information_asset "database" {
+    description = local.db_name
+  }
+
+  threat "sql injection" {
+    description = "Injection into ${local.db_name}"
+    control     = local.shared_notes
+  }
+}
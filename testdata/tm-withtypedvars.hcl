@@ -0,0 +1,48 @@
+spec_version = "0.1.17"
+
+variable "env" {
+  type        = "string"
+  default     = "staging"
+  description = "The environment being modelled"
+
+  validation {
+    condition     = var.env == "staging" || var.env == "prod"
+    error_message = "env must be staging or prod"
+  }
+}
+
+variable "replicas" {
+  type    = "number"
+  default = 2
+
+  validation {
+    condition     = var.replicas > 0
+    error_message = "replicas must be positive"
+  }
+}
+
+variable "internet_facing" {
+  type    = "bool"
+  default = false
+}
+
+variable "stride" {
+  type    = "list"
+  default = ["spoofing"]
+}
+
+threatmodel "typed" {
+  author      = "@xntrik"
+  description = "${var.env} with ${var.replicas} replicas"
+
+  attributes {
+    new_initiative  = false
+    internet_facing = var.internet_facing
+    initiative_size = "Small"
+  }
+
+  threat "typed_threat" {
+    description = "Threat against ${var.env}"
+    stride      = var.stride
+  }
+}